@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	LogDir              = "logs"
+	LogCleanupInterval  = 24 * time.Hour
+	logFilePattern      = "market_watcher_*.log"
+	logFileNameTemplate = "market_watcher_%s.log"
+)
+
+// cleanupLogs removes the watcher's own log files in dir that are older than
+// maxAge or, newest first, beyond the first maxFiles. Zero disables either
+// limit. The file in use is never removed.
+func cleanupLogs(dir string, maxAge time.Duration, maxFiles int, current string, logger *slog.Logger) {
+	paths, err := filepath.Glob(filepath.Join(dir, logFilePattern))
+	if err != nil {
+		logger.Error("Log cleanup failed", "err", err)
+		return
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, logFile{path: path, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	now := time.Now()
+	kept := 0
+	for _, f := range files {
+		if f.path == current {
+			kept++
+			continue
+		}
+		if (maxAge > 0 && now.Sub(f.modTime) > maxAge) || (maxFiles > 0 && kept >= maxFiles) {
+			if err := os.Remove(f.path); err != nil {
+				logger.Error("Log file removal failed", "path", f.path, "err", err)
+				continue
+			}
+			logger.Debug("Removed old log file", "path", f.path)
+			continue
+		}
+		kept++
+	}
+}
+
+// runLogCleanup repeats cleanupLogs every LogCleanupInterval until ctx is
+// cancelled.
+func runLogCleanup(ctx context.Context, dir string, maxAge time.Duration, maxFiles int, current string, logger *slog.Logger) {
+	ticker := time.NewTicker(LogCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanupLogs(dir, maxAge, maxFiles, current, logger)
+		}
+	}
+}
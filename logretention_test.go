@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestCleanupLogs(t *testing.T) {
+	// Files by age in days; the newest is the one in use.
+	ages := map[string]int{
+		"market_watcher_a.log": 0,
+		"market_watcher_b.log": 2,
+		"market_watcher_c.log": 5,
+		"market_watcher_d.log": 10,
+		"market_watcher_e.log": 30,
+		"other.log":            30,
+	}
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxFiles int
+		current  string
+		want     []string
+	}{
+		{
+			name:   "by age",
+			maxAge: 7 * 24 * time.Hour,
+			want:   []string{"market_watcher_a.log", "market_watcher_b.log", "market_watcher_c.log", "other.log"},
+		},
+		{
+			name:     "by count",
+			maxFiles: 2,
+			want:     []string{"market_watcher_a.log", "market_watcher_b.log", "other.log"},
+		},
+		{
+			name:     "both",
+			maxAge:   3 * 24 * time.Hour,
+			maxFiles: 3,
+			want:     []string{"market_watcher_a.log", "market_watcher_b.log", "other.log"},
+		},
+		{
+			name:    "current file is kept",
+			maxAge:  24 * time.Hour,
+			current: "market_watcher_e.log",
+			want:    []string{"market_watcher_a.log", "market_watcher_e.log", "other.log"},
+		},
+		{
+			name: "no limits",
+			want: []string{"market_watcher_a.log", "market_watcher_b.log", "market_watcher_c.log", "market_watcher_d.log", "market_watcher_e.log", "other.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now()
+			for name, days := range ages {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, []byte("log\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				mtime := now.Add(-time.Duration(days)*24*time.Hour - time.Minute)
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			current := ""
+			if tt.current != "" {
+				current = filepath.Join(dir, tt.current)
+			}
+
+			cleanupLogs(dir, tt.maxAge, tt.maxFiles, current, testLogger)
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []string
+			for _, e := range entries {
+				left = append(left, e.Name())
+			}
+			sort.Strings(left)
+			if strings.Join(left, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("left %q, want %q", left, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LogFlushInterval = 1 * time.Second
+	LogSyncInterval  = 10 * time.Second
+	// LogQueueSize is how many log lines wait for the writer goroutine
+	// before further lines are dropped.
+	LogQueueSize = 4096
+)
+
+// logWriter writes the log file from its own goroutine: Write only queues
+// the line, so a stalled disk (slow NFS, full disk) never holds up the read
+// loops that log. Lines are dropped when the queue is full, and write
+// errors go to stderr instead of failing the caller. The buffer is flushed
+// every LogFlushInterval and after warnings and errors (see flushHandler),
+// and the file is synced to disk every LogSyncInterval.
+type logWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+
+	// mu guards closed: Write holds it shared while queueing so Close
+	// cannot close the queue under it.
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan logOp
+	done    chan struct{}
+	dropped atomic.Int64
+	failing bool
+}
+
+// logOp is a line to write, or with no data a flush or sync request.
+type logOp struct {
+	data []byte
+	sync bool
+}
+
+func newLogWriter(file *os.File) *logWriter {
+	w := &logWriter{
+		file:  file,
+		buf:   bufio.NewWriter(file),
+		queue: make(chan logOp, LogQueueSize),
+		done:  make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.enqueue(logOp{data: bytes.Clone(p)})
+	return len(p), nil
+}
+
+func (w *logWriter) enqueue(op logOp) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.queue <- op:
+	default:
+		if op.data != nil {
+			w.dropped.Add(1)
+		}
+	}
+}
+
+// Flush and Sync ask the writer goroutine to flush the buffer or sync the
+// file once it has written what is already queued.
+func (w *logWriter) Flush() {
+	w.enqueue(logOp{})
+}
+
+func (w *logWriter) Sync() {
+	w.enqueue(logOp{sync: true})
+}
+
+func (w *logWriter) Name() string {
+	return w.file.Name()
+}
+
+// Close writes out the queue, then syncs and closes the file.
+func (w *logWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.file.Close()
+}
+
+func (w *logWriter) loop() {
+	defer close(w.done)
+	for op := range w.queue {
+		switch {
+		case op.data != nil:
+			_, err := w.buf.Write(op.data)
+			w.check(err, false)
+		case op.sync:
+			w.check(w.sync(), true)
+		default:
+			w.check(w.buf.Flush(), true)
+			w.reportDropped()
+		}
+	}
+	w.check(w.sync(), true)
+	w.reportDropped()
+}
+
+func (w *logWriter) reportDropped() {
+	if n := w.dropped.Swap(0); n > 0 {
+		fmt.Fprintf(os.Stderr, "log: queue full, dropped %d lines\n", n)
+	}
+}
+
+func (w *logWriter) sync() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// check reports the first of a run of write errors to stderr, and the
+// recovery once a flush reaches the file again; a buffered write proves
+// nothing. A bufio writer keeps failing after an error, so it is reset and
+// the lines it held are lost.
+func (w *logWriter) check(err error, flushed bool) {
+	if err == nil {
+		if w.failing && flushed {
+			fmt.Fprintln(os.Stderr, "log: writes recovered")
+			w.failing = false
+		}
+		return
+	}
+	w.buf.Reset(w.file)
+	if !w.failing {
+		fmt.Fprintf(os.Stderr, "log: write to %s failed, dropping lines until it recovers: %v\n", w.file.Name(), err)
+		w.failing = true
+	}
+}
+
+func (w *logWriter) Run(ctx context.Context) {
+	flush := time.NewTicker(LogFlushInterval)
+	defer flush.Stop()
+	sync := time.NewTicker(LogSyncInterval)
+	defer sync.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flush.C:
+			w.Flush()
+		case <-sync.C:
+			w.Sync()
+		}
+	}
+}
+
+// flushHandler has the log file flushed after warnings and errors, so they
+// reach the file without waiting for the next LogFlushInterval.
+type flushHandler struct {
+	slog.Handler
+	w *logWriter
+}
+
+func (h flushHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.Handler.Handle(ctx, r)
+	if r.Level >= slog.LevelWarn {
+		h.w.Flush()
+	}
+	return err
+}
+
+func (h flushHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return flushHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h flushHandler) WithGroup(name string) slog.Handler {
+	return flushHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
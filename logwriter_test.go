@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"market-ws/marketwatch"
+)
+
+// inTempDir runs the rest of the test in a new directory, where createLogger
+// puts its LogDir.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// waitForLine polls the file until it contains line.
+func waitForLine(t *testing.T, name, line string, within time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), line) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s does not contain %q after %s: %q", name, line, within, data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCreateLoggerFlushes(t *testing.T) {
+	inTempDir(t)
+	logger, logFile, err := createLogger(marketwatch.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go logFile.Run(ctx)
+
+	tests := []struct {
+		name   string
+		log    func(msg string, args ...any)
+		within time.Duration
+	}{
+		// Warnings are flushed as they are written, other lines on the ticker.
+		{name: "warning", log: logger.Warn, within: LogFlushInterval / 2},
+		{name: "info", log: logger.Info, within: 2 * LogFlushInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := "line for " + tt.name
+			tt.log(msg)
+			waitForLine(t, logFile.Name(), msg, tt.within)
+		})
+	}
+}
+
+func TestLogWriterClose(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "market_watcher_*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newLogWriter(file)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte("queued line\n"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "queued line\n"); n != 100 {
+		t.Errorf("%d lines written, want 100", n)
+	}
+	// Writes after Close are dropped, not a panic on the closed queue.
+	w.Write([]byte("late line\n"))
+}
+
+// captureStderr sends stderr to a file until the test ends and returns a
+// function reading what was written. Call it before starting a logWriter so
+// its goroutine sees the swap.
+func captureStderr(t *testing.T) func() string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = f
+	t.Cleanup(func() {
+		os.Stderr = stderr
+		f.Close()
+	})
+	return func() string {
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
+
+func TestLogWriterBlockedDisk(t *testing.T) {
+	stderr := captureStderr(t)
+	// Nothing reads the pipe, so the writer goroutine blocks once the
+	// pipe buffer is full, like a stalled disk.
+	r, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w := newLogWriter(pw)
+	logger := slog.New(slog.NewTextHandler(w, nil))
+
+	const lines = 4 * LogQueueSize
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < lines; i++ {
+			logger.Info("Frame received", "n", i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked on a stalled writer")
+	}
+	if w.dropped.Load() == 0 {
+		t.Error("no lines dropped with the queue full")
+	}
+
+	// Once the disk catches up, Close drains what was queued.
+	read := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		read <- string(data)
+	}()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := <-read
+	if !strings.Contains(data, "msg=\"Frame received\" n=0\n") {
+		t.Error("first line lost")
+	}
+	if n := strings.Count(data, "Frame received"); n < LogQueueSize || n >= lines {
+		t.Errorf("%d of %d lines written, want at least the queue", n, lines)
+	}
+	if !strings.Contains(stderr(), "log: queue full, dropped") {
+		t.Errorf("stderr %q does not report dropped lines", stderr())
+	}
+}
+
+func TestLogWriterFullDisk(t *testing.T) {
+	stderr := captureStderr(t)
+	file, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip("no /dev/full:", err)
+	}
+	w := newLogWriter(file)
+	for i := 0; i < 100; i++ {
+		if n, err := w.Write([]byte("line on a full disk\n")); n != 20 || err != nil {
+			t.Fatalf("Write = %d, %v; want the line accepted", n, err)
+		}
+		w.Flush()
+	}
+	w.Close()
+	if got := strings.Count(stderr(), "log: write to /dev/full failed"); got != 1 {
+		t.Errorf("stderr %q, want the failure reported once", stderr())
+	}
+}
+
+func TestCreateLoggerNoLogDir(t *testing.T) {
+	inTempDir(t)
+	if err := os.WriteFile(LogDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := createLogger(marketwatch.DefaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "create log directory") {
+		t.Errorf("err = %v, want a log directory error", err)
+	}
+}
+
+func TestCreateLoggerTimezone(t *testing.T) {
+	tests := []struct {
+		name   string
+		tz     string
+		format string
+		json   bool
+		// zone is how the offset appears in the line timestamp.
+		zone string
+	}{
+		{name: "default", tz: "UTC", format: "rfc3339", zone: "Z"},
+		{name: "tokyo millis", tz: "Asia/Tokyo", format: "rfc3339ms", zone: "+09:00"},
+		{name: "custom layout", tz: "America/Sao_Paulo", format: "2006-01-02 15:04:05 -0700", zone: "-0300"},
+		{name: "json", tz: "Asia/Kolkata", format: "rfc3339", json: true, zone: "+05:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			cfg := marketwatch.DefaultConfig()
+			cfg.LogTimezone, cfg.LogTimeFormat = tt.tz, tt.format
+			if tt.json {
+				cfg.LogFormat = marketwatch.LogFormatJSON
+			}
+			loc, layout := cfg.LogLocation(), cfg.LogTimeLayout()
+			before := time.Now().Truncate(time.Second)
+			logger, logFile, err := createLogger(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.Warn("Zone check")
+			after := time.Now()
+			logFile.Close()
+
+			stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(logFile.Name()), "market_watcher_"), ".log")
+			named, err := time.ParseInLocation("20060102_150405", stamp, loc)
+			if err != nil || named.Before(before) || named.After(after) {
+				t.Errorf("file name time %s (%v), want it in %s between %s and %s", stamp, err, tt.tz, before, after)
+			}
+
+			data, err := os.ReadFile(logFile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := strings.TrimSpace(string(data))
+			var ts string
+			if tt.json {
+				var rec struct{ Time string }
+				if err := json.Unmarshal([]byte(line), &rec); err != nil {
+					t.Fatal(err)
+				}
+				ts = rec.Time
+			} else {
+				ts, _, _ = strings.Cut(strings.TrimPrefix(line, "time="), " level=")
+				ts = strings.Trim(ts, `"`)
+			}
+			logged, err := time.Parse(layout, ts)
+			if err != nil || !strings.HasSuffix(ts, tt.zone) || logged.Before(before) || logged.After(after) {
+				t.Errorf("line time %q (%v), want %s between %s and %s in %s", ts, err, layout, before, after, line)
+			}
+		})
+	}
+}
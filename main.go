@@ -1,252 +1,163 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"market-ws/marketwatch"
 )
 
-const (
-	APIKey         = "YOUR_API_KEY"
-	ReconnectDelay = 5 * time.Second
-	MaxRetries     = 5
-	PingInterval   = 45 * time.Second
-)
-
-type DotaMarketWatcher struct {
-	conn         *websocket.Conn
-	token        string
-	tokenExpires time.Time
-	retries      int
-	lastPing     time.Time
-	logger       *log.Logger
-}
+// ExitNoItems is the exit status of a -duration run that matched nothing.
+const ExitNoItems = 2
 
-func createLogger() (*log.Logger, error) {
-	os.MkdirAll("logs", 0755)
-	logFileName := fmt.Sprintf("logs/market_watcher_%s.log", time.Now().Format("20060102_150405"))
+func createLogger(cfg *marketwatch.Config) (*slog.Logger, *logWriter, error) {
+	if err := os.MkdirAll(LogDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("create log directory: %w", err)
+	}
+	loc, layout := cfg.LogLocation(), cfg.LogTimeLayout()
+	logFileName := filepath.Join(LogDir, fmt.Sprintf(logFileNameTemplate, time.Now().In(loc).Format("20060102_150405")))
 	file, err := os.Create(logFileName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return log.New(file, "", log.LstdFlags), nil
-}
+	logFile := newLogWriter(file)
 
-func (d *DotaMarketWatcher) Initialize() error {
-	d.retries = 0
-	if err := d.UpdateToken(); err != nil {
-		return err
+	var w io.Writer = logFile
+	if cfg.LogStdout {
+		w = io.MultiWriter(logFile, os.Stdout)
 	}
-	return d.Connect()
-}
 
-func (d *DotaMarketWatcher) UpdateToken() error {
-	url := fmt.Sprintf("https://market.csgo.com/api/v2/get-ws-token?key=%s", APIKey)
-	resp, err := http.Post(url, "application/json", nil)
-	if err != nil {
-		d.logger.Printf("Token request error: %v", err)
-		return err
+	opts := &slog.HandlerOptions{
+		Level: cfg.Level(),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+				return slog.String(slog.TimeKey, a.Value.Time().In(loc).Format(layout))
+			}
+			return a
+		},
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		d.logger.Printf("Response read error: %v", err)
-		return err
+	var handler slog.Handler
+	if cfg.LogFormat == marketwatch.LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	handler = flushHandler{Handler: handler, w: logFile}
+	if cfg.Syslog {
+		sys, err := newSyslogHandler(cfg.SyslogAddr, opts.Level)
+		if err != nil {
+			logFile.Close()
+			return nil, nil, fmt.Errorf("syslog: %w", err)
+		}
+		handler = teeHandler{handler, sys}
 	}
+	return slog.New(handler), logFile, nil
+}
 
-	var data struct {
-		Success bool   `json:"success"`
-		Token   string `json:"token"`
-		Error   string `json:"error"`
-	}
-	if err = json.Unmarshal(body, &data); err != nil {
-		d.logger.Printf("Token parse error: %v", err)
-		return err
-	}
+func handleSignals(logger *slog.Logger, cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
-	if data.Success {
-		d.token = data.Token
-		d.tokenExpires = time.Now().Add(9 * time.Minute)
-		d.logger.Println("Token updated")
-		return nil
-	}
+	<-sigs
+	logger.Info("Shutdown requested")
+	cancel()
 
-	d.logger.Printf("Token error: %s", data.Error)
-	return fmt.Errorf("token error: %s", data.Error)
+	<-sigs
+	logger.Warn("Forced exit")
+	os.Exit(1)
 }
 
-func (d *DotaMarketWatcher) Connect() error {
-	if time.Now().After(d.tokenExpires) {
-		if err := d.UpdateToken(); err != nil {
-			return err
+// reloadOnHangup reloads the blacklist and watchlist files on SIGHUP.
+func reloadOnHangup(ctx context.Context, watcher *marketwatch.Watcher, cfg *marketwatch.Config, logger *slog.Logger) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+			if cfg.BlacklistPath != "" {
+				if err := watcher.ReloadBlacklist(); err != nil {
+					logger.Error("Blacklist reload failed", "err", err)
+				}
+			}
+			if cfg.WatchlistPath != "" {
+				if err := watcher.ReloadWatchlist(); err != nil {
+					logger.Error("Watchlist reload failed", "err", err)
+				}
+			}
 		}
 	}
+}
 
-	d.logger.Println("Connecting to WebSocket...")
-	conn, _, err := websocket.DefaultDialer.Dial(
-		"wss://wsn.dota2.net/wsn/",
-		http.Header{
-			"Origin":     []string{"https://market.csgo.com"},
-			"User-Agent": []string{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"},
-		},
-	)
+func main() {
+	cfg, err := marketwatch.LoadConfig()
 	if err != nil {
-		d.logger.Printf("Connection error: %v", err)
-		return err
-	}
-
-	d.conn = conn
-	if d.token != "" {
-		if err = d.conn.WriteMessage(websocket.TextMessage, []byte(d.token)); err != nil {
-			d.logger.Printf("Token send error: %v", err)
-			return err
-		}
-	}
-
-	for _, channel := range []string{"newitems_go"} {
-		if err = d.conn.WriteMessage(websocket.TextMessage, []byte(channel)); err != nil {
-			d.logger.Printf("Subscribe error: %v", err)
-			return err
+		if errors.Is(err, flag.ErrHelp) {
+			return
 		}
+		log.Fatal("Config error: ", err)
 	}
 
-	d.logger.Println("Connected successfully")
-	return nil
-}
-
-func (d *DotaMarketWatcher) processMessage(message []byte) {
-	var data map[string]interface{}
-	if err := json.Unmarshal(message, &data); err != nil {
-		d.logger.Printf("Non-JSON message: %s", message)
-		return
+	logger, logFile, err := createLogger(cfg)
+	if err != nil {
+		log.Fatal("Logger creation failed: ", err)
 	}
+	defer logFile.Close()
 
-	if data["type"] == "newitems_go" {
-		itemData := make(map[string]interface{})
-		if err := json.Unmarshal([]byte(data["data"].(string)), &itemData); err != nil {
-			d.logger.Printf("Data parse error: %v", err)
-			return
-		}
-
-		var buffer bytes.Buffer
-		buffer.WriteString(fmt.Sprintf("\n%s\n", strings.Repeat("=", 50)))
-		buffer.WriteString(fmt.Sprintf("Item: %s\n", getValue(itemData, "i_market_name")))
-		buffer.WriteString(fmt.Sprintf("Quality: %s\n", getValue(itemData, "i_quality", "--")))
-		buffer.WriteString(fmt.Sprintf("Price: %s %s\n",
-			getValue(itemData, "ui_price"),
-			getValue(itemData, "ui_currency")))
-
-		if floatVal := getValue(itemData, "ui_float"); floatVal != "" && floatVal != "<nil>" {
-			buffer.WriteString(fmt.Sprintf("Float: %s\n", floatVal))
-		}
-
-		if stickers, ok := itemData["stickers"].([]interface{}); ok && len(stickers) > 0 {
-			buffer.WriteString("Stickers:\n")
-			for _, s := range stickers {
-				stickerID := fmt.Sprintf("%.0f", s.(float64))
-				buffer.WriteString(fmt.Sprintf("  - ID: %s\n", stickerID))
-			}
-		}
-
-		if inspectURL := getValue(itemData, "inspect_url"); inspectURL != "" {
-			buffer.WriteString(fmt.Sprintf("Inspect: %s\n",
-				strings.ReplaceAll(inspectURL, `\/`, `/`)))
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleSignals(logger, cancel)
+	serviceStopped := runService(logger, cancel)
+	go logFile.Run(ctx)
 
-		buffer.WriteString(fmt.Sprintf("%s\n", strings.Repeat("=", 50)))
-		d.logger.Println(buffer.String())
-	}
-}
-
-func getValue(data map[string]interface{}, keys ...string) string {
-	key := keys[0]
-	defaultValue := ""
-	if len(keys) > 1 {
-		defaultValue = keys[1]
+	if cfg.LogRetention > 0 || cfg.LogMaxFiles > 0 {
+		retention := time.Duration(cfg.LogRetention)
+		cleanupLogs(LogDir, retention, cfg.LogMaxFiles, logFile.Name(), logger)
+		go runLogCleanup(ctx, LogDir, retention, cfg.LogMaxFiles, logFile.Name(), logger)
 	}
 
-	val, ok := data[key]
-	if !ok {
-		return defaultValue
+	if cfg.RunDuration > 0 {
+		timer := time.AfterFunc(time.Duration(cfg.RunDuration), func() {
+			logger.Info("Run duration elapsed, shutting down", "duration", cfg.RunDuration)
+			cancel()
+		})
+		defer timer.Stop()
 	}
 
-	switch v := val.(type) {
-	case string:
-		return v
-	case float64:
-		return fmt.Sprintf("%.2f", v)
-	default:
-		return fmt.Sprintf("%v", v)
+	cfg.Logger = logger
+	cfg.Output = os.Stdout
+	if notifier := newSystemdNotifier(logger); notifier != nil {
+		cfg.OnReady = notifier.Ready
+		cfg.OnAlive = notifier.Alive
+		context.AfterFunc(ctx, notifier.Stopping)
 	}
-}
-
-func (d *DotaMarketWatcher) Listen() error {
-	defer d.conn.Close()
-
-	ticker := time.NewTicker(PingInterval)
-	defer ticker.Stop()
-
-	done := make(chan error)
-	go func() {
-		for {
-			_, msg, err := d.conn.ReadMessage()
-			if err != nil {
-				done <- err
-				return
-			}
-			d.processMessage(msg)
-		}
-	}()
-
-	for {
-		select {
-		case err := <-done:
-			return err
-		case <-ticker.C:
-			if err := d.conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
-				return err
-			}
-			d.lastPing = time.Now()
-		}
+	watcher := marketwatch.New(*cfg)
+	if cfg.BlacklistPath != "" || cfg.WatchlistPath != "" {
+		go reloadOnHangup(ctx, watcher, cfg, logger)
 	}
-}
-
-func main() {
-	logger, err := createLogger()
-	if err != nil {
-		log.Fatal("Logger creation failed:", err)
+	if err := watcher.Run(ctx); err != nil {
+		logger.Error("Watcher failed", "err", err)
+		serviceStopped()
+		logFile.Close()
+		os.Exit(1)
 	}
+	logger.Info("Shutdown complete")
+	serviceStopped()
 
-	watcher := &DotaMarketWatcher{logger: logger}
-
-	for {
-		if err := watcher.Initialize(); err != nil {
-			if watcher.retries >= MaxRetries {
-				logger.Fatal("Max retries reached")
-			}
-			watcher.retries++
-			logger.Printf("Reconnecting %d/%d\n", watcher.retries, MaxRetries)
-			time.Sleep(ReconnectDelay)
-			continue
-		}
-
-		if err := watcher.Listen(); err != nil {
-			logger.Printf("Listen error: %v", err)
-			watcher.conn.Close()
-			if watcher.retries >= MaxRetries {
-				logger.Fatal("Max retries reached")
-			}
-			watcher.retries++
-			time.Sleep(ReconnectDelay)
-		}
+	if cfg.RunDuration > 0 && watcher.Stats().Matched == 0 {
+		logFile.Close()
+		os.Exit(ExitNoItems)
 	}
 }
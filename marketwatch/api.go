@@ -0,0 +1,242 @@
+package marketwatch
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RingSize        = 500
+	DefaultAPILimit = 100
+	MaxConfigBody   = 64 << 10
+)
+
+// itemRing keeps the most recent items in a fixed-size circular buffer.
+type itemRing struct {
+	mu    sync.Mutex
+	items []*Item
+	next  int
+	full  bool
+}
+
+func newItemRing(size int) *itemRing {
+	return &itemRing{items: make([]*Item, size)}
+}
+
+func (r *itemRing) Add(item *Item) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.next] = item
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Latest returns up to limit items, newest first, whose market name contains
+// name (case-insensitive) when name is not empty.
+func (r *itemRing) Latest(limit int, name string) []*Item {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.items)
+	}
+	name = strings.ToLower(name)
+
+	result := make([]*Item, 0, min(limit, count))
+	for i := 0; i < count && len(result) < limit; i++ {
+		idx := (r.next - 1 - i + len(r.items)) % len(r.items)
+		item := r.items[idx]
+		if name != "" && !strings.Contains(strings.ToLower(item.MarketName), name) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+type marketHealth struct {
+	Name         string     `json:"name"`
+	Connected    bool       `json:"connected"`
+	State        string     `json:"state"`
+	LastMessage  *time.Time `json:"last_message,omitempty"`
+	TokenBreaker string     `json:"token_breaker,omitempty"`
+}
+
+//go:embed web/index.html
+var dashboardHTML []byte
+
+type apiServer struct {
+	ring     *itemRing
+	stream   *streamHub
+	watchers []*MarketWatcher
+	stats    *Stats
+	filters  *liveFilters
+	listings *listingRate
+	logger   *slog.Logger
+}
+
+// handler serves the read-only API; /config only shows the filters.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", s.handleItems)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/stream", s.handleStream)
+	mux.HandleFunc("/config", s.handleConfig)
+	mux.HandleFunc("/", s.handleDashboard)
+	return mux
+}
+
+// controlHandler serves -control-addr, where the filters can be changed.
+func (s *apiServer) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", s.handleConfigUpdate)
+	return mux
+}
+
+func (s *apiServer) handleItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := DefaultAPILimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, http.StatusOK, s.ring.Latest(limit, r.URL.Query().Get("name")))
+}
+
+func (s *apiServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status, code := "ok", http.StatusOK
+	markets := make([]marketHealth, 0, len(s.watchers))
+	anyConnected := false
+	for _, watcher := range s.watchers {
+		state := watcher.State()
+		health := marketHealth{Name: watcher.name, Connected: state == StateSubscribed, State: state.String()}
+		if last := watcher.lastMessage.Load(); last != 0 {
+			t := time.Unix(0, last).UTC()
+			health.LastMessage = &t
+		}
+		if watcher.breaker != nil {
+			health.TokenBreaker = watcher.breaker.State().String()
+		}
+		anyConnected = anyConnected || health.Connected
+		markets = append(markets, health)
+	}
+	if !anyConnected {
+		status, code = "disconnected", http.StatusServiceUnavailable
+	}
+
+	body := map[string]interface{}{"status": status, "markets": markets}
+	if s.listings != nil {
+		body["listing_rate"] = s.listings.Rate()
+	}
+	writeJSON(w, code, body)
+}
+
+func (s *apiServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+// handleConfig serves the live filter settings.
+func (s *apiServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed, filters are changed on -control-addr", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.filters.Settings())
+}
+
+// handleConfigUpdate is handleConfig with POST, which takes a JSON object
+// with any of the FilterSettings fields; fields left out keep their value.
+func (s *apiServer) handleConfigUpdate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.filters.Settings())
+	case http.MethodPost:
+		settings := s.filters.Settings()
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxConfigBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&settings); err != nil {
+			http.Error(w, "invalid settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.filters.Update(settings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Info("Filters updated", "event", "config_update", "settings", settings)
+		writeJSON(w, http.StatusOK, settings)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *apiServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.stats.Snapshot())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func serveAPI(ctx context.Context, addr string, api *apiServer, logger *slog.Logger) {
+	logger.Info("Serving HTTP API", "addr", addr)
+	if err := serveHTTP(ctx, addr, api.handler()); err != nil {
+		logger.Error("HTTP API server failed", "err", err)
+	}
+}
+
+func serveControl(ctx context.Context, addr string, api *apiServer, logger *slog.Logger) {
+	logger.Info("Serving filter control", "addr", addr)
+	if err := serveHTTP(ctx, addr, api.controlHandler()); err != nil {
+		logger.Error("Control server failed", "err", err)
+	}
+}
+
+// serveHTTP serves handler on addr until ctx is cancelled. Requests run
+// on ctx, so /stream clients are let go on shutdown instead of holding
+// Shutdown up for the whole CloseTimeout.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), CloseTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
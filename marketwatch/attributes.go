@@ -0,0 +1,84 @@
+package marketwatch
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Item attributes: extra properties some skins carry, such as a Doppler
+// phase or a fade percentage. They are read best-effort: not every feed
+// sends them, and a missing or unreadable one is simply left out.
+const (
+	AttrPhase = "phase"
+	AttrFade  = "fade"
+	AttrBlue  = "blue"
+)
+
+// attributeFields lists the feed fields each attribute is read from, in
+// order of preference. Numeric attributes are percentages; a trailing %
+// is accepted.
+var attributeFields = []struct {
+	name    string
+	keys    []string
+	numeric bool
+}{
+	{AttrPhase, []string{"phase", "i_phase", "ui_phase"}, false},
+	{AttrFade, []string{"fade", "fade_percentage", "ui_fade"}, true},
+	{AttrBlue, []string{"blue", "blue_percentage", "ui_blue"}, true},
+}
+
+// dopplerPhase finds a Doppler phase in the market name of feeds that put
+// it there, e.g. "★ Karambit | Doppler (Factory New) - Phase 2".
+var dopplerPhase = regexp.MustCompile(`(?i)\b(phase [1-4]|ruby|sapphire|black pearl|emerald)\b`)
+
+func parseAttributes(data map[string]interface{}, name string) map[string]string {
+	attrs := make(map[string]string)
+	for _, field := range attributeFields {
+		for _, key := range field.keys {
+			value := strings.TrimSpace(getValue(data, key))
+			if value == "" || value == "<nil>" {
+				continue
+			}
+			if field.numeric {
+				n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+				if err != nil {
+					continue
+				}
+				value = strconv.FormatFloat(n, 'f', -1, 64)
+			}
+			attrs[field.name] = value
+			break
+		}
+	}
+	if _, ok := attrs[AttrPhase]; !ok && strings.Contains(strings.ToLower(name), "doppler") {
+		if phase := dopplerPhase.FindString(name); phase != "" {
+			attrs[AttrPhase] = phase
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+// stringAttr and numberAttr are the getters for expression filter fields
+// naming an attribute.
+func stringAttr(name string) func(*Item) interface{} {
+	return func(i *Item) interface{} {
+		if v, ok := i.Attributes[name]; ok {
+			return v
+		}
+		return nil
+	}
+}
+
+func numberAttr(name string) func(*Item) interface{} {
+	return func(i *Item) interface{} {
+		n, err := strconv.ParseFloat(i.Attributes[name], 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	}
+}
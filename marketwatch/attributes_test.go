@@ -0,0 +1,118 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    map[string]string
+	}{
+		{
+			name:    "doppler field",
+			payload: `{"i_market_name": "★ Karambit | Doppler (Factory New)", "ui_price": "900", "phase": "Phase 2"}`,
+			want:    map[string]string{AttrPhase: "Phase 2"},
+		},
+		{
+			name:    "doppler phase in the name",
+			payload: `{"i_market_name": "★ Karambit | Doppler (Factory New) - Phase 4", "ui_price": "900"}`,
+			want:    map[string]string{AttrPhase: "Phase 4"},
+		},
+		{
+			name:    "gamma doppler gem",
+			payload: `{"i_market_name": "★ Butterfly Knife | Gamma Doppler (Factory New) - Emerald", "ui_price": "9000"}`,
+			want:    map[string]string{AttrPhase: "Emerald"},
+		},
+		{
+			name:    "field beats the name",
+			payload: `{"i_market_name": "★ M9 Bayonet | Doppler (Factory New) - Phase 1", "ui_price": "900", "i_phase": "Ruby"}`,
+			want:    map[string]string{AttrPhase: "Ruby"},
+		},
+		{
+			name:    "fade percentage",
+			payload: `{"i_market_name": "★ Karambit | Fade (Factory New)", "ui_price": "1500", "fade_percentage": "97.5%"}`,
+			want:    map[string]string{AttrFade: "97.5"},
+		},
+		{
+			name:    "fade as a number, blue from the fallback key",
+			payload: `{"i_market_name": "AK-47 | Case Hardened (Field-Tested)", "ui_price": "150", "ui_fade": 100, "ui_blue": "61.20"}`,
+			want:    map[string]string{AttrFade: "100", AttrBlue: "61.2"},
+		},
+		{
+			name:    "unreadable fade is skipped",
+			payload: `{"i_market_name": "★ Karambit | Fade (Factory New)", "ui_price": "1500", "fade": "high", "ui_fade": "90"}`,
+			want:    map[string]string{AttrFade: "90"},
+		},
+		{
+			name:    "phase outside a doppler name",
+			payload: `{"i_market_name": "Operation Phase 2 Case", "ui_price": "1"}`,
+		},
+		{
+			name:    "none",
+			payload: `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "phase": "", "fade": null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := parsePayload(t, "csgo", tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(item.Attributes, tt.want) || (tt.want == nil) != (item.Attributes == nil) {
+				t.Errorf("attributes %v, want %v", item.Attributes, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttributeFilter(t *testing.T) {
+	doppler := &Item{MarketName: "★ Karambit | Doppler (Factory New)", Attributes: map[string]string{AttrPhase: "Phase 2"}}
+	fade := &Item{MarketName: "★ Karambit | Fade (Factory New)", Attributes: map[string]string{AttrFade: "97.5"}}
+	plain := &Item{MarketName: "AK-47 | Redline (Field-Tested)"}
+	tests := []struct {
+		expr                 string
+		doppler, fade, plain bool
+	}{
+		{`phase == "phase 2"`, true, false, false},
+		{`phase contains "phase"`, true, false, false},
+		{`fade >= 95`, false, true, false},
+		{`fade < 95`, false, false, false},
+		{`!(fade >= 95)`, true, false, true},
+		{`phase == "Phase 2" || fade > 90`, true, true, false},
+		{`blue > 0`, false, false, false},
+	}
+	for _, tt := range tests {
+		f, err := compileFilter(tt.expr)
+		if err != nil {
+			t.Errorf("compileFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		for _, c := range []struct {
+			item *Item
+			want bool
+		}{{doppler, tt.doppler}, {fade, tt.fade}, {plain, tt.plain}} {
+			if got := f.Match(c.item); got != c.want {
+				t.Errorf("%s on %s = %v, want %v", tt.expr, c.item.MarketName, got, c.want)
+			}
+		}
+	}
+}
+
+func TestAttributesInOutput(t *testing.T) {
+	item, err := parsePayload(t, "csgo", `{"i_market_name": "★ Karambit | Fade (Factory New)", "ui_price": "1500", "fade": "97.5"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct{ Attributes map[string]string }
+	if err := json.Unmarshal(out, &decoded); err != nil || decoded.Attributes[AttrFade] != "97.5" {
+		t.Errorf("JSON %s does not carry the fade attribute", out)
+	}
+}
@@ -0,0 +1,81 @@
+package marketwatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	BackfillTimeout = 30 * time.Second
+	// BackfillChannel is the Channel of items recovered by backfill.
+	BackfillChannel = "backfill"
+)
+
+func (m MarketConfig) historyRequestURL(apiKey string, since time.Time) string {
+	return fmt.Sprintf("%s?key=%s&since=%d", m.HistoryURL, url.QueryEscape(apiKey), since.Unix())
+}
+
+// backfill asks the market's history endpoint for items listed since the
+// last one this watcher processed and runs them through the usual item
+// pipeline, so dedup drops the ones already seen before the drop. It runs
+// before Listen starts reading; frames arriving meanwhile wait in the
+// socket. The first connection has nothing to catch up on.
+func (d *MarketWatcher) backfill(ctx context.Context) {
+	last := d.lastItem.Load()
+	if d.market.HistoryURL == "" || last == 0 {
+		return
+	}
+	since := time.Unix(0, last)
+
+	items, err := d.fetchHistory(ctx, since)
+	if err != nil {
+		d.logger.Error("Backfill failed", "since", since, "err", err)
+		return
+	}
+	for _, payload := range items {
+		d.handleNewItem(BackfillChannel, payload)
+	}
+	d.logger.Info("Backfill finished", "event", "backfill", "since", since, "items", len(items))
+}
+
+func (d *MarketWatcher) fetchHistory(ctx context.Context, since time.Time) ([]json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, BackfillTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.market.historyRequestURL(d.apiKey, since), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("history endpoint returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// Items have the same fields as the newitems_go payloads.
+	var data struct {
+		Success bool              `json:"success"`
+		Error   string            `json:"error"`
+		Items   []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	if !data.Success {
+		return nil, errors.New("history request rejected: " + data.Error)
+	}
+	return data.Items, nil
+}
@@ -0,0 +1,102 @@
+package marketwatch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BandwidthWindow is how many one-second samples the rolling message rate
+// is averaged over.
+const BandwidthWindow = 60
+
+// bandwidthMeter counts what the read loops receive. record is called for
+// every frame from every watcher, so it only touches atomics; Run samples
+// the counters once a second to derive the rolling and peak rates.
+type bandwidthMeter struct {
+	bytes    atomic.Int64
+	messages atomic.Int64
+
+	mu        sync.Mutex
+	samples   [BandwidthWindow]int64
+	pos       int
+	filled    int
+	lastBytes int64
+	lastCount int64
+	peak      int64
+
+	metrics *metrics
+}
+
+type BandwidthSnapshot struct {
+	Bytes    int64   `json:"bytes"`
+	Messages int64   `json:"messages"`
+	Rate     float64 `json:"rate"`
+	PeakRate int64   `json:"peak_rate"`
+}
+
+func newBandwidthMeter(m *metrics) *bandwidthMeter {
+	return &bandwidthMeter{metrics: m}
+}
+
+func (b *bandwidthMeter) record(n int) {
+	b.bytes.Add(int64(n))
+	b.messages.Add(1)
+}
+
+func (b *bandwidthMeter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.sample()
+		}
+	}
+}
+
+func (b *bandwidthMeter) sample() {
+	bytes, count := b.bytes.Load(), b.messages.Load()
+
+	b.mu.Lock()
+	delta := count - b.lastCount
+	b.metrics.bytesReceived.Add(float64(bytes - b.lastBytes))
+	b.lastBytes, b.lastCount = bytes, count
+	b.samples[b.pos] = delta
+	b.pos = (b.pos + 1) % BandwidthWindow
+	if b.filled < BandwidthWindow {
+		b.filled++
+	}
+	b.peak = max(b.peak, delta)
+	rate, peak := b.rate(), b.peak
+	b.mu.Unlock()
+
+	b.metrics.messageRate.Set(rate)
+	b.metrics.messagePeakRate.Set(float64(peak))
+}
+
+// rate is the mean messages per second over the filled part of the window.
+func (b *bandwidthMeter) rate() float64 {
+	if b.filled == 0 {
+		return 0
+	}
+	var total int64
+	for _, n := range b.samples[:b.filled] {
+		total += n
+	}
+	return float64(total) / float64(b.filled)
+}
+
+func (b *bandwidthMeter) Snapshot() BandwidthSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BandwidthSnapshot{
+		Bytes:    b.bytes.Load(),
+		Messages: b.messages.Load(),
+		Rate:     b.rate(),
+		PeakRate: b.peak,
+	}
+}
@@ -0,0 +1,92 @@
+package marketwatch
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// blacklist mutes items for good, unlike dedup which forgets them after
+// its window. The file lists one entry per line: an item id (see Item.ID),
+// an inspect URL, or a market name, matched case-insensitively. Blank
+// lines and lines starting with # are ignored.
+type blacklist struct {
+	path string
+
+	mu      sync.RWMutex
+	ids     map[string]bool
+	inspect map[string]bool
+	names   map[string]bool
+}
+
+func newBlacklist(path string) *blacklist {
+	return &blacklist{path: path}
+}
+
+// Load reads the file and replaces the entries. On error the previous
+// entries stay in use.
+func (b *blacklist) Load() error {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ids, inspect, names := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(entry, "steam://"):
+			if strings.ContainsAny(entry, " \t") {
+				return fmt.Errorf("%s:%d: inspect URL contains spaces", b.path, line)
+			}
+			inspect[entry] = true
+		case isItemID(entry):
+			ids[strings.ToLower(entry)] = true
+		default:
+			names[strings.ToLower(entry)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", b.path, err)
+	}
+
+	b.mu.Lock()
+	b.ids, b.inspect, b.names = ids, inspect, names
+	b.mu.Unlock()
+	return nil
+}
+
+func isItemID(s string) bool {
+	if len(s) != IDLength {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Len is the number of entries.
+func (b *blacklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.ids) + len(b.inspect) + len(b.names)
+}
+
+func (b *blacklist) Contains(item *Item) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if item.InspectURL != "" && b.inspect[item.InspectURL] {
+		return true
+	}
+	if b.names[strings.ToLower(item.MarketName)] {
+		return true
+	}
+	return len(b.ids) > 0 && b.ids[item.ID()]
+}
@@ -0,0 +1,104 @@
+package marketwatch
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const mutedInspect = "steam://rungame/730/76561202255233023/+csgo_econ_action_preview%20M4108481252793458462A29194971250D1156893335530217395"
+
+func TestBlacklistLoad(t *testing.T) {
+	muted := &Item{MarketName: "AWP | Asiimov (Field-Tested)", Price: 45.1, Float: floatPtr(0.2711)}
+	tests := []struct {
+		name    string
+		file    string
+		entries int
+		items   map[*Item]bool
+		wantErr string
+	}{
+		{
+			name:    "names, links and ids",
+			file:    "# muted for testing\n\n  sticker | tyloo  \n" + mutedInspect + "\n" + strings.ToUpper(muted.ID()) + "\n",
+			entries: 3,
+			items: map[*Item]bool{
+				{MarketName: "Sticker | Tyloo"}:                                          true,
+				{MarketName: "AK-47 | Redline (Field-Tested)", InspectURL: mutedInspect}: true,
+				muted: true,
+				{MarketName: "AWP | Asiimov (Field-Tested)", Price: 46}: false,
+				{MarketName: "Sticker | Tyloo (Holo)"}:                  false,
+			},
+		},
+		{name: "comments only", file: "# nothing yet\n", items: map[*Item]bool{{MarketName: "Sticker | Tyloo"}: false}},
+		{name: "link with spaces", file: "Sticker | Tyloo\nsteam://rungame/730/1/+csgo_econ_action_preview M1A2D3\n", wantErr: "blacklist.txt:2: inspect URL contains spaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBlacklist(writeFile(t, "blacklist.txt", tt.file))
+			err := b.Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Len() != tt.entries {
+				t.Errorf("%d entries, want %d", b.Len(), tt.entries)
+			}
+			for item, want := range tt.items {
+				if got := b.Contains(item); got != want {
+					t.Errorf("Contains(%s at %g) = %v, want %v", item.MarketName, item.Price, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWatcherBlacklistReload(t *testing.T) {
+	path := writeFile(t, "blacklist.txt", "Sticker | Tyloo\n")
+	cfg := DefaultConfig()
+	cfg.BlacklistPath = path
+	cfg.Logger = testLogger
+	w := New(*cfg)
+	if err := w.ReloadBlacklist(); err != nil {
+		t.Fatal(err)
+	}
+	d, items := newTestWatcher(t, nil, nil)
+	d.blacklist = w.blacklist
+	tyloo := feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`)
+	bravo := feedFrame("newitems_go", `{"i_market_name": "Operation Bravo Case", "ui_price": "1.5"}`)
+
+	d.processMessage(tyloo)
+	d.processMessage(bravo)
+	if item := nextItem(t, items); item.MarketName != "Operation Bravo Case" {
+		t.Errorf("emitted %q, want the case", item.MarketName)
+	}
+	noItem(t, items)
+
+	if err := os.WriteFile(path, []byte("Sticker | Tyloo\nOperation Bravo Case\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ReloadBlacklist(); err != nil {
+		t.Fatal(err)
+	}
+	d.processMessage(tyloo)
+	d.processMessage(bravo)
+	noItem(t, items)
+
+	// A broken file keeps the entries in use.
+	if err := os.WriteFile(path, []byte("steam://rungame/730/1/+csgo_econ_action_preview M1 A2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ReloadBlacklist(); err == nil {
+		t.Error("reloaded a broken file")
+	}
+	if w.blacklist.Len() != 2 {
+		t.Errorf("%d entries after a failed reload, want 2", w.blacklist.Len())
+	}
+	if err := New(*DefaultConfig()).ReloadBlacklist(); err == nil {
+		t.Error("reloaded without a blacklist file")
+	}
+}
@@ -0,0 +1,112 @@
+package marketwatch
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DedupBloomCapacity = 100000
+	DedupBloomFPRate   = 0.001
+)
+
+// bloomFilter is a fixed-size bit set probed at k positions per key, found
+// by double hashing the two halves of a 128-bit FNV hash.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloomFilter sizes a filter for n keys at false positive rate p:
+// m = -n ln p / (ln 2)^2 bits and k = m/n ln 2 probes.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: max(k, 1)}
+}
+
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	return h1, h2 | 1
+}
+
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) has(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) reset() {
+	clear(f.bits)
+}
+
+// rotatingBloom approximates dedupCache in fixed memory. Keys go into the
+// current filter; every window the previous filter is cleared and becomes
+// the current one. A key is remembered for between one and two windows,
+// and with some probability a key never seen is reported as seen.
+type rotatingBloom struct {
+	mu        sync.Mutex
+	window    time.Duration
+	current   *bloomFilter
+	previous  *bloomFilter
+	rotatedAt time.Time
+	now       func() time.Time
+}
+
+// newRotatingBloom sizes each filter for capacity keys per window.
+func newRotatingBloom(window time.Duration, capacity int, fpRate float64) *rotatingBloom {
+	b := &rotatingBloom{
+		window:   window,
+		current:  newBloomFilter(capacity, fpRate),
+		previous: newBloomFilter(capacity, fpRate),
+		now:      time.Now,
+	}
+	b.rotatedAt = b.now()
+	return b
+}
+
+func (b *rotatingBloom) Seen(key string) bool {
+	h1, h2 := bloomHash(key)
+	now := b.now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.rotatedAt); elapsed >= b.window {
+		b.previous.reset()
+		b.current, b.previous = b.previous, b.current
+		// After two idle windows nothing is recent any more.
+		if elapsed >= 2*b.window {
+			b.previous.reset()
+		}
+		b.rotatedAt = now
+	}
+	// Like dedupCache, a repeat does not extend the key's lifetime.
+	if b.current.has(h1, h2) || b.previous.has(h1, h2) {
+		return true
+	}
+	b.current.add(h1, h2)
+	return false
+}
@@ -0,0 +1,111 @@
+package marketwatch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewBloomFilterSizing(t *testing.T) {
+	tests := []struct {
+		n    int
+		p    float64
+		m, k uint64
+	}{
+		{1000, 0.01, 9586, 7},
+		{100000, 0.001, 1437759, 10},
+		{1, 0.5, 64, 44},
+	}
+	for _, tt := range tests {
+		f := newBloomFilter(tt.n, tt.p)
+		if f.m != tt.m || f.k != tt.k || len(f.bits) != int((tt.m+63)/64) {
+			t.Errorf("newBloomFilter(%d, %g) = %d bits, %d probes; want %d and %d", tt.n, tt.p, f.m, f.k, tt.m, tt.k)
+		}
+	}
+}
+
+func TestBloomFilterFalsePositives(t *testing.T) {
+	const n, p = 10000, 0.01
+	f := newBloomFilter(n, p)
+	for i := 0; i < n; i++ {
+		f.add(bloomHash(fmt.Sprintf("listing-%d", i)))
+	}
+	for i := 0; i < n; i++ {
+		if !f.has(bloomHash(fmt.Sprintf("listing-%d", i))) {
+			t.Fatalf("listing-%d added but not found", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.has(bloomHash(fmt.Sprintf("other-%d", i))) {
+			falsePositives++
+		}
+	}
+	// Allow twice the configured rate for sampling noise.
+	if rate := float64(falsePositives) / n; rate > 2*p {
+		t.Errorf("false positive rate %g at capacity, want about %g", rate, p)
+	}
+	f.reset()
+	if f.has(bloomHash("listing-0")) {
+		t.Error("key found after reset")
+	}
+}
+
+func TestRotatingBloomRotation(t *testing.T) {
+	clock := newFakeClock()
+	b := newRotatingBloom(time.Minute, 1000, 0.001)
+	b.now = clock.Now
+	b.rotatedAt = clock.Now()
+
+	steps := []struct {
+		advance time.Duration
+		key     string
+		want    bool
+	}{
+		{0, "a", false},
+		{0, "a", true},
+		{30 * time.Second, "b", false},
+		// The first rotation moves a and b to the previous filter.
+		{30 * time.Second, "a", true},
+		{0, "c", false},
+		{59 * time.Second, "b", true},
+		// The second drops a and b, and keeps c, added after the first.
+		{time.Second, "a", false},
+		{0, "b", false},
+		{0, "c", true},
+		// Two idle windows forget everything.
+		{2 * time.Minute, "a", false},
+		{0, "c", false},
+		{0, "a", true},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		if got := b.Seen(s.key); got != s.want {
+			t.Errorf("step %d: Seen(%q) = %v, want %v", i, s.key, got, s.want)
+		}
+	}
+}
+
+func TestRotatingBloomKnownSet(t *testing.T) {
+	const n, p = 5000, 0.001
+	clock := newFakeClock()
+	b := newRotatingBloom(time.Minute, n, p)
+	b.now = clock.Now
+	b.rotatedAt = clock.Now()
+
+	collisions := 0
+	for i := 0; i < n; i++ {
+		if b.Seen(fmt.Sprintf("listing-%d", i)) {
+			collisions++
+		}
+	}
+	if collisions > 10*n*p {
+		t.Errorf("%d of %d new keys reported as seen", collisions, n)
+	}
+	clock.Advance(90 * time.Second)
+	for i := 0; i < n; i++ {
+		if !b.Seen(fmt.Sprintf("listing-%d", i)) {
+			t.Fatalf("listing-%d forgotten one rotation later", i)
+		}
+	}
+}
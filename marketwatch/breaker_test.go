@@ -0,0 +1,114 @@
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a time source for the components taking a now func.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	clock := newFakeClock()
+	b := newCircuitBreaker(3, time.Minute)
+	b.now = clock.Now
+	fail := errors.New("token endpoint down")
+
+	step := func(desc string, want breakerState) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("%s: state %s, want %s", desc, got, want)
+		}
+	}
+	call := func(err error) error {
+		t.Helper()
+		if allowErr := b.Allow(); allowErr != nil {
+			return allowErr
+		}
+		b.Record(err)
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		call(fail)
+	}
+	step("below the threshold", breakerClosed)
+	call(nil)
+	call(fail)
+	call(fail)
+	step("success resets the count", breakerClosed)
+	call(fail)
+	step("threshold reached", breakerOpen)
+	if err := call(nil); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("open breaker allowed a call: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	step("after the cooldown", breakerHalfOpen)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("half-open breaker refused the trial: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, errBreakerOpen) {
+		t.Fatal("half-open breaker allowed a second call during the trial")
+	}
+	b.Record(fail)
+	step("failed trial", breakerOpen)
+
+	clock.Advance(59 * time.Second)
+	step("failed trial restarts the cooldown", breakerOpen)
+	clock.Advance(time.Second)
+	if err := call(nil); err != nil {
+		t.Fatalf("trial refused: %v", err)
+	}
+	step("successful trial", breakerClosed)
+	call(fail)
+	step("one failure after recovery", breakerClosed)
+}
+
+func TestUpdateTokenBreakerFailsFast(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.BreakerThreshold = 2
+	d, _ := newTestWatcher(t, nil, cfg)
+	d.market.TokenURL = srv.URL
+	for i := 0; i < 5; i++ {
+		err := d.UpdateToken(context.Background())
+		if i >= 2 && !errors.Is(err, errBreakerOpen) {
+			t.Errorf("request %d: err = %v, want the breaker open", i+1, err)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("token endpoint hit %d times, want 2", n)
+	}
+}
@@ -0,0 +1,64 @@
+package marketwatch
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ReconnectBudget       = 60
+	ReconnectBudgetWindow = time.Hour
+	ReconnectCooldown     = 30 * time.Minute
+)
+
+// reconnectBudget caps reconnects at limit per rolling window. Backoff
+// alone does not stop a connection that keeps dropping right after it
+// recovers from reconnecting every few seconds for hours, and that kind of
+// churn can get the API key banned.
+type reconnectBudget struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	now    func() time.Time
+	times  []time.Time // oldest first
+}
+
+func newReconnectBudget(limit int, window time.Duration) *reconnectBudget {
+	return &reconnectBudget{limit: limit, window: window, now: time.Now}
+}
+
+// Spend records a reconnect and reports whether it fits the budget. One
+// that does not is still recorded: the budget is exhausted until enough
+// reconnects have left the window.
+func (b *reconnectBudget) Spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.expire(now)
+	b.times = append(b.times, now)
+	return len(b.times) <= b.limit
+}
+
+// Reset starts the budget over, after a cool-down.
+func (b *reconnectBudget) Reset() {
+	b.mu.Lock()
+	b.times = b.times[:0]
+	b.mu.Unlock()
+}
+
+// Used is the number of reconnects in the current window.
+func (b *reconnectBudget) Used() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(b.now())
+	return len(b.times)
+}
+
+func (b *reconnectBudget) expire(now time.Time) {
+	cutoff := now.Add(-b.window)
+	i := 0
+	for i < len(b.times) && !b.times[i].After(cutoff) {
+		i++
+	}
+	b.times = append(b.times[:0], b.times[i:]...)
+}
@@ -0,0 +1,89 @@
+package marketwatch
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectBudget(t *testing.T) {
+	clock := newFakeClock()
+	b := newReconnectBudget(3, time.Hour)
+	b.now = clock.Now
+
+	steps := []struct {
+		advance time.Duration
+		want    bool
+		used    int
+	}{
+		{0, true, 1},
+		{10 * time.Minute, true, 2},
+		{10 * time.Minute, true, 3},
+		{10 * time.Minute, false, 4},
+		// 59 minutes on, the first reconnect is still in the window.
+		{29 * time.Minute, false, 5},
+		// At exactly an hour it leaves, but the refused ones still count.
+		{time.Minute, false, 5},
+		{35 * time.Minute, true, 3},
+		{10 * time.Minute, false, 4},
+		{2 * time.Hour, true, 1},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		if got := b.Spend(); got != s.want {
+			t.Errorf("step %d: Spend() = %v, want %v", i, got, s.want)
+		}
+		if got := b.Used(); got != s.used {
+			t.Errorf("step %d: Used() = %d, want %d", i, got, s.used)
+		}
+	}
+	b.Reset()
+	if b.Used() != 0 || !b.Spend() {
+		t.Error("Reset did not start the budget over")
+	}
+}
+
+func TestSpendReconnectCoolsDown(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ReconnectCooldown = Duration(100 * time.Millisecond)
+	d, _ := newTestWatcher(t, nil, cfg)
+	d.budget = newReconnectBudget(2, time.Hour)
+	var log strings.Builder
+	d.logger = slog.New(slog.NewTextHandler(&log, nil))
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		d.spendReconnect(context.Background())
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Fatalf("reconnect %d within the budget waited %s", i+1, elapsed)
+		}
+	}
+	if log.Len() > 0 {
+		t.Errorf("logged %q within the budget", log.String())
+	}
+
+	start := time.Now()
+	d.spendReconnect(context.Background())
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("cool-down lasted %s, want 100ms", elapsed)
+	}
+	if !strings.Contains(log.String(), "level=ERROR") || !strings.Contains(log.String(), "event=reconnect_budget reconnects=3") {
+		t.Errorf("log %q does not report the spent budget", log.String())
+	}
+	if d.budget.Used() != 0 {
+		t.Errorf("%d reconnects after the cool-down, want the budget reset", d.budget.Used())
+	}
+
+	// Shutdown does not wait out a cool-down.
+	cfg.ReconnectCooldown = Duration(time.Hour)
+	d.budget = newReconnectBudget(0, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	d.spendReconnect(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled cool-down lasted %s", elapsed)
+	}
+}
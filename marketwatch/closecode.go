@@ -0,0 +1,90 @@
+package marketwatch
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// How Run recovers from a closed connection.
+const (
+	// RecoverQuick reconnects after the initial backoff: the server closed
+	// cleanly or is restarting, so nothing is wrong on our side.
+	RecoverQuick = "quick"
+	// RecoverRefresh fetches a new token before reconnecting.
+	RecoverRefresh = "refresh"
+	// RecoverBackoff is the usual exponential backoff.
+	RecoverBackoff = "backoff"
+)
+
+// defaultCloseRecovery classifies the standard close codes; anything not
+// listed, including 1006 for a dropped connection, backs off. 4001 and 4003
+// are the application codes servers commonly use for a revoked token.
+var defaultCloseRecovery = map[int]string{
+	websocket.CloseNormalClosure:     RecoverQuick,
+	websocket.CloseGoingAway:         RecoverQuick,
+	websocket.CloseServiceRestart:    RecoverQuick,
+	websocket.CloseTryAgainLater:     RecoverBackoff,
+	websocket.ClosePolicyViolation:   RecoverRefresh,
+	websocket.CloseInternalServerErr: RecoverBackoff,
+	4001:                             RecoverRefresh,
+	4003:                             RecoverRefresh,
+}
+
+// closeRecovery picks the recovery for an error returned by Listen. Codes
+// in overrides (-close-codes) take precedence over the defaults.
+func closeRecovery(err error, overrides map[int]string) (string, *websocket.CloseError) {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return RecoverBackoff, nil
+	}
+	if recovery, ok := overrides[closeErr.Code]; ok {
+		return recovery, closeErr
+	}
+	if recovery, ok := defaultCloseRecovery[closeErr.Code]; ok {
+		return recovery, closeErr
+	}
+	return RecoverBackoff, closeErr
+}
+
+func validRecovery(recovery string) bool {
+	return recovery == RecoverQuick || recovery == RecoverRefresh || recovery == RecoverBackoff
+}
+
+// closeCodes maps a WebSocket close code to the recovery for it, set as
+// "code=recovery" pairs separated by commas.
+type closeCodes map[int]string
+
+func (c *closeCodes) String() string {
+	parts := make([]string, 0, len(*c))
+	for code, recovery := range *c {
+		parts = append(parts, strconv.Itoa(code)+"="+recovery)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (c *closeCodes) Set(value string) error {
+	codes := make(closeCodes)
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		codeText, recovery, ok := strings.Cut(part, "=")
+		code, err := strconv.Atoi(strings.TrimSpace(codeText))
+		if !ok || err != nil {
+			return fmt.Errorf("invalid close code entry %q, want code=recovery", part)
+		}
+		recovery = strings.TrimSpace(recovery)
+		if !validRecovery(recovery) {
+			return fmt.Errorf("invalid recovery %q for close code %d, want quick|refresh|backoff", recovery, code)
+		}
+		codes[code] = recovery
+	}
+	*c = codes
+	return nil
+}
@@ -0,0 +1,125 @@
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeWith has the feed server close the connection with code, or drop it
+// without a close frame when code is 0.
+func closeWith(conn *websocket.Conn, code int) {
+	if code == 0 {
+		conn.Close()
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, fmt.Sprintf("closing with %d", code))
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+func TestCloseRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      int
+		overrides map[int]string
+		want      string
+		wantCode  int
+	}{
+		{name: "normal", code: websocket.CloseNormalClosure, want: RecoverQuick, wantCode: 1000},
+		{name: "going away", code: websocket.CloseGoingAway, want: RecoverQuick, wantCode: 1001},
+		{name: "service restart", code: websocket.CloseServiceRestart, want: RecoverQuick, wantCode: 1012},
+		{name: "policy violation", code: websocket.ClosePolicyViolation, want: RecoverRefresh, wantCode: 1008},
+		{name: "token revoked", code: 4001, want: RecoverRefresh, wantCode: 4001},
+		{name: "server error", code: websocket.CloseInternalServerErr, want: RecoverBackoff, wantCode: 1011},
+		{name: "unknown code", code: 4999, want: RecoverBackoff, wantCode: 4999},
+		{name: "override", code: 4999, overrides: map[int]string{4999: RecoverQuick}, want: RecoverQuick, wantCode: 4999},
+		{name: "override beats default", code: 1008, overrides: map[int]string{1008: RecoverBackoff}, want: RecoverBackoff, wantCode: 1008},
+		{name: "dropped", want: RecoverBackoff, wantCode: websocket.CloseAbnormalClosure},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFeedServer(t, func(_ int, conn *websocket.Conn) { closeWith(conn, tt.code) })
+			d, _ := newTestWatcher(t, srv, nil)
+			if err := d.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			err := d.Listen(context.Background())
+			recovery, closeErr := closeRecovery(err, tt.overrides)
+			if recovery != tt.want {
+				t.Errorf("recovery %s for %v, want %s", recovery, err, tt.want)
+			}
+			if closeErr == nil || closeErr.Code != tt.wantCode {
+				t.Errorf("close error %v, want code %d", closeErr, tt.wantCode)
+			}
+		})
+	}
+
+	if recovery, closeErr := closeRecovery(errors.New("read timeout"), nil); recovery != RecoverBackoff || closeErr != nil {
+		t.Errorf("recovery %s, %v for a non-close error, want backoff", recovery, closeErr)
+	}
+}
+
+func TestRunRefreshesTokenOnClose(t *testing.T) {
+	tests := []struct {
+		code   int
+		tokens int32
+	}{
+		{code: websocket.CloseNormalClosure, tokens: 1},
+		{code: 4001, tokens: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprint(tt.code), func(t *testing.T) {
+			srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+				if n == 1 {
+					closeWith(conn, tt.code)
+					return
+				}
+				sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`))
+			})
+			d, items := newTestWatcher(t, srv, nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- d.Run(ctx) }()
+			nextItem(t, items)
+			cancel()
+			<-done
+			if n := srv.tokens.Load(); n != tt.tokens {
+				t.Errorf("%d token requests, want %d", n, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestCloseCodesSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "4000=refresh, 1013=quick", want: "1013=quick,4000=refresh"},
+		{value: "", want: ""},
+		{value: "4000", wantErr: "want code=recovery"},
+		{value: "x=quick", wantErr: "want code=recovery"},
+		{value: "4000=later", wantErr: `invalid recovery "later"`},
+	}
+	for _, tt := range tests {
+		var codes closeCodes
+		err := codes.Set(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Set(%q) err = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || codes.String() != tt.want {
+			t.Errorf("Set(%q) = %s, %v; want %s", tt.value, codes.String(), err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,842 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const apiKeyPlaceholder = "YOUR_API_KEY"
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	// FormatJSONPretty writes the json events indented over several lines,
+	// which is no longer JSONL: one event is not one line.
+	FormatJSONPretty = "json-pretty"
+	PrettyJSONIndent = 2
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	PingModeText    = "text"
+	PingModeControl = "control"
+
+	LogRetention = 7 * 24 * time.Hour
+
+	ListingRateHysteresis = 10
+)
+
+type Config struct {
+	APIKey              string      `json:"api_key" yaml:"api_key"`
+	APIKeys             stringList  `json:"api_keys" yaml:"api_keys"`
+	Format              string      `json:"format" yaml:"format"`
+	JSONIndent          int         `json:"json_indent" yaml:"json_indent"`
+	Channels            stringList  `json:"channels" yaml:"channels"`
+	Debug               bool        `json:"debug" yaml:"debug"`
+	Verbose             bool        `json:"verbose" yaml:"verbose"`
+	Quiet               bool        `json:"quiet" yaml:"quiet"`
+	LogFormat           string      `json:"log_format" yaml:"log_format"`
+	LogLevel            string      `json:"log_level" yaml:"log_level"`
+	LogStdout           bool        `json:"log_stdout" yaml:"log_stdout"`
+	LogRetention        Duration    `json:"log_retention" yaml:"log_retention"`
+	LogMaxFiles         int         `json:"log_max_files" yaml:"log_max_files"`
+	LogTimezone         string      `json:"log_tz" yaml:"log_tz"`
+	LogTimeFormat       string      `json:"log_time_format" yaml:"log_time_format"`
+	Syslog              bool        `json:"syslog" yaml:"syslog"`
+	SyslogAddr          string      `json:"syslog_addr" yaml:"syslog_addr"`
+	MaxRetries          int         `json:"max_retries" yaml:"max_retries"`
+	Proxy               string      `json:"proxy" yaml:"proxy"`
+	CAFile              string      `json:"ca_file" yaml:"ca_file"`
+	PinSHA256           string      `json:"pin_sha256" yaml:"pin_sha256"`
+	UserAgent           string      `json:"user_agent" yaml:"user_agent"`
+	Origin              string      `json:"origin" yaml:"origin"`
+	Headers             headerMap   `json:"headers" yaml:"headers"`
+	WriteTimeout        Duration    `json:"write_timeout" yaml:"write_timeout"`
+	ReadTimeout         Duration    `json:"read_timeout" yaml:"read_timeout"`
+	IdleTimeout         Duration    `json:"idle_timeout" yaml:"idle_timeout"`
+	MaxMessageSize      int64       `json:"max_message_size" yaml:"max_message_size"`
+	CloseCodes          closeCodes  `json:"close_codes" yaml:"close_codes"`
+	WarmStandby         bool        `json:"warm_standby" yaml:"warm_standby"`
+	PingInterval        Duration    `json:"ping_interval" yaml:"ping_interval"`
+	PingMode            string      `json:"ping_mode" yaml:"ping_mode"`
+	Compression         bool        `json:"compression" yaml:"compression"`
+	Workers             int         `json:"workers" yaml:"workers"`
+	QueueSize           int         `json:"queue_size" yaml:"queue_size"`
+	QueueFull           string      `json:"queue_full" yaml:"queue_full"`
+	SubscribeTimeout    Duration    `json:"subscribe_timeout" yaml:"subscribe_timeout"`
+	TokenTimeout        Duration    `json:"token_timeout" yaml:"token_timeout"`
+	HTTPTimeout         Duration    `json:"http_timeout" yaml:"http_timeout"`
+	BreakerThreshold    int         `json:"token_breaker_threshold" yaml:"token_breaker_threshold"`
+	BreakerCooldown     Duration    `json:"token_breaker_cooldown" yaml:"token_breaker_cooldown"`
+	ReconnectBudget     int         `json:"reconnect_budget" yaml:"reconnect_budget"`
+	ReconnectCooldown   Duration    `json:"reconnect_cooldown" yaml:"reconnect_cooldown"`
+	MinPrice            float64     `json:"min_price" yaml:"min_price"`
+	MaxPrice            float64     `json:"max_price" yaml:"max_price"`
+	PriceFilter         priceFilter `json:"price_filter" yaml:"price_filter"`
+	StrictCurrency      bool        `json:"strict_currency" yaml:"strict_currency"`
+	Currencies          stringList  `json:"currencies" yaml:"currencies"`
+	MinFloat            float64     `json:"min_float" yaml:"min_float"`
+	MaxFloat            float64     `json:"max_float" yaml:"max_float"`
+	RequireFloat        bool        `json:"require_float" yaml:"require_float"`
+	RequireInspect      bool        `json:"require_inspect" yaml:"require_inspect"`
+	Filter              string      `json:"filter" yaml:"filter"`
+	BlacklistPath       string      `json:"blacklist_file" yaml:"blacklist_file"`
+	WatchlistPath       string      `json:"watchlist_file" yaml:"watchlist_file"`
+	WatchlistPriority   bool        `json:"watchlist_priority" yaml:"watchlist_priority"`
+	Include             stringList  `json:"include" yaml:"include"`
+	Exclude             stringList  `json:"exclude" yaml:"exclude"`
+	Qualities           stringList  `json:"qualities" yaml:"qualities"`
+	Seeds               intList     `json:"seeds" yaml:"seeds"`
+	BaseCurrency        string      `json:"base_currency" yaml:"base_currency"`
+	MinDiscount         float64     `json:"min_discount" yaml:"min_discount"`
+	DedupWindow         Duration    `json:"dedup_window" yaml:"dedup_window"`
+	DedupStrategy       string      `json:"dedup_strategy" yaml:"dedup_strategy"`
+	DedupCapacity       int         `json:"dedup_capacity" yaml:"dedup_capacity"`
+	DedupFPRate         float64     `json:"dedup_fp_rate" yaml:"dedup_fp_rate"`
+	PersistDedup        string      `json:"persist_dedup" yaml:"persist_dedup"`
+	PersistDedupTTL     Duration    `json:"persist_dedup_retention" yaml:"persist_dedup_retention"`
+	PerNameCooldown     Duration    `json:"per_name_cooldown" yaml:"per_name_cooldown"`
+	CooldownBypassPrice float64     `json:"cooldown_bypass_price" yaml:"cooldown_bypass_price"`
+	UndercutPct         float64     `json:"undercut_pct" yaml:"undercut_pct"`
+	FloorWindow         Duration    `json:"floor_window" yaml:"floor_window"`
+	PriceChanges        bool        `json:"price_changes" yaml:"price_changes"`
+	PriceChangeTTL      Duration    `json:"price_change_ttl" yaml:"price_change_ttl"`
+	FloatCheckURL       string      `json:"float_checker_url" yaml:"float_checker_url"`
+	FloatTimeout        Duration    `json:"float_checker_timeout" yaml:"float_checker_timeout"`
+	FloatConcurrency    int         `json:"float_checker_concurrency" yaml:"float_checker_concurrency"`
+	SampleRate          int         `json:"sample_rate" yaml:"sample_rate"`
+	RateLimit           float64     `json:"rate_limit" yaml:"rate_limit"`
+	DBPath              string      `json:"db" yaml:"db"`
+	PostgresDSN         string      `json:"pg_dsn" yaml:"pg_dsn"`
+	CSVPath             string      `json:"csv" yaml:"csv"`
+	CSVMaxSize          int64       `json:"csv_max_size" yaml:"csv_max_size"`
+	Fields              stringList  `json:"fields" yaml:"fields"`
+	ReplayPath          string      `json:"replay" yaml:"replay"`
+	ReplayRate          float64     `json:"replay_rate" yaml:"replay_rate"`
+	CapturePath         string      `json:"capture" yaml:"capture"`
+	ParseErrorsDir      string      `json:"parse_errors_dir" yaml:"parse_errors_dir"`
+	ParseErrorsMax      int         `json:"parse_errors_max" yaml:"parse_errors_max"`
+	MetricsAddr         string      `json:"metrics_addr" yaml:"metrics_addr"`
+	HTTPAddr            string      `json:"http_addr" yaml:"http_addr"`
+	ControlAddr         string      `json:"control_addr" yaml:"control_addr"`
+	RingSize            int         `json:"ring_size" yaml:"ring_size"`
+	StatsInterval       Duration    `json:"stats_interval" yaml:"stats_interval"`
+	RunDuration         Duration    `json:"duration" yaml:"duration"`
+	BandwidthStats      bool        `json:"bandwidth_stats" yaml:"bandwidth_stats"`
+	Backfill            bool        `json:"backfill" yaml:"backfill"`
+
+	ListingRateHigh       float64 `json:"listing_rate_high" yaml:"listing_rate_high"`
+	ListingRateLow        float64 `json:"listing_rate_low" yaml:"listing_rate_low"`
+	ListingRateHysteresis float64 `json:"listing_rate_hysteresis" yaml:"listing_rate_hysteresis"`
+
+	DiscordWebhook string     `json:"discord_webhook" yaml:"discord_webhook"`
+	TelegramToken  string     `json:"telegram_token" yaml:"telegram_token"`
+	TelegramChatID string     `json:"telegram_chat_id" yaml:"telegram_chat_id"`
+	TradeHookURLs  stringList `json:"trade_hook_urls" yaml:"trade_hook_urls"`
+	HookTimeout    Duration   `json:"hook_timeout" yaml:"hook_timeout"`
+	WebhookSecret  string     `json:"webhook_secret" yaml:"webhook_secret"`
+	NATSURL        string     `json:"nats_url" yaml:"nats_url"`
+	KafkaBrokers   stringList `json:"kafka_brokers" yaml:"kafka_brokers"`
+	Topic          string     `json:"topic" yaml:"topic"`
+
+	Markets     []MarketConfig `json:"markets" yaml:"markets"`
+	MarketNames stringList     `json:"-" yaml:"-"`
+	Game        string         `json:"game" yaml:"game"`
+
+	// Logger and Output are for programs embedding the watcher: logs go to
+	// Logger (slog.Default when nil) and with a JSON Format matching items
+	// are written to Output, or nowhere when it is nil.
+	Logger *slog.Logger `json:"-" yaml:"-"`
+	Output io.Writer    `json:"-" yaml:"-"`
+
+	// OnReady is called once, on the first message any market receives
+	// after subscribing, and OnAlive on every message and pong after that:
+	// the command reports them to systemd as READY and WATCHDOG.
+	OnReady func() `json:"-" yaml:"-"`
+	OnAlive func() `json:"-" yaml:"-"`
+}
+
+// Duration is a time.Duration that reads as "30s"-style strings from flags
+// and config files. A bare "d" suffix is accepted for days, e.g. "7d".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*d = Duration(n * float64(24*time.Hour))
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+type intList []int
+
+func (l *intList) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *intList) Set(value string) error {
+	*l = nil
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", part)
+		}
+		*l = append(*l, n)
+	}
+	return nil
+}
+
+// priceFilter maps an upper-case currency code to its [min, max] price
+// band; a zero max means no upper bound.
+type priceFilter map[string][2]float64
+
+func (p *priceFilter) String() string {
+	parts := make([]string, 0, len(*p))
+	for currency, band := range *p {
+		part := currency + ":" + strconv.FormatFloat(band[0], 'f', -1, 64) + "-"
+		if band[1] > 0 {
+			part += strconv.FormatFloat(band[1], 'f', -1, 64)
+		}
+		parts = append(parts, part)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (p *priceFilter) Set(value string) error {
+	filter, err := parsePriceFilter(value)
+	if err != nil {
+		return err
+	}
+	*p = filter
+	return nil
+}
+
+func (p *priceFilter) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// parsePriceFilter reads "CUR:min-max" entries separated by commas. Either
+// bound may be left out: "USD:5-" has no maximum, "USD:-50" no minimum.
+func parsePriceFilter(spec string) (priceFilter, error) {
+	filter := make(priceFilter)
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		currency, band, ok := strings.Cut(entry, ":")
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if !ok || currency == "" {
+			return nil, fmt.Errorf("invalid price filter %q, want CUR:min-max", entry)
+		}
+		if _, dup := filter[currency]; dup {
+			return nil, fmt.Errorf("duplicate price filter for %s", currency)
+		}
+		minText, maxText, ok := strings.Cut(band, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid price band %q for %s, want min-max", band, currency)
+		}
+		var bounds [2]float64
+		for i, text := range []string{minText, maxText} {
+			if text = strings.TrimSpace(text); text == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(text, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid price %q for %s", text, currency)
+			}
+			bounds[i] = n
+		}
+		if bounds[1] > 0 && bounds[0] > bounds[1] {
+			return nil, fmt.Errorf("invalid price band %s for %s: min above max", band, currency)
+		}
+		filter[currency] = bounds
+	}
+	return filter, nil
+}
+
+// headerMap collects "Name: value" flags; unlike stringList each use of the
+// flag adds a header.
+type headerMap map[string]string
+
+func (h *headerMap) String() string {
+	parts := make([]string, 0, len(*h))
+	for name, value := range *h {
+		parts = append(parts, name+": "+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+func (h *headerMap) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if name = strings.TrimSpace(name); !ok || name == "" {
+		return fmt.Errorf("invalid header %q, want \"Name: value\"", value)
+	}
+	if *h == nil {
+		*h = make(headerMap)
+	}
+	(*h)[name] = strings.TrimSpace(val)
+	return nil
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
+}
+
+func LoadConfig() (*Config, error) {
+	return loadConfig(os.Args[1:], os.Getenv)
+}
+
+// DefaultConfig returns the settings used when neither a flag nor the
+// config file says otherwise. It has no API key.
+func DefaultConfig() *Config {
+	return &Config{
+		Format:           FormatText,
+		Game:             DefaultGame,
+		MaxRetries:       MaxRetries,
+		LogFormat:        LogFormatText,
+		LogLevel:         "info",
+		LogTimezone:      "UTC",
+		LogTimeFormat:    "rfc3339",
+		DedupWindow:      Duration(DedupWindow),
+		DedupStrategy:    DedupExact,
+		DedupCapacity:    DedupBloomCapacity,
+		DedupFPRate:      DedupBloomFPRate,
+		PersistDedupTTL:  Duration(PersistDedupTTL),
+		FloorWindow:      Duration(FloorWindow),
+		PriceChangeTTL:   Duration(PriceChangeTTL),
+		FloatTimeout:     Duration(FloatCheckTimeout),
+		FloatConcurrency: FloatCheckConcurrency,
+		Topic:            DefaultTopic,
+		HookTimeout:      Duration(HookTimeout),
+		RingSize:         RingSize,
+		SampleRate:       1,
+		WriteTimeout:     Duration(WriteTimeout),
+		ReadTimeout:      Duration(ReadTimeout),
+		IdleTimeout:      Duration(IdleTimeout),
+		MaxMessageSize:   MaxMessageSize,
+		SubscribeTimeout: Duration(SubscribeTimeout),
+		LogRetention:     Duration(LogRetention),
+		UserAgent:        UserAgent,
+		PingInterval:     Duration(PingInterval),
+		PingMode:         PingModeText,
+		Compression:      true,
+		QueueSize:        QueueSize,
+		QueueFull:        QueueFullBlock,
+		ParseErrorsMax:   ParseErrorsMax,
+		BreakerThreshold: BreakerThreshold,
+		TokenTimeout:     Duration(TokenTimeout),
+		HTTPTimeout:      Duration(HTTPTimeout),
+		BreakerCooldown:  Duration(BreakerCooldown),
+		ReconnectBudget:  ReconnectBudget,
+
+		ReconnectCooldown:     Duration(ReconnectCooldown),
+		ListingRateHysteresis: ListingRateHysteresis,
+	}
+}
+
+func loadConfig(args []string, getenv func(string) string) (*Config, error) {
+	cfg := DefaultConfig()
+	fs := flag.NewFlagSet("market-ws", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to JSON/YAML config file")
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "item output format: text|json|json-pretty")
+	fs.IntVar(&cfg.JSONIndent, "json-indent", cfg.JSONIndent, "indent JSON output by this many spaces, 0 for one event per line; json-pretty defaults to 2")
+	fs.Var(&cfg.Channels, "channels", "comma-separated list of channels to subscribe to")
+	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "log debug messages, same as -log-level=debug")
+	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "log everything, including every raw frame received")
+	fs.BoolVar(&cfg.Quiet, "quiet", cfg.Quiet, "log only matched items, warnings and errors")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format: text|json")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug|info|warn|error")
+	fs.Var(&cfg.LogRetention, "log-retention", "delete log files older than this, 0 keeps them")
+	fs.IntVar(&cfg.LogMaxFiles, "log-max-files", cfg.LogMaxFiles, "keep at most this many log files, 0 for no limit")
+	fs.BoolVar(&cfg.LogStdout, "log-stdout", cfg.LogStdout, "also write logs to stdout")
+	fs.StringVar(&cfg.LogTimezone, "log-tz", cfg.LogTimezone, "time zone of log timestamps and file names: UTC, Local or a name like Europe/Moscow")
+	fs.StringVar(&cfg.LogTimeFormat, "log-time-format", cfg.LogTimeFormat, "log timestamp format: rfc3339, rfc3339ms, rfc3339nano or a Go time layout")
+	fs.BoolVar(&cfg.Syslog, "syslog", cfg.Syslog, "also send logs to syslog")
+	fs.StringVar(&cfg.SyslogAddr, "syslog-addr", cfg.SyslogAddr, "remote syslog server as udp://host:port or tcp://host:port; the local daemon by default")
+	fs.IntVar(&cfg.MaxRetries, "max-retries", cfg.MaxRetries, "reconnect attempts before giving up, -1 for infinite")
+	fs.StringVar(&cfg.UserAgent, "user-agent", cfg.UserAgent, "User-Agent sent with the WebSocket handshake")
+	fs.StringVar(&cfg.Origin, "origin", cfg.Origin, "Origin sent with the WebSocket handshake, defaults to the market's")
+	fs.Var(&cfg.Headers, "header", "extra handshake header as \"Name: value\", may be repeated")
+	fs.StringVar(&cfg.CAFile, "ca-file", cfg.CAFile, "PEM file with additional trusted CA certificates")
+	fs.StringVar(&cfg.PinSHA256, "pin-sha256", cfg.PinSHA256, "reject servers whose certificate SPKI SHA-256 (base64 or hex) differs")
+	fs.StringVar(&cfg.Proxy, "proxy", cfg.Proxy, "proxy URL (http, https or socks5) for the token request and WebSocket")
+	fs.Var(&cfg.WriteTimeout, "write-timeout", "deadline for each WebSocket write")
+	fs.Var(&cfg.ReadTimeout, "read-timeout", "reconnect if nothing is read from the WebSocket for this long")
+	fs.Var(&cfg.IdleTimeout, "idle-timeout", "reconnect if pongs arrive but no messages do for this long, 0 disables")
+	fs.Int64Var(&cfg.MaxMessageSize, "max-message-size", cfg.MaxMessageSize, "largest WebSocket message in bytes; a larger one closes the connection and reconnects")
+	fs.BoolVar(&cfg.WarmStandby, "warm-standby", cfg.WarmStandby, "keep a second authenticated connection ready and switch to it when the active one drops")
+	fs.Var(&cfg.CloseCodes, "close-codes", "comma-separated code=quick|refresh|backoff recoveries for WebSocket close codes, e.g. 4000=refresh")
+	fs.Var(&cfg.TokenTimeout, "token-timeout", "timeout for a single token request")
+	fs.Var(&cfg.HTTPTimeout, "http-timeout", "upper bound on any HTTP request of the watcher's client: token and backfill requests")
+	fs.IntVar(&cfg.BreakerThreshold, "token-breaker-threshold", cfg.BreakerThreshold, "consecutive token failures that stop token requests for a while, 0 disables")
+	fs.Var(&cfg.BreakerCooldown, "token-breaker-cooldown", "how long token requests are skipped once the breaker opens")
+	fs.IntVar(&cfg.ReconnectBudget, "reconnect-budget", cfg.ReconnectBudget, "most reconnects per market connection in a rolling hour before cooling down, 0 disables")
+	fs.Var(&cfg.ReconnectCooldown, "reconnect-cooldown", "how long reconnects pause once the reconnect budget is spent")
+	fs.Var(&cfg.PingInterval, "ping-interval", "interval between keepalive pings, shortened automatically after idle disconnects")
+	fs.StringVar(&cfg.PingMode, "ping-mode", cfg.PingMode, "keepalive ping: text (\"ping\" message) or control (WebSocket ping frame)")
+	fs.BoolVar(&cfg.Compression, "compression", cfg.Compression, "offer permessage-deflate compression to the WebSocket server")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "process messages in this many goroutines off the read loop, 0 processes them inline")
+	fs.IntVar(&cfg.QueueSize, "queue-size", cfg.QueueSize, "with -workers, messages buffered between the read loop and the workers")
+	fs.StringVar(&cfg.QueueFull, "queue-full", cfg.QueueFull, "with -workers, what to do when the queue is full: block (up to 1s, then drop) or drop")
+	fs.Var(&cfg.SubscribeTimeout, "subscribe-timeout", "wait this long for the server to confirm each subscription, 0 disables")
+	fs.Float64Var(&cfg.MinPrice, "min-price", cfg.MinPrice, "skip items cheaper than this, in the item's currency")
+	fs.Float64Var(&cfg.MaxPrice, "max-price", cfg.MaxPrice, "skip items more expensive than this, 0 for no limit")
+	fs.Var(&cfg.PriceFilter, "price-filter", "per-currency price bands, e.g. USD:5-50,EUR:4-45; an empty max means no limit")
+	fs.BoolVar(&cfg.StrictCurrency, "strict-currency", cfg.StrictCurrency, "with -price-filter, skip items in currencies it does not list")
+	fs.Var(&cfg.Currencies, "currencies", "comma-separated currencies to watch, e.g. USD,EUR, or !RUB to skip one; empty watches all")
+	fs.Float64Var(&cfg.MinFloat, "min-float", cfg.MinFloat, "skip items with a float below this")
+	fs.Float64Var(&cfg.MaxFloat, "max-float", cfg.MaxFloat, "skip items with a float above this, 0 for no limit")
+	fs.BoolVar(&cfg.RequireFloat, "require-float", cfg.RequireFloat, "skip items that have no float value")
+	fs.BoolVar(&cfg.RequireInspect, "require-inspect", cfg.RequireInspect, "skip items without a valid steam:// inspect link")
+	fs.StringVar(&cfg.Filter, "filter", cfg.Filter, `filter expression, e.g. 'price < 50 && name contains "AK-47"'`)
+	fs.StringVar(&cfg.BlacklistPath, "blacklist-file", cfg.BlacklistPath, "file of item ids, inspect URLs or names to ignore, one per line; reloaded on SIGHUP")
+	fs.StringVar(&cfg.WatchlistPath, "watchlist-file", cfg.WatchlistPath, "file of exact market names to watch, one per line; other items are skipped; reloaded on SIGHUP")
+	fs.BoolVar(&cfg.WatchlistPriority, "watchlist-priority", cfg.WatchlistPriority, "mark -watchlist-file items high priority in notifications, bypassing -per-name-cooldown")
+	fs.Var(&cfg.Include, "include", "comma-separated name terms, an item must contain one of them (* wildcards allowed)")
+	fs.Var(&cfg.Exclude, "exclude", "comma-separated name terms, items containing any of them are skipped")
+	fs.Var(&cfg.Qualities, "qualities", "comma-separated item qualities to watch, e.g. stattrak,souvenir; empty watches all")
+	fs.Var(&cfg.Seeds, "seeds", "comma-separated paint seeds that mark an item as high priority")
+	fs.Float64Var(&cfg.MinDiscount, "min-discount", cfg.MinDiscount, "skip items priced less than this many percent below the market's reference price")
+	fs.StringVar(&cfg.BaseCurrency, "base-currency", cfg.BaseCurrency, "convert prices to this currency, e.g. USD")
+	fs.Var(&cfg.DedupWindow, "dedup-window", "suppress identical items seen within this window, 0 disables")
+	fs.StringVar(&cfg.DedupStrategy, "dedup-strategy", cfg.DedupStrategy, "how to remember seen items: exact keeps their ids, bloom uses fixed memory at a small false positive rate")
+	fs.IntVar(&cfg.DedupCapacity, "dedup-capacity", cfg.DedupCapacity, "items per dedup window the bloom strategy is sized for")
+	fs.Float64Var(&cfg.DedupFPRate, "dedup-fp-rate", cfg.DedupFPRate, "false positive rate of the bloom strategy at -dedup-capacity items")
+	fs.StringVar(&cfg.PersistDedup, "persist-dedup", cfg.PersistDedup, "SQLite file remembering seen items across restarts, so each is emitted once within -persist-dedup-retention")
+	fs.Var(&cfg.PersistDedupTTL, "persist-dedup-retention", "how long -persist-dedup remembers an item")
+	fs.Var(&cfg.PerNameCooldown, "per-name-cooldown", "after emitting an item, skip items with the same name for this long, 0 disables")
+	fs.Float64Var(&cfg.CooldownBypassPrice, "cooldown-bypass-price", cfg.CooldownBypassPrice, "items priced at least this much ignore -per-name-cooldown, 0 disables the bypass")
+	fs.Float64Var(&cfg.UndercutPct, "undercut-pct", cfg.UndercutPct, "flag items priced this many percent below the recent floor for their name, 0 disables")
+	fs.Var(&cfg.FloorWindow, "floor-window", "how long prices count towards an item's floor")
+	fs.BoolVar(&cfg.PriceChanges, "price-changes", cfg.PriceChanges, "report items relisted at another price, identified by inspect link, as price_changed events")
+	fs.Var(&cfg.PriceChangeTTL, "price-change-ttl", "how long -price-changes remembers an item's last price")
+	fs.StringVar(&cfg.FloatCheckURL, "float-checker-url", cfg.FloatCheckURL, "float-checker service to look up floats of items sent with an inspect link but no float; needs -workers")
+	fs.Var(&cfg.FloatTimeout, "float-checker-timeout", "give up on a float lookup after this long and emit the item without a float")
+	fs.IntVar(&cfg.FloatConcurrency, "float-checker-concurrency", cfg.FloatConcurrency, "float lookups in flight at once")
+	fs.IntVar(&cfg.SampleRate, "sample-rate", cfg.SampleRate, "without item filters, process only 1 in N items")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "without item filters, process at most N items per second, 0 for no limit")
+	fs.StringVar(&cfg.DBPath, "db", cfg.DBPath, "SQLite database file to store items in")
+	fs.StringVar(&cfg.PostgresDSN, "pg-dsn", cfg.PostgresDSN, "PostgreSQL connection string to store items in")
+	fs.StringVar(&cfg.CSVPath, "csv", cfg.CSVPath, "CSV file to append matching items to")
+	fs.Int64Var(&cfg.CSVMaxSize, "csv-max-size", cfg.CSVMaxSize, "start a new CSV file once this many bytes are written, 0 disables rotation")
+	fs.Var(&cfg.Fields, "fields", "comma-separated item fields to write in JSON and CSV output, e.g. name,price,float; all by default")
+	fs.StringVar(&cfg.ReplayPath, "replay", cfg.ReplayPath, "replay raw messages from this file instead of connecting")
+	fs.Float64Var(&cfg.ReplayRate, "replay-rate", cfg.ReplayRate, "replayed messages per second, 0 for as fast as possible")
+	fs.StringVar(&cfg.CapturePath, "capture", cfg.CapturePath, "append every raw inbound message to this file for later -replay")
+	fs.StringVar(&cfg.ParseErrorsDir, "parse-errors-dir", cfg.ParseErrorsDir, "save each message that fails to parse as a file in this directory, e.g. parse_errors")
+	fs.IntVar(&cfg.ParseErrorsMax, "parse-errors-max", cfg.ParseErrorsMax, "how many of the newest -parse-errors-dir files to keep")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "address to serve Prometheus /metrics on, e.g. :9100")
+	fs.Var(&cfg.TradeHookURLs, "trade-hook-urls", "comma-separated URLs to POST matching items to")
+	fs.Var(&cfg.HookTimeout, "hook-timeout", "timeout for a single trade hook call")
+	fs.StringVar(&cfg.WebhookSecret, "webhook-secret", cfg.WebhookSecret, "sign trade hook requests with HMAC-SHA256 using this shared secret")
+	fs.StringVar(&cfg.NATSURL, "nats-url", cfg.NATSURL, "NATS server to publish parsed items to")
+	fs.Var(&cfg.KafkaBrokers, "kafka-brokers", "comma-separated Kafka brokers to publish parsed items to")
+	fs.StringVar(&cfg.Topic, "topic", cfg.Topic, "NATS subject prefix or Kafka topic for published items")
+	fs.Var(&cfg.MarketNames, "markets", "comma-separated list of built-in markets to watch: csgo, cs2, dota2")
+	fs.StringVar(&cfg.Game, "game", cfg.Game, "game of the default market and of config file markets without one: csgo, cs2 or dota2")
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", cfg.HTTPAddr, "address to serve the HTTP API (/items, /healthz, /stream) and dashboard on")
+	fs.StringVar(&cfg.ControlAddr, "control-addr", cfg.ControlAddr, "address to accept POST /config filter changes on; a bare :port listens on 127.0.0.1 only")
+	fs.IntVar(&cfg.RingSize, "ring-size", cfg.RingSize, "number of recent items kept for the HTTP API")
+	fs.Var(&cfg.StatsInterval, "stats-interval", "log session stats at this interval, 0 logs them only on exit")
+	fs.Var(&cfg.RunDuration, "duration", "shut down after running this long, e.g. 10m; exit status 2 if no item matched")
+	fs.BoolVar(&cfg.Backfill, "backfill", cfg.Backfill, "after a reconnect, fetch the items missed while disconnected from the market's history_url")
+	fs.Float64Var(&cfg.ListingRateHigh, "listing-rate-high", cfg.ListingRateHigh, "alert when more than this many new listings arrive per minute, 0 disables")
+	fs.Float64Var(&cfg.ListingRateLow, "listing-rate-low", cfg.ListingRateLow, "alert when fewer than this many new listings arrive per minute, 0 disables")
+	fs.Float64Var(&cfg.ListingRateHysteresis, "listing-rate-hysteresis", cfg.ListingRateHysteresis, "percent the listing rate must recover past a threshold before its alert clears")
+	fs.BoolVar(&cfg.BandwidthStats, "bandwidth-stats", cfg.BandwidthStats, "count bytes read and message rates (rolling and peak) in the session stats")
+	fs.StringVar(&cfg.DiscordWebhook, "discord-webhook", cfg.DiscordWebhook, "Discord webhook URL to notify about matching items")
+	fs.StringVar(&cfg.TelegramToken, "telegram-token", cfg.TelegramToken, "Telegram bot token to notify about matching items")
+	fs.StringVar(&cfg.TelegramChatID, "telegram-chat-id", cfg.TelegramChatID, "Telegram chat to send notifications to")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		if err := readConfigFile(*configPath, cfg); err != nil {
+			return nil, err
+		}
+		// Flags take precedence over the file, so parse them again on top.
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.APIKey == "" && len(cfg.APIKeys) == 0 {
+		cfg.APIKey = getenv("MARKET_API_KEY")
+		if keys := getenv("MARKET_API_KEYS"); keys != "" {
+			cfg.APIKeys.Set(keys)
+		}
+	}
+	if cfg.APIKey == "" && len(cfg.APIKeys) == 0 {
+		cfg.APIKey = APIKey
+	}
+	if cfg.APIKey != "" && !slices.Contains(cfg.APIKeys, cfg.APIKey) {
+		cfg.APIKeys = append(stringList{cfg.APIKey}, cfg.APIKeys...)
+	}
+	if len(cfg.APIKeys) == 0 || slices.Contains(cfg.APIKeys, apiKeyPlaceholder) {
+		return nil, errors.New("API key is not set: use -config file, MARKET_API_KEY env or the APIKey constant")
+	}
+	cfg.APIKey = cfg.APIKeys[0]
+
+	if cfg.Format != FormatText && cfg.Format != FormatJSON && cfg.Format != FormatJSONPretty {
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	if cfg.JSONIndent < 0 || cfg.JSONIndent > 8 {
+		return nil, fmt.Errorf("invalid json indent %d, want 0 to 8 spaces", cfg.JSONIndent)
+	}
+	if cfg.LogFormat != LogFormatText && cfg.LogFormat != LogFormatJSON {
+		return nil, fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+	var level slog.Level
+	if cfg.Verbose && cfg.Quiet {
+		return nil, errors.New("only one of verbose and quiet may be set")
+	}
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.LogLevel)
+	}
+	if _, err := time.LoadLocation(cfg.LogTimezone); err != nil {
+		return nil, fmt.Errorf("invalid log time zone %q: %w", cfg.LogTimezone, err)
+	}
+	if cfg.LogTimeFormat == "" {
+		return nil, errors.New("log time format must not be empty")
+	}
+	if cfg.SampleRate < 1 || cfg.RateLimit < 0 {
+		return nil, fmt.Errorf("invalid sampling: sample rate %d, rate limit %g", cfg.SampleRate, cfg.RateLimit)
+	}
+	if cfg.RunDuration < 0 {
+		return nil, errors.New("duration must not be negative")
+	}
+	if cfg.ReplayRate < 0 {
+		return nil, errors.New("replay rate must not be negative")
+	}
+	if cfg.CSVMaxSize < 0 {
+		return nil, errors.New("csv max size must not be negative")
+	}
+	if cfg.DedupStrategy != DedupExact && cfg.DedupStrategy != DedupBloom {
+		return nil, fmt.Errorf("unknown dedup strategy %q", cfg.DedupStrategy)
+	}
+	if cfg.DedupCapacity <= 0 || cfg.DedupFPRate <= 0 || cfg.DedupFPRate >= 1 {
+		return nil, fmt.Errorf("invalid bloom dedup sizing: capacity %d, false positive rate %g", cfg.DedupCapacity, cfg.DedupFPRate)
+	}
+	if cfg.PersistDedupTTL <= 0 {
+		return nil, errors.New("persist dedup retention must be positive")
+	}
+	if cfg.RingSize <= 0 {
+		return nil, errors.New("ring size must be positive")
+	}
+	if cfg.WriteTimeout <= 0 || cfg.ReadTimeout <= 0 {
+		return nil, errors.New("write and read timeouts must be positive")
+	}
+	if cfg.IdleTimeout < 0 {
+		return nil, errors.New("idle timeout must not be negative")
+	}
+	if cfg.MaxMessageSize <= 0 {
+		return nil, errors.New("max message size must be positive")
+	}
+	if cfg.TokenTimeout <= 0 {
+		return nil, errors.New("token timeout must be positive")
+	}
+	if cfg.HTTPTimeout <= 0 {
+		return nil, errors.New("http timeout must be positive")
+	}
+	if cfg.BreakerThreshold < 0 || cfg.BreakerCooldown <= 0 {
+		return nil, errors.New("token breaker threshold must not be negative and cooldown must be positive")
+	}
+	if cfg.ParseErrorsMax < 1 {
+		return nil, fmt.Errorf("invalid parse errors max %d, want at least 1", cfg.ParseErrorsMax)
+	}
+	if cfg.ReconnectBudget < 0 || cfg.ReconnectCooldown <= 0 {
+		return nil, errors.New("reconnect budget must not be negative and cooldown must be positive")
+	}
+	for code, recovery := range cfg.CloseCodes {
+		if !validRecovery(recovery) {
+			return nil, fmt.Errorf("invalid recovery %q for close code %d", recovery, code)
+		}
+	}
+	if cfg.PingInterval < Duration(MinPingInterval) || cfg.PingInterval >= cfg.ReadTimeout {
+		return nil, fmt.Errorf("ping interval must be between %s and the read timeout", MinPingInterval)
+	}
+	if cfg.PingMode != PingModeText && cfg.PingMode != PingModeControl {
+		return nil, fmt.Errorf("unknown ping mode %q", cfg.PingMode)
+	}
+	if cfg.Workers < 0 || cfg.QueueSize <= 0 {
+		return nil, errors.New("workers must not be negative and queue size must be positive")
+	}
+	if cfg.QueueFull != QueueFullBlock && cfg.QueueFull != QueueFullDrop {
+		return nil, fmt.Errorf("unknown queue full mode %q", cfg.QueueFull)
+	}
+	if cfg.SubscribeTimeout < 0 {
+		return nil, errors.New("subscribe timeout must not be negative")
+	}
+	if (cfg.TelegramToken == "") != (cfg.TelegramChatID == "") {
+		return nil, errors.New("telegram token and chat id must be set together")
+	}
+	if cfg.LogRetention < 0 || cfg.LogMaxFiles < 0 {
+		return nil, errors.New("log retention and max files must not be negative")
+	}
+	if cfg.MinDiscount < 0 || cfg.MinDiscount >= 100 {
+		return nil, fmt.Errorf("invalid min discount %g", cfg.MinDiscount)
+	}
+	for i, entry := range cfg.Currencies {
+		raw, deny := strings.CutPrefix(strings.TrimSpace(entry), "!")
+		code, ok := normalizeCurrency(raw)
+		if !ok {
+			return nil, fmt.Errorf("unknown currency %q", entry)
+		}
+		if deny {
+			code = "!" + code
+		}
+		cfg.Currencies[i] = code
+	}
+	if cfg.PerNameCooldown < 0 || cfg.CooldownBypassPrice < 0 {
+		return nil, errors.New("per-name cooldown and bypass price must not be negative")
+	}
+	if cfg.ListingRateHigh < 0 || cfg.ListingRateLow < 0 {
+		return nil, errors.New("listing rate thresholds must not be negative")
+	}
+	if cfg.ListingRateHigh > 0 && cfg.ListingRateLow >= cfg.ListingRateHigh {
+		return nil, errors.New("listing rate low threshold must be below the high one")
+	}
+	if cfg.ListingRateHysteresis < 0 || cfg.ListingRateHysteresis >= 100 {
+		return nil, fmt.Errorf("invalid listing rate hysteresis %g", cfg.ListingRateHysteresis)
+	}
+	if cfg.UndercutPct < 0 || cfg.UndercutPct >= 100 {
+		return nil, fmt.Errorf("invalid undercut percentage %g", cfg.UndercutPct)
+	}
+	if cfg.ControlAddr != "" {
+		host, port, err := net.SplitHostPort(cfg.ControlAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid control address %q: %w", cfg.ControlAddr, err)
+		}
+		// Filter changes are unauthenticated: local only unless asked.
+		if host == "" {
+			cfg.ControlAddr = net.JoinHostPort("127.0.0.1", port)
+		}
+	}
+	if cfg.PriceChangeTTL <= 0 {
+		return nil, errors.New("price change ttl must be positive")
+	}
+	if cfg.FloatCheckURL != "" {
+		if u, err := url.Parse(cfg.FloatCheckURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid float checker url %q, want http(s)://host/path", cfg.FloatCheckURL)
+		}
+		// Lookups wait on the service; inline they would stall the read loop.
+		if cfg.Workers == 0 {
+			return nil, errors.New("float checker needs -workers")
+		}
+		if cfg.FloatTimeout <= 0 || cfg.FloatConcurrency < 1 {
+			return nil, fmt.Errorf("invalid float checker limits: timeout %s, concurrency %d", cfg.FloatTimeout, cfg.FloatConcurrency)
+		}
+	}
+	if cfg.FloorWindow <= 0 {
+		return nil, errors.New("floor window must be positive")
+	}
+	if cfg.DBPath != "" && cfg.PostgresDSN != "" {
+		return nil, errors.New("only one of db and pg dsn may be set")
+	}
+	if cfg.NATSURL != "" && len(cfg.KafkaBrokers) > 0 {
+		return nil, errors.New("only one of nats url and kafka brokers may be set")
+	}
+	if (cfg.NATSURL != "" || len(cfg.KafkaBrokers) > 0) && cfg.Topic == "" {
+		return nil, errors.New("topic must not be empty")
+	}
+	if cfg.HookTimeout <= 0 {
+		return nil, errors.New("hook timeout must be positive")
+	}
+	if err := resolveMarkets(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Backfill && !slices.ContainsFunc(cfg.Markets, func(m MarketConfig) bool { return m.HistoryURL != "" }) {
+		return nil, errors.New("backfill needs a history_url for at least one market")
+	}
+	if cfg.MaxRetries < -1 {
+		return nil, fmt.Errorf("invalid max retries %d", cfg.MaxRetries)
+	}
+	if _, err := buildFilters(cfg.filterSettings()); err != nil {
+		return nil, err
+	}
+	if _, err := parseFields(cfg.Fields); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Level is the log level the config asks for; Verbose, Debug and Quiet
+// override LogLevel.
+func (c *Config) Level() slog.Level {
+	if c.Verbose || c.Debug {
+		return slog.LevelDebug
+	}
+	if c.Quiet {
+		return slog.LevelWarn
+	}
+	var level slog.Level
+	level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// ItemLevel is the level matched items are logged at: raised to Warn in
+// quiet mode so they still pass Level.
+func (c *Config) ItemLevel() slog.Level {
+	if c.Quiet {
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// logTimeLayouts are the names -log-time-format accepts besides a Go
+// time layout.
+var logTimeLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc3339ms":   "2006-01-02T15:04:05.000Z07:00",
+}
+
+// JSONOutput reports whether items are written as JSON events.
+func (c *Config) JSONOutput() bool {
+	return c.Format == FormatJSON || c.Format == FormatJSONPretty
+}
+
+// jsonIndent is the indent of JSON output, empty for compact JSONL.
+func (c *Config) jsonIndent() string {
+	n := c.JSONIndent
+	if n == 0 && c.Format == FormatJSONPretty {
+		n = PrettyJSONIndent
+	}
+	return strings.Repeat(" ", n)
+}
+
+// LogLocation is the time zone log timestamps and file names are in.
+func (c *Config) LogLocation() *time.Location {
+	loc, err := time.LoadLocation(c.LogTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// LogTimeLayout is the layout log timestamps are written with.
+func (c *Config) LogTimeLayout() string {
+	if layout, ok := logTimeLayouts[strings.ToLower(c.LogTimeFormat)]; ok {
+		return layout
+	}
+	return c.LogTimeFormat
+}
+
+func resolveMarkets(cfg *Config) error {
+	if cfg.Game == "" {
+		cfg.Game = DefaultGame
+	}
+	game, err := lookupGame(cfg.Game)
+	if err != nil {
+		return err
+	}
+	if len(cfg.MarketNames) > 0 {
+		cfg.Markets = nil
+		for _, name := range cfg.MarketNames {
+			profile, ok := gameProfiles[name]
+			if !ok {
+				return fmt.Errorf("unknown market %q", name)
+			}
+			cfg.Markets = append(cfg.Markets, profile.Market)
+		}
+	}
+	if len(cfg.Markets) == 0 {
+		cfg.Markets = []MarketConfig{game.Market}
+	}
+
+	seen := make(map[string]bool)
+	for i := range cfg.Markets {
+		market := &cfg.Markets[i]
+		if market.Game == "" {
+			market.Game = cfg.Game
+		}
+		if _, err := lookupGame(market.Game); err != nil {
+			return fmt.Errorf("market %s: %w", market.Name, err)
+		}
+		if err := market.validate(); err != nil {
+			return err
+		}
+		if seen[market.Name] {
+			return fmt.Errorf("duplicate market %q", market.Name)
+		}
+		seen[market.Name] = true
+	}
+	return nil
+}
+
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
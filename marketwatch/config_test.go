@@ -0,0 +1,117 @@
+package marketwatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes content to name in a temporary directory and returns
+// its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadConfigAPIKeyPriority(t *testing.T) {
+	jsonFile := writeFile(t, "config.json", `{"api_key": "from-json"}`)
+	yamlFile := writeFile(t, "config.yaml", "api_key: from-yaml\n")
+	emptyFile := writeFile(t, "empty.json", `{}`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "file beats environment",
+			args: []string{"-config", jsonFile},
+			env:  map[string]string{"MARKET_API_KEY": "from-env"},
+			want: []string{"from-json"},
+		},
+		{
+			name: "yaml file",
+			args: []string{"-config", yamlFile},
+			env:  map[string]string{"MARKET_API_KEY": "from-env"},
+			want: []string{"from-yaml"},
+		},
+		{
+			name: "environment when the file has no key",
+			args: []string{"-config", emptyFile},
+			env:  map[string]string{"MARKET_API_KEY": "from-env"},
+			want: []string{"from-env"},
+		},
+		{
+			name: "environment without a file",
+			env:  map[string]string{"MARKET_API_KEY": "from-env", "MARKET_API_KEYS": "second,third"},
+			want: []string{"from-env", "second", "third"},
+		},
+		{
+			name:    "placeholder constant is rejected",
+			wantErr: "API key is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(tt.args, env(tt.env))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.APIKey != tt.want[0] || strings.Join(cfg.APIKeys, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("keys %q (first %q), want %q", cfg.APIKeys, cfg.APIKey, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePriceFilter(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    priceFilter
+		wantErr string
+	}{
+		{spec: "USD:5-50,EUR:4-45", want: priceFilter{"USD": {5, 50}, "EUR": {4, 45}}},
+		{spec: " usd : 5 - , rub:-5000 ", want: priceFilter{"USD": {5, 0}, "RUB": {0, 5000}}},
+		{spec: "USD:0.5-0.5,", want: priceFilter{"USD": {0.5, 0.5}}},
+		{spec: "", want: priceFilter{}},
+		{spec: "USD", wantErr: "want CUR:min-max"},
+		{spec: ":5-50", wantErr: "want CUR:min-max"},
+		{spec: "USD:5", wantErr: "want min-max"},
+		{spec: "USD:five-50", wantErr: `invalid price "five"`},
+		{spec: "USD:50-5", wantErr: "min above max"},
+		{spec: "USD:1-2,usd:3-4", wantErr: "duplicate price filter for USD"},
+	}
+	for _, tt := range tests {
+		got, err := parsePriceFilter(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parsePriceFilter(%q) err = %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePriceFilter(%q): %v", tt.spec, err)
+			continue
+		}
+		if got.String() != tt.want.String() {
+			t.Errorf("parsePriceFilter(%q) = %s, want %s", tt.spec, got.String(), tt.want.String())
+		}
+	}
+}
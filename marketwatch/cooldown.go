@@ -0,0 +1,52 @@
+package marketwatch
+
+import (
+	"sync"
+	"time"
+)
+
+const cooldownSweepEvery = 1000
+
+// cooldownTracker suppresses repeat emissions of the same item name within
+// a cooldown. Items priced at or above bypassPrice always pass and don't
+// start a cooldown.
+type cooldownTracker struct {
+	mu          sync.Mutex
+	cooldown    time.Duration
+	bypassPrice float64
+	until       map[string]time.Time
+	calls       int
+	now         func() time.Time
+}
+
+func newCooldownTracker(cooldown time.Duration, bypassPrice float64) *cooldownTracker {
+	return &cooldownTracker{
+		cooldown:    cooldown,
+		bypassPrice: bypassPrice,
+		until:       make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+func (c *cooldownTracker) Allow(name string, price float64) bool {
+	if c.bypassPrice > 0 && price >= c.bypassPrice {
+		return true
+	}
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.calls++; c.calls%cooldownSweepEvery == 0 {
+		for other, until := range c.until {
+			if !now.Before(until) {
+				delete(c.until, other)
+			}
+		}
+	}
+	if until, ok := c.until[name]; ok && now.Before(until) {
+		return false
+	}
+	c.until[name] = now.Add(c.cooldown)
+	return true
+}
@@ -0,0 +1,55 @@
+package marketwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldownTracker(t *testing.T) {
+	clock := newFakeClock()
+	c := newCooldownTracker(time.Minute, 100)
+	c.now = clock.Now
+
+	steps := []struct {
+		advance time.Duration
+		name    string
+		price   float64
+		want    bool
+	}{
+		{0, "Sticker | Tyloo", 0.03, true},
+		{time.Second, "Sticker | Tyloo", 0.03, false},
+		{0, "Operation Bravo Case", 1.5, true},
+		{58 * time.Second, "Sticker | Tyloo", 0.03, false},
+		{time.Second, "Sticker | Tyloo", 0.03, true},
+		{time.Second, "Sticker | Tyloo", 0.03, false},
+		// At or above the bypass price the cooldown is ignored and not reset.
+		{0, "Sticker | Tyloo", 100, true},
+		{0, "AWP | Dragon Lore (Factory New)", 9000, true},
+		{0, "AWP | Dragon Lore (Factory New)", 9000, true},
+		{0, "AWP | Dragon Lore (Factory New)", 50, true},
+		{time.Second, "AWP | Dragon Lore (Factory New)", 50, false},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		if got := c.Allow(s.name, s.price); got != s.want {
+			t.Errorf("step %d: Allow(%q, %g) = %v, want %v", i, s.name, s.price, got, s.want)
+		}
+	}
+}
+
+func TestCooldownTrackerSweeps(t *testing.T) {
+	clock := newFakeClock()
+	c := newCooldownTracker(time.Minute, 0)
+	c.now = clock.Now
+	c.Allow("Operation Bravo Case", 1)
+	clock.Advance(2 * time.Minute)
+	for i := 1; i < cooldownSweepEvery; i++ {
+		c.Allow("Sticker | Tyloo", 0.03)
+	}
+	if _, ok := c.until["Operation Bravo Case"]; ok {
+		t.Error("expired cooldown was not swept")
+	}
+	if len(c.until) != 1 {
+		t.Errorf("%d cooldowns tracked, want 1", len(c.until))
+	}
+}
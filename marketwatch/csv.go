@@ -0,0 +1,158 @@
+package marketwatch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CSVFlushInterval = 5 * time.Second
+
+var csvHeader = []string{"timestamp", "name", "quality", "price", "currency", "float", "inspect_url"}
+
+// csvWriter appends items to a CSV file and, once the file grows past
+// maxSize bytes, continues in a new file named with a timestamp suffix.
+type csvWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	fields  fieldSet
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+}
+
+func newCSVWriter(path string, maxSize int64, fields fieldSet) (*csvWriter, error) {
+	c := &csvWriter{path: path, maxSize: maxSize, fields: fields}
+	if err := c.open(path); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvWriter) open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	c.file = file
+	c.buf = bufio.NewWriter(file)
+	c.size = info.Size()
+	if c.size == 0 {
+		header := csvHeader
+		if c.fields != nil {
+			header = c.fields.header()
+		}
+		return c.writeRecord(header)
+	}
+	return nil
+}
+
+func (c *csvWriter) Write(item *Item) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record := csvRecord(item, time.Now())
+	if c.fields != nil {
+		values, err := c.fields.record(item)
+		if err != nil {
+			return err
+		}
+		record = append(record[:1], values...)
+	}
+	if err := c.writeRecord(record); err != nil {
+		return err
+	}
+	if c.maxSize > 0 && c.size >= c.maxSize {
+		return c.rotate()
+	}
+	return nil
+}
+
+func (c *csvWriter) writeRecord(record []string) error {
+	var line bytes.Buffer
+	w := csv.NewWriter(&line)
+	w.Write(record)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	n, err := c.buf.Write(line.Bytes())
+	c.size += int64(n)
+	return err
+}
+
+func (c *csvWriter) rotate() error {
+	if err := c.closeFile(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(c.path)
+	next := fmt.Sprintf("%s_%s%s", strings.TrimSuffix(c.path, ext), time.Now().Format("20060102_150405"), ext)
+	return c.open(next)
+}
+
+func (c *csvWriter) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Flush()
+}
+
+func (c *csvWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeFile()
+}
+
+func (c *csvWriter) closeFile() error {
+	if err := c.buf.Flush(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
+
+// Run flushes buffered rows periodically so the file is readable while the
+// watcher is running.
+func (c *csvWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(CSVFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Flush()
+		}
+	}
+}
+
+func csvRecord(item *Item, ts time.Time) []string {
+	floatValue := ""
+	if item.Float != nil {
+		floatValue = strconv.FormatFloat(*item.Float, 'f', -1, 64)
+	}
+	return []string{
+		ts.UTC().Format(time.RFC3339),
+		item.MarketName,
+		item.Quality,
+		strconv.FormatFloat(item.Price, 'f', -1, 64),
+		item.Currency,
+		floatValue,
+		item.InspectURL,
+	}
+}
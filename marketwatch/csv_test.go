@@ -0,0 +1,117 @@
+package marketwatch
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func stickerItem() *Item {
+	return &Item{
+		MarketName: `AK-47 | "Case Hardened", Souvenir`,
+		Price:      12.5,
+		Currency:   "USD",
+		Float:      floatPtr(0.0312),
+		InspectURL: "steam://rungame/730/76561202255233023/+csgo_econ_action_preview M1A2D3",
+		Stickers:   []Sticker{{ID: 5021, Name: "Crown (Foil)", Wear: floatPtr(0.1)}, {ID: 77}},
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		header []string
+		row    []string
+	}{
+		{
+			name:   "default columns",
+			header: csvHeader,
+			row: []string{`AK-47 | "Case Hardened", Souvenir`, "", "12.5", "USD", "0.0312",
+				"steam://rungame/730/76561202255233023/+csgo_econ_action_preview M1A2D3"},
+		},
+		{
+			name:   "projected with stickers",
+			fields: []string{"name", "stickers", "price"},
+			header: []string{"timestamp", "name", "stickers", "price"},
+			row:    []string{`AK-47 | "Case Hardened", Souvenir`, `[{"id":5021,"name":"Crown (Foil)","wear":0.1},{"id":77}]`, "12.5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := parseFields(tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "items.csv")
+			w, err := newCSVWriter(path, 0, fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(stickerItem()); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			records := readCSV(t, path)
+			if len(records) != 2 {
+				t.Fatalf("%d records, want a header and one row", len(records))
+			}
+			if strings.Join(records[0], "|") != strings.Join(tt.header, "|") {
+				t.Errorf("header %q, want %q", records[0], tt.header)
+			}
+			if got := records[1][1:]; strings.Join(got, "|") != strings.Join(tt.row, "|") {
+				t.Errorf("row %q, want %q", got, tt.row)
+			}
+		})
+	}
+}
+
+func TestCSVWriterAppendsAndRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.csv")
+	w, err := newCSVWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(stickerItem())
+	w.Close()
+
+	// Reopening appends to the file without a second header.
+	w, err = newCSVWriter(path, 300, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(stickerItem())
+	w.Write(stickerItem())
+	w.Close()
+
+	if records := readCSV(t, path); len(records) != 3 || records[0][0] != "timestamp" || records[2][0] == "timestamp" {
+		t.Errorf("first file has %d records, want the header and two rows", len(records))
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "items_*.csv"))
+	if len(matches) != 1 {
+		t.Fatalf("rotated files %q, want one", matches)
+	}
+	if records := readCSV(t, matches[0]); len(records) != 2 || records[0][0] != "timestamp" {
+		t.Errorf("rotated file has %d records, want the header and one row", len(records))
+	}
+}
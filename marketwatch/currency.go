@@ -0,0 +1,185 @@
+package marketwatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FXRatesURL     = "https://open.er-api.com/v6/latest/USD"
+	FXRefreshEvery = 1 * time.Hour
+	FXRetryDelay   = 1 * time.Minute
+)
+
+var errRatesUnavailable = errors.New("exchange rates not loaded")
+
+type RateProvider interface {
+	Rate(from, to string) (float64, error)
+}
+
+// fxRateProvider keeps a USD-based rate table fetched from a free FX API in
+// memory and derives cross rates from it. Rate never touches the network.
+type fxRateProvider struct {
+	url    string
+	client *http.Client
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	rates map[string]float64
+}
+
+func newFXRateProvider(logger *slog.Logger) *fxRateProvider {
+	return &fxRateProvider{
+		url:    FXRatesURL,
+		client: &http.Client{Timeout: 15 * time.Second},
+		logger: logger,
+	}
+}
+
+func (p *fxRateProvider) Rate(from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.rates == nil {
+		return 0, errRatesUnavailable
+	}
+	fromRate, ok := p.rates[from]
+	if !ok || fromRate == 0 {
+		return 0, fmt.Errorf("no rate for %s", from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return 0, fmt.Errorf("no rate for %s", to)
+	}
+	return toRate / fromRate, nil
+}
+
+// Run loads the rate table and refreshes it until ctx is cancelled.
+func (p *fxRateProvider) Run(ctx context.Context) {
+	for {
+		wait := FXRefreshEvery
+		if err := p.refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("Exchange rate refresh failed", "err", err)
+			wait = FXRetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *fxRateProvider) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rates endpoint returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var data struct {
+		Result string             `json:"result"`
+		Rates  map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return err
+	}
+	if data.Result != "success" || len(data.Rates) == 0 {
+		return fmt.Errorf("rates endpoint result %q", data.Result)
+	}
+
+	p.mu.Lock()
+	p.rates = data.Rates
+	p.mu.Unlock()
+	p.logger.Info("Exchange rates updated", "currencies", len(data.Rates))
+	return nil
+}
+
+// convertPrice fills in the item's price in base currency. When no rate is
+// available the item keeps its original price and is marked unconverted.
+func convertPrice(item *Item, rates RateProvider, base string) error {
+	rate, err := rates.Rate(item.Currency, base)
+	if err != nil {
+		item.Unconverted = true
+		return err
+	}
+	basePrice := item.Price * rate
+	item.BasePrice = &basePrice
+	item.BaseCurrency = strings.ToUpper(base)
+	return nil
+}
+
+// currencyAliases maps the symbols and market-specific codes seen in
+// ui_currency, lower-cased, onto ISO 4217 codes.
+var currencyAliases = map[string]string{
+	"$":   "USD",
+	"us$": "USD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"₽":   "RUB",
+	"руб": "RUB",
+	"rur": "RUB",
+	"¥":   "CNY",
+	"rmb": "CNY",
+	"₴":   "UAH",
+	"грн": "UAH",
+	"₸":   "KZT",
+	"zł":  "PLN",
+	"r$":  "BRL",
+	"₺":   "TRY",
+	"₹":   "INR",
+	"₩":   "KRW",
+}
+
+// unknownCurrencies remembers the raw values already warned about.
+var unknownCurrencies sync.Map
+
+// normalizeCurrency returns the ISO 4217 code for a raw ui_currency value.
+// Three-letter codes are taken as they are; anything else not in
+// currencyAliases is returned unchanged with ok false.
+func normalizeCurrency(raw string) (code string, ok bool) {
+	s := strings.TrimSpace(raw)
+	if alias, found := currencyAliases[strings.ToLower(strings.TrimSuffix(s, "."))]; found {
+		return alias, true
+	}
+	if len(s) == 3 && strings.IndexFunc(s, func(r rune) bool { return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') }) < 0 {
+		return strings.ToUpper(s), true
+	}
+	return raw, false
+}
+
+// warnUnknownCurrency logs each unrecognized currency value the first time
+// it is seen.
+func warnUnknownCurrency(raw string, logger *slog.Logger) {
+	if _, seen := unknownCurrencies.LoadOrStore(raw, true); !seen {
+		logger.Warn("Unknown currency, passing it through as is", "currency", raw)
+	}
+}
@@ -0,0 +1,62 @@
+package marketwatch
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"$", "USD", true},
+		{"US$", "USD", true},
+		{"€", "EUR", true},
+		{"£", "GBP", true},
+		{"₽", "RUB", true},
+		{"руб.", "RUB", true},
+		{"RUR", "RUB", true},
+		{"¥", "CNY", true},
+		{"zł", "PLN", true},
+		{" usd ", "USD", true},
+		{"EUR", "EUR", true},
+		{"coins", "coins", false},
+		{"$$", "$$", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeCurrency(tt.raw)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeCurrency(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestItemCurrency(t *testing.T) {
+	// The warning is once per process.
+	unknownCurrencies.Delete("gems")
+	var buf strings.Builder
+	d, items := newTestWatcher(t, nil, nil)
+	d.logger = slog.New(slog.NewTextHandler(&buf, nil))
+	for _, currency := range []string{"€", "gems", "gems", "USD"} {
+		d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "ui_currency": "`+currency+`"}`))
+	}
+
+	tests := []struct{ currency, raw string }{
+		{"EUR", "€"},
+		{"gems", "gems"},
+		{"gems", "gems"},
+		{"USD", "USD"},
+	}
+	for _, tt := range tests {
+		if item := nextItem(t, items); item.Currency != tt.currency || item.RawCurrency != tt.raw {
+			t.Errorf("currency %q raw %q, want %q and %q", item.Currency, item.RawCurrency, tt.currency, tt.raw)
+		}
+	}
+	if n := strings.Count(buf.String(), "Unknown currency"); n != 1 {
+		t.Errorf("unknown currency warned %d times, want once", n)
+	}
+}
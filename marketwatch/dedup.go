@@ -0,0 +1,73 @@
+package marketwatch
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	DedupWindow     = 30 * time.Second
+	dedupMaxEntries = 100000
+)
+
+// Deduplication strategies for -dedup-strategy.
+const (
+	DedupExact = "exact"
+	DedupBloom = "bloom"
+)
+
+// deduper reports whether a key was seen recently, recording it if not.
+type deduper interface {
+	Seen(key string) bool
+}
+
+// dedupCache remembers item keys for a fixed window. All entries share the
+// same TTL, so insertion order is also expiry order and a FIFO list is enough
+// to evict them.
+type dedupCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type dedupEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{
+		window:  window,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Seen records key and reports whether it was already recorded within the
+// window. A repeat does not extend the original entry's lifetime.
+func (c *dedupCache) Seen(key string) bool {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict(now)
+	if _, ok := c.entries[key]; ok {
+		return true
+	}
+	c.entries[key] = c.order.PushBack(&dedupEntry{key: key, seenAt: now})
+	return false
+}
+
+func (c *dedupCache) evict(now time.Time) {
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		entry := front.Value.(*dedupEntry)
+		if now.Sub(entry.seenAt) < c.window && c.order.Len() < dedupMaxEntries {
+			return
+		}
+		c.order.Remove(front)
+		delete(c.entries, entry.key)
+	}
+}
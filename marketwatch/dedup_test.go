@@ -0,0 +1,48 @@
+package marketwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupSuppressesRepeats(t *testing.T) {
+	frame := feedFrame("newitems_go", `{"i_market_name": "M4A4 | Howl (Minimal Wear)", "ui_price": "5200", "ui_float": "0.09"}`)
+	tests := []struct {
+		name  string
+		dedup deduper
+		want  int
+	}{
+		{name: "exact", dedup: newDedupCache(time.Minute), want: 1},
+		{name: "bloom", dedup: newRotatingBloom(time.Minute, 1000, 0.001), want: 1},
+		{name: "disabled", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, items := newTestWatcher(t, nil, nil)
+			d.dedup = tt.dedup
+			d.processMessage(frame)
+			d.processMessage(frame)
+			for i := 0; i < tt.want; i++ {
+				nextItem(t, items)
+			}
+			noItem(t, items)
+		})
+	}
+}
+
+func TestDedupCacheWindow(t *testing.T) {
+	c := newDedupCache(50 * time.Millisecond)
+	if c.Seen("a") {
+		t.Fatal("first sighting reported as seen")
+	}
+	if !c.Seen("a") {
+		t.Fatal("repeat within the window not reported")
+	}
+	if c.Seen("b") {
+		t.Fatal("other key reported as seen")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if c.Seen("a") {
+		t.Fatal("key still seen after the window")
+	}
+}
@@ -0,0 +1,111 @@
+package marketwatch
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of a WebSocket dial, as labelled in the market_dial_phase_seconds
+// histogram.
+const (
+	DialPhaseDNS     = "dns"
+	DialPhaseConnect = "connect"
+	DialPhaseTLS     = "tls"
+	DialPhaseUpgrade = "upgrade"
+)
+
+// dialTrace times the phases of one dial through httptrace hooks. The net
+// dialer reports DNS and TCP connect, gorilla/websocket the TLS handshake
+// and the moment it has a connection; the upgrade is what follows until
+// the dial returns. With a SOCKS proxy the DNS and connect hooks don't
+// fire, since the proxy dialer does its own. Hooks can run concurrently
+// when several addresses are tried, hence the mutex.
+type dialTrace struct {
+	mu        sync.Mutex
+	start     time.Time
+	dnsStart  time.Time
+	dns       time.Duration
+	connStart time.Time
+	connect   time.Duration
+	tlsStart  time.Time
+	tls       time.Duration
+	gotConn   time.Time
+	upgrade   time.Duration
+	total     time.Duration
+}
+
+func newDialTrace(ctx context.Context) (*dialTrace, context.Context) {
+	t := &dialTrace{start: time.Now()}
+	return t, httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.since(&t.dns, t.dnsStart) },
+		ConnectStart: func(string, string) {
+			t.mark(&t.connStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.since(&t.connect, t.connStart)
+		},
+		TLSHandshakeStart: func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.since(&t.tls, t.tlsStart)
+		},
+		GotConn: func(httptrace.GotConnInfo) { t.mark(&t.gotConn) },
+	})
+}
+
+func (t *dialTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *dialTrace) since(d *time.Duration, start time.Time) {
+	t.mu.Lock()
+	if !start.IsZero() {
+		*d = time.Since(start)
+	}
+	t.mu.Unlock()
+}
+
+// done ends the trace once the dial has returned.
+func (t *dialTrace) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total = time.Since(t.start)
+	// GotConn fires before the TLS handshake; the upgrade starts after it.
+	if !t.gotConn.IsZero() {
+		t.upgrade = time.Since(t.gotConn) - t.tls
+	}
+}
+
+// phases returns the durations of the phases that happened.
+func (t *dialTrace) phases() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	phases := make(map[string]time.Duration)
+	for phase, d := range map[string]time.Duration{
+		DialPhaseDNS:     t.dns,
+		DialPhaseConnect: t.connect,
+		DialPhaseTLS:     t.tls,
+		DialPhaseUpgrade: t.upgrade,
+	} {
+		if d > 0 {
+			phases[phase] = d
+		}
+	}
+	return phases
+}
+
+func (t *dialTrace) attrs() []any {
+	phases := t.phases()
+	attrs := make([]any, 0, 2*len(phases)+2)
+	for _, phase := range []string{DialPhaseDNS, DialPhaseConnect, DialPhaseTLS, DialPhaseUpgrade} {
+		if d, ok := phases[phase]; ok {
+			attrs = append(attrs, phase, d)
+		}
+	}
+	return append(attrs, "total", t.total)
+}
@@ -0,0 +1,140 @@
+package marketwatch
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDialTraceHooks(t *testing.T) {
+	trace, ctx := newDialTrace(context.Background())
+	hooks := httptrace.ContextClientTrace(ctx)
+	step := func() { time.Sleep(5 * time.Millisecond) }
+
+	hooks.DNSStart(httptrace.DNSStartInfo{Host: "market.csgo.com"})
+	step()
+	hooks.DNSDone(httptrace.DNSDoneInfo{})
+	hooks.ConnectStart("tcp", "203.0.113.7:443")
+	step()
+	hooks.ConnectDone("tcp", "203.0.113.7:443", nil)
+	hooks.GotConn(httptrace.GotConnInfo{})
+	hooks.TLSHandshakeStart()
+	step()
+	hooks.TLSHandshakeDone(tls.ConnectionState{}, nil)
+	step()
+	trace.done()
+
+	phases := trace.phases()
+	for _, phase := range []string{DialPhaseDNS, DialPhaseConnect, DialPhaseTLS, DialPhaseUpgrade} {
+		if phases[phase] < 5*time.Millisecond {
+			t.Errorf("%s took %s, want at least 5ms", phase, phases[phase])
+		}
+	}
+	var sum time.Duration
+	for _, d := range phases {
+		sum += d
+	}
+	if sum > trace.total {
+		t.Errorf("phases add up to %s, more than the total %s", sum, trace.total)
+	}
+
+	// A hook that ends a phase that never started records nothing.
+	trace, ctx = newDialTrace(context.Background())
+	httptrace.ContextClientTrace(ctx).TLSHandshakeDone(tls.ConnectionState{}, nil)
+	trace.done()
+	if phases := trace.phases(); len(phases) != 0 {
+		t.Errorf("phases %v for an empty dial", phases)
+	}
+}
+
+func TestDialTiming(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conn.Close()
+		}
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(handler)
+	secure.Config.ErrorLog = log.New(io.Discard, "", 0)
+	secure.StartTLS()
+	defer secure.Close()
+	stopped := httptest.NewServer(handler)
+	stopped.Close()
+
+	caFile := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: secure.Certificate().Raw})))
+	tlsConfig, err := newTLSConfig(caFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test certificate names example.com; dialing localhost makes the
+	// resolver run.
+	tlsConfig.ServerName = "example.com"
+	_, dialer, err := newTransport("", tlsConfig, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localhost := func(url string) string {
+		return strings.Replace(url, "127.0.0.1", "localhost", 1)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		phases string
+		log    string
+	}{
+		{name: "ws by address", url: "ws" + strings.TrimPrefix(plain.URL, "http"), phases: "connect upgrade", log: "Dial timing"},
+		{name: "wss by name", url: localhost("wss" + strings.TrimPrefix(secure.URL, "https")), phases: "connect dns tls upgrade", log: "Dial timing"},
+		{name: "refused", url: "ws" + strings.TrimPrefix(stopped.URL, "http"), phases: "connect", log: "Dial failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestWatcher(t, nil, nil)
+			d.dialer = dialer
+			d.market.WSURL = tt.url + "/ws"
+			var out strings.Builder
+			d.logger = slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			conn, err := d.dial(context.Background())
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != (tt.log == "Dial failed") {
+				t.Fatalf("err = %v", err)
+			}
+			line := out.String()
+			if !strings.Contains(line, "msg=\""+tt.log+"\"") || !strings.Contains(line, " total=") {
+				t.Errorf("log %q, want %s with the total", line, tt.log)
+			}
+			var phases []string
+			for _, phase := range []string{DialPhaseDNS, DialPhaseConnect, DialPhaseTLS, DialPhaseUpgrade} {
+				if strings.Contains(line, " "+phase+"=") {
+					phases = append(phases, phase)
+				}
+			}
+			sort.Strings(phases)
+			if got := strings.Join(phases, " "); got != tt.phases {
+				t.Errorf("timed phases %q, want %q", got, tt.phases)
+			}
+			// One histogram per phase timed.
+			if n := testutil.CollectAndCount(d.metrics.dialPhases); n != len(phases) {
+				t.Errorf("%d histograms, want %d", n, len(phases))
+			}
+		})
+	}
+}
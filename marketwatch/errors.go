@@ -0,0 +1,50 @@
+package marketwatch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MaxAuthFailures is how many rejected tokens in a row Run tolerates before
+// giving up: a wrong API key will not start working on the next attempt.
+const MaxAuthFailures = 3
+
+// Errors returned by the watcher, wrapped with the underlying cause so
+// callers can tell them apart with errors.Is.
+var (
+	// ErrTokenAuth means the market answered but refused to issue a token.
+	ErrTokenAuth = errors.New("token rejected")
+	// ErrTokenNetwork covers transport errors, 5xx responses and unreadable
+	// bodies from the token endpoint; those are retried right away.
+	ErrTokenNetwork = errors.New("token request failed")
+	// ErrConnClosed means the WebSocket connection dropped while listening.
+	ErrConnClosed = errors.New("connection closed")
+	// ErrFeedStalled means the connection answered pings but delivered no
+	// messages for -idle-timeout.
+	ErrFeedStalled = errors.New("no messages received")
+	// ErrAlreadyListening means Listen was called while another Listen was
+	// still reading the connection.
+	ErrAlreadyListening = errors.New("connection is already being read")
+)
+
+// TokenStatusError is a non-2xx response from the token endpoint. It
+// unwraps to ErrTokenAuth for client errors, which retrying won't fix, and
+// to ErrTokenNetwork for server errors and rate limiting.
+type TokenStatusError struct {
+	StatusCode int
+	Status     string
+	// Body is the start of the response body.
+	Body string
+}
+
+func (e *TokenStatusError) Error() string {
+	return fmt.Sprintf("token endpoint returned %s", e.Status)
+}
+
+func (e *TokenStatusError) Unwrap() error {
+	if e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout {
+		return ErrTokenNetwork
+	}
+	return ErrTokenAuth
+}
@@ -0,0 +1,173 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTokenStatusErrorClassification(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, ErrTokenAuth},
+		{http.StatusUnauthorized, ErrTokenAuth},
+		{http.StatusForbidden, ErrTokenAuth},
+		{http.StatusNotFound, ErrTokenAuth},
+		{http.StatusRequestTimeout, ErrTokenNetwork},
+		{http.StatusTooManyRequests, ErrTokenNetwork},
+		{http.StatusInternalServerError, ErrTokenNetwork},
+		{http.StatusBadGateway, ErrTokenNetwork},
+		{http.StatusServiceUnavailable, ErrTokenNetwork},
+	}
+	for _, tt := range tests {
+		var err error = &TokenStatusError{StatusCode: tt.status, Status: http.StatusText(tt.status)}
+		wrapped := errors.Join(errors.New("token request"), err)
+		if !errors.Is(wrapped, tt.want) {
+			t.Errorf("status %d is not %v", tt.status, tt.want)
+		}
+		var serr *TokenStatusError
+		if !errors.As(wrapped, &serr) || serr.StatusCode != tt.status {
+			t.Errorf("status %d: errors.As found %v", tt.status, serr)
+		}
+	}
+}
+
+func TestRequestTokenErrors(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	tests := []struct {
+		name string
+		url  string
+		want error
+	}{
+		{name: "unreachable", url: closed.URL, want: ErrTokenNetwork},
+		{name: "rejected", url: tokenServer(t, http.StatusOK, `{"success": false, "error": "bad key"}`).URL, want: ErrTokenAuth},
+		{name: "unparsable", url: tokenServer(t, http.StatusOK, `<html>`).URL, want: ErrTokenNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestWatcher(t, nil, nil)
+			d.market.TokenURL = tt.url
+			err := d.requestToken(context.Background())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			other := ErrTokenAuth
+			if tt.want == ErrTokenAuth {
+				other = ErrTokenNetwork
+			}
+			if errors.Is(err, other) {
+				t.Errorf("err = %v is also %v", err, other)
+			}
+		})
+	}
+}
+
+func TestRequestTokenStatus(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("Service Unavailable ", 100) + "</body></html>"
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+		// snippet is the body the TokenStatusError keeps; empty for a 200.
+		snippet string
+	}{
+		{
+			name:    "401 with an error body",
+			status:  http.StatusUnauthorized,
+			body:    `{"success": false, "error": "invalid api key"}`,
+			want:    ErrTokenAuth,
+			snippet: `{"success": false, "error": "invalid api key"}`,
+		},
+		{
+			name:    "403 that looks successful",
+			status:  http.StatusForbidden,
+			body:    `{"success": true, "token": "stolen"}`,
+			want:    ErrTokenAuth,
+			snippet: `{"success": true, "token": "stolen"}`,
+		},
+		{
+			name:    "503 with an HTML page",
+			status:  http.StatusServiceUnavailable,
+			body:    page,
+			want:    ErrTokenNetwork,
+			snippet: page[:TokenErrorSnippet],
+		},
+		{name: "200 with malformed JSON", status: http.StatusOK, body: `{"success": true, "token": `, want: ErrTokenNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestWatcher(t, nil, nil)
+			var log bytes.Buffer
+			d.logger = slog.New(slog.NewTextHandler(&log, nil))
+			d.market.TokenURL = tokenServer(t, tt.status, tt.body).URL
+			err := d.requestToken(context.Background())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if token, _ := d.tokenState(); token != "" {
+				t.Errorf("token %q stored", token)
+			}
+			var serr *TokenStatusError
+			if tt.snippet == "" {
+				if errors.As(err, &serr) {
+					t.Errorf("err = %v for a 200", err)
+				}
+				return
+			}
+			if !errors.As(err, &serr) {
+				t.Fatalf("err = %v, want a TokenStatusError", err)
+			}
+			if serr.StatusCode != tt.status || !strings.HasPrefix(serr.Status, strconv.Itoa(tt.status)) || serr.Body != tt.snippet {
+				t.Errorf("got %d %q with body %q, want %d and %q", serr.StatusCode, serr.Status, serr.Body, tt.status, tt.snippet)
+			}
+			if !strings.Contains(log.String(), "Token endpoint error") || !strings.Contains(log.String(), strconv.Itoa(tt.status)) {
+				t.Errorf("log %q does not report the status", log.String())
+			}
+		})
+	}
+}
+
+func TestListenConnClosed(t *testing.T) {
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) { conn.Close() })
+	d, _ := newTestWatcher(t, srv, nil)
+	if err := d.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Listen(context.Background()); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("err = %v, want %v", err, ErrConnClosed)
+	}
+}
+
+func TestRunGivesUpOnRejectedKey(t *testing.T) {
+	srv := newFeedServer(t, nil)
+	cfg := DefaultConfig()
+	cfg.MaxRetries = -1
+	d, _ := newTestWatcher(t, srv, cfg)
+	var calls int
+	token := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"success": false, "error": "bad key"}`))
+	}))
+	defer token.Close()
+	d.market.TokenURL = token.URL
+
+	err := d.Run(context.Background())
+	if !errors.Is(err, ErrTokenAuth) {
+		t.Fatalf("err = %v, want %v", err, ErrTokenAuth)
+	}
+	if calls != MaxAuthFailures {
+		t.Errorf("%d token requests, want %d", calls, MaxAuthFailures)
+	}
+}
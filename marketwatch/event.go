@@ -0,0 +1,67 @@
+package marketwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// EventVersion is the version of the JSON output envelope. Bump it on any
+// change that breaks existing consumers.
+//
+// Version 2: stickers are objects with id, name and wear instead of ids.
+const EventVersion = 2
+
+const EventNewItem = "newitem"
+
+type Event struct {
+	V       int       `json:"v"`
+	Event   string    `json:"event"`
+	TS      time.Time `json:"ts"`
+	Market  string    `json:"market"`
+	Channel string    `json:"channel,omitempty"`
+	Item    *Item     `json:"item"`
+}
+
+// MarshalEvent encodes item as a newitem event, the line format written in
+// -format=json mode.
+func MarshalEvent(item *Item) ([]byte, error) {
+	return marshalEvent(EventNewItem, item, nil)
+}
+
+// writeEvent writes an encoded event to the output on its own line, or
+// indented over several lines with -json-indent or -format=json-pretty.
+func (d *MarketWatcher) writeEvent(line []byte) {
+	if indent := d.config.jsonIndent(); indent != "" {
+		var buf bytes.Buffer
+		if json.Indent(&buf, line, "", indent) == nil {
+			line = buf.Bytes()
+		}
+	}
+	d.out.Write(append(line, '\n'))
+}
+
+// marshalEvent encodes item in the envelope, its fields projected onto
+// fields unless that is nil.
+func marshalEvent(kind string, item *Item, fields fieldSet) ([]byte, error) {
+	ev := Event{
+		V:       EventVersion,
+		Event:   kind,
+		TS:      item.ReceivedAt.UTC(),
+		Market:  item.Market,
+		Channel: item.Channel,
+		Item:    item,
+	}
+	if fields == nil {
+		return json.Marshal(ev)
+	}
+	projected, err := fields.project(item)
+	if err != nil {
+		return nil, err
+	}
+	// The outer Item shadows the embedded one.
+	return json.Marshal(struct {
+		Event
+		Item json.RawMessage `json:"item"`
+	}{ev, projected})
+}
@@ -0,0 +1,140 @@
+package marketwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// itemFields maps the names -fields accepts onto the item's JSON keys.
+// Every key is accepted as is; "name" is the CSV column for market_name.
+var itemFields = map[string]string{
+	"id":              "id",
+	"name":            "market_name",
+	"market_name":     "market_name",
+	"quality":         "quality",
+	"price":           "price",
+	"currency":        "currency",
+	"raw_currency":    "raw_currency",
+	"float":           "float",
+	"stickers":        "stickers",
+	"inspect_url":     "inspect_url",
+	"paint_seed":      "paint_seed",
+	"paint_index":     "paint_index",
+	"listed_at":       "listed_at",
+	"classid":         "classid",
+	"instanceid":      "instanceid",
+	"image_url":       "image_url",
+	"attributes":      "attributes",
+	"high_priority":   "high_priority",
+	"floor_price":     "floor_price",
+	"new_low":         "new_low",
+	"reference_price": "reference_price",
+	"discount":        "discount",
+	"base_price":      "base_price",
+	"base_currency":   "base_currency",
+	"unconverted":     "unconverted",
+
+	"previous_price":   "previous_price",
+	"price_change_pct": "price_change_pct",
+}
+
+type outputField struct {
+	name string // as given, and the CSV column
+	key  string
+}
+
+// fieldSet is the -fields projection: the item fields written to JSON and
+// CSV output, in order. A nil set writes everything.
+type fieldSet []outputField
+
+func parseFields(names []string) (fieldSet, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	fields := make(fieldSet, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		key, ok := itemFields[name]
+		if !ok {
+			known := make([]string, 0, len(itemFields))
+			for name := range itemFields {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown field %q, want one of %s", name, strings.Join(known, ","))
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		fields = append(fields, outputField{name: name, key: key})
+	}
+	return fields, nil
+}
+
+func (f fieldSet) values(item *Item) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]json.RawMessage
+	err = json.Unmarshal(encoded, &values)
+	return values, err
+}
+
+// project encodes the fields of item in f as a JSON object. Fields the item
+// leaves out (empty optional ones) stay out.
+func (f fieldSet) project(item *Item) (json.RawMessage, error) {
+	values, err := f.values(item)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, field := range f {
+		value, ok := values[field.key]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (f fieldSet) header() []string {
+	header := []string{"timestamp"}
+	for _, field := range f {
+		header = append(header, field.name)
+	}
+	return header
+}
+
+// record is the CSV row for item: strings as they are, anything else as
+// its JSON text, and missing fields empty.
+func (f fieldSet) record(item *Item) ([]string, error) {
+	values, err := f.values(item)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]string, 0, len(f))
+	for _, field := range f {
+		value := values[field.key]
+		var text string
+		if json.Unmarshal(value, &text) != nil {
+			text = string(value)
+		}
+		record = append(record, text)
+	}
+	return record, nil
+}
@@ -0,0 +1,107 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// jsonKeys returns the keys of a JSON object in the order they appear.
+func jsonKeys(t *testing.T, data []byte) []string {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	if _, err := dec.Token(); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key.(string))
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestFieldSetProject(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{name: "subset", fields: []string{"name", "price", "float"}, want: "market_name price float"},
+		{name: "in the order given", fields: []string{"float", "price", "id"}, want: "float price id"},
+		{name: "aliases once", fields: []string{"name", " Market_Name ", "price"}, want: "market_name price"},
+		{name: "missing optional field", fields: []string{"name", "paint_seed", "discount"}, want: "market_name"},
+		{name: "stickers", fields: []string{"stickers"}, want: "stickers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := parseFields(tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			projected, err := fields.project(stickerItem())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(jsonKeys(t, projected), " "); got != tt.want {
+				t.Errorf("keys %q, want %q in %s", got, tt.want, projected)
+			}
+		})
+	}
+}
+
+func TestParseFieldsUnknown(t *testing.T) {
+	for _, names := range [][]string{{"name", "colour"}, {""}, {"price,float"}} {
+		if _, err := parseFields(names); err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Errorf("parseFields(%q) err = %v, want an unknown field", names, err)
+		}
+	}
+	if fields, err := parseFields(nil); fields != nil || err != nil {
+		t.Errorf("no names = %v, %v; want every field", fields, err)
+	}
+
+	_, err := loadConfig([]string{"-fields", "name,colour"}, env(map[string]string{"MARKET_API_KEY": "key"}))
+	if err == nil || !strings.Contains(err.Error(), `unknown field "colour"`) {
+		t.Errorf("err = %v, want the unknown field", err)
+	}
+}
+
+func TestMarshalEventFields(t *testing.T) {
+	item := stickerItem()
+	fields, err := parseFields([]string{"name", "price"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := marshalEvent(EventNewItem, item, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev struct {
+		Event string
+		Item  json.RawMessage
+	}
+	if err := json.Unmarshal(line, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(jsonKeys(t, ev.Item), " "); ev.Event != EventNewItem || got != "market_name price" {
+		t.Errorf("event %q with item keys %q, want the projected fields in %s", ev.Event, got, line)
+	}
+
+	line, err = marshalEvent(EventNewItem, item, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(line, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if keys := jsonKeys(t, ev.Item); len(keys) < 5 {
+		t.Errorf("unprojected item has keys %q, want every set field", keys)
+	}
+}
@@ -0,0 +1,212 @@
+package marketwatch
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func (d *MarketWatcher) matches(item *Item, filters *activeFilters) bool {
+	if !priceInRange(item.Price, filters.MinPrice, filters.MaxPrice) {
+		return false
+	}
+	if !currencyPriceAllowed(item, d.config.PriceFilter, d.config.StrictCurrency) {
+		return false
+	}
+	if d.config.RequireInspect && !isValidInspectURL(item.InspectURL) {
+		return false
+	}
+	if filters.expr != nil && !filters.expr.Match(item) {
+		return false
+	}
+	return floatInRange(item.Float, filters.MinFloat, filters.MaxFloat, d.config.RequireFloat)
+}
+
+// filtersActive reports whether the user narrowed the feed with any item
+// criteria. Items matching explicit criteria are never throttled.
+func (d *MarketWatcher) filtersActive(filters *activeFilters) bool {
+	c := d.config
+	return filters.any() || len(c.PriceFilter) > 0 || c.RequireFloat || c.RequireInspect ||
+		c.MinDiscount > 0
+}
+
+// inspectURLPattern matches CS inspect links as the feed sends them:
+// steam://rungame/730/<steamid>/+csgo_econ_action_preview followed by an
+// S (inventory) or M (market listing) owner id, the asset id and D param.
+// The space before the ids may be URL-encoded.
+var inspectURLPattern = regexp.MustCompile(`^steam://rungame/730/\d+/\+csgo_econ_action_preview(?: |%20)[SM]\d+A\d+D\d+$`)
+
+// isValidInspectURL expects the unescaped form parseItem produces; links
+// still carrying \/ escapes are rejected.
+func isValidInspectURL(u string) bool {
+	return inspectURLPattern.MatchString(u)
+}
+
+// qualityAliases maps the spellings and short codes the feed and users use
+// for i_quality onto one name. "--" is what the feed sends for items
+// without a special quality.
+var qualityAliases = map[string]string{
+	"":            "normal",
+	"--":          "normal",
+	"st":          "stattrak",
+	"stattrak™":   "stattrak",
+	"★":           "star",
+	"★ stattrak™": "star stattrak",
+	"sv":          "souvenir",
+}
+
+func normalizeQuality(q string) string {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if alias, ok := qualityAliases[q]; ok {
+		return alias
+	}
+	return q
+}
+
+// qualitySet builds the lookup for qualityAllowed from user input.
+func qualitySet(qualities []string) map[string]bool {
+	if len(qualities) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(qualities))
+	for _, q := range qualities {
+		set[normalizeQuality(q)] = true
+	}
+	return set
+}
+
+// qualityAllowed reports whether q is in set; an empty set allows all.
+func qualityAllowed(q string, set map[string]bool) bool {
+	return len(set) == 0 || set[normalizeQuality(q)]
+}
+
+// currencyFilter is the -currencies list: codes to watch, and codes
+// given as !CODE to skip. Entries are normalized like Item.Currency.
+type currencyFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func newCurrencyFilter(entries []string) *currencyFilter {
+	if len(entries) == 0 {
+		return nil
+	}
+	f := &currencyFilter{allow: make(map[string]bool), deny: make(map[string]bool)}
+	for _, entry := range entries {
+		if code, ok := strings.CutPrefix(entry, "!"); ok {
+			f.deny[code] = true
+		} else {
+			f.allow[entry] = true
+		}
+	}
+	return f
+}
+
+// Allowed reports whether items in currency pass; a nil filter passes all.
+func (f *currencyFilter) Allowed(currency string) bool {
+	if f == nil {
+		return true
+	}
+	if f.deny[currency] {
+		return false
+	}
+	return len(f.allow) == 0 || f.allow[currency]
+}
+
+// seedWanted reports whether the item's paint seed is one of seeds.
+func seedWanted(item *Item, seeds []int) bool {
+	if item.PaintSeed == nil {
+		return false
+	}
+	for _, seed := range seeds {
+		if seed == *item.PaintSeed {
+			return true
+		}
+	}
+	return false
+}
+
+// nameMatches reports whether name contains at least one include term (or
+// include is empty) and no exclude term. Matching is case-insensitive and
+// terms may use * as a wildcard.
+func nameMatches(name string, include, exclude []string) bool {
+	name = strings.ToLower(name)
+	for _, term := range exclude {
+		if containsPattern(name, strings.ToLower(term)) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, term := range include {
+		if containsPattern(name, strings.ToLower(term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPattern reports whether s contains pattern, where * in pattern
+// matches any run of characters.
+func containsPattern(s, pattern string) bool {
+	pos := 0
+	for _, part := range strings.Split(pattern, "*") {
+		if part == "" {
+			continue
+		}
+		i := strings.Index(s[pos:], part)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(part)
+	}
+	return true
+}
+
+// priceInRange reports whether price lies within [min, max]; a zero max
+// means there is no upper bound.
+func priceInRange(price, min, max float64) bool {
+	if price < min {
+		return false
+	}
+	return max <= 0 || price <= max
+}
+
+// currencyPriceAllowed checks the item's price against the band for its
+// currency. Currencies without a band pass unless strict is set.
+func currencyPriceAllowed(item *Item, bands priceFilter, strict bool) bool {
+	if len(bands) == 0 {
+		return true
+	}
+	band, ok := bands[strings.ToUpper(item.Currency)]
+	if !ok {
+		return !strict
+	}
+	return priceInRange(item.Price, band[0], band[1])
+}
+
+// floatInRange reports whether the float lies within [min, max]; a zero max
+// means no upper bound. Items without a float pass unless required is set.
+func floatInRange(value *float64, min, max float64, required bool) bool {
+	if value == nil {
+		return !required
+	}
+	if *value < min {
+		return false
+	}
+	return max <= 0 || *value <= max
+}
+
+// parsePrice parses a price string such as "1,234.56", ignoring thousands
+// separators and surrounding whitespace.
+func parsePrice(s string) (float64, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case ',', ' ', '\u00a0':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	return strconv.ParseFloat(cleaned, 64)
+}
@@ -0,0 +1,345 @@
+package marketwatch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPriceInRange(t *testing.T) {
+	tests := []struct {
+		price, min, max float64
+		want            bool
+	}{
+		{10, 10, 20, true},
+		{20, 10, 20, true},
+		{9.99, 10, 20, false},
+		{20.01, 10, 20, false},
+		{1e9, 10, 0, true},
+		{0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		if got := priceInRange(tt.price, tt.min, tt.max); got != tt.want {
+			t.Errorf("priceInRange(%g, %g, %g) = %v, want %v", tt.price, tt.min, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "12.50", want: 12.5},
+		{in: " 7 ", want: 7},
+		{in: "1,234.56", want: 1234.56},
+		{in: "1 234.56", want: 1234.56},
+		{in: "1 234", want: 1234},
+		{in: "", wantErr: true},
+		{in: "12.5 USD", wantErr: true},
+		{in: "twelve", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePrice(tt.in)
+		if (err != nil) != tt.wantErr || !tt.wantErr && got != tt.want {
+			t.Errorf("parsePrice(%q) = %g, %v; want %g, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseItemMalformedPrice(t *testing.T) {
+	for _, payload := range []string{
+		`{"i_market_name": "AK-47 | Slate (Minimal Wear)", "ui_price": "abc"}`,
+		`{"i_market_name": "AK-47 | Slate (Minimal Wear)", "ui_price": null}`,
+		`{"i_market_name": "AK-47 | Slate (Minimal Wear)", "ui_price": [1]}`,
+		`{"i_market_name": "AK-47 | Slate (Minimal Wear)"}`,
+	} {
+		_, err := parsePayload(t, "csgo", payload)
+		var perr *priceError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: err = %v, want a priceError", payload, err)
+		}
+	}
+}
+
+func TestFloatInRange(t *testing.T) {
+	tests := []struct {
+		value    *float64
+		min, max float64
+		required bool
+		want     bool
+	}{
+		{floatPtr(0.07), 0, 0.07, false, true},
+		{floatPtr(0.15), 0.15, 0.38, false, true},
+		{floatPtr(0.1499), 0.15, 0.38, false, false},
+		{floatPtr(0.99), 0.15, 0, false, true},
+		{nil, 0.15, 0.38, false, true},
+		{nil, 0.15, 0.38, true, false},
+	}
+	for _, tt := range tests {
+		if got := floatInRange(tt.value, tt.min, tt.max, tt.required); got != tt.want {
+			t.Errorf("floatInRange(%v, %g, %g, %v) = %v, want %v", tt.value, tt.min, tt.max, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestNameMatches(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             bool
+	}{
+		{"AK-47 | Redline (Field-Tested)", nil, nil, true},
+		{"AK-47 | Redline (Field-Tested)", []string{"ak-47"}, nil, true},
+		{"AK-47 | Redline (Field-Tested)", []string{"awp", "redline"}, nil, true},
+		{"AK-47 | Redline (Field-Tested)", []string{"awp"}, nil, false},
+		{"AK-47 | Redline (Field-Tested)", nil, []string{"field-tested"}, false},
+		{"AK-47 | Redline (Field-Tested)", []string{"ak-47"}, []string{"Redline"}, false},
+		{"AK-47 | Redline (Field-Tested)", []string{"ak*field"}, nil, true},
+		{"AK-47 | Redline (Field-Tested)", []string{"field*ak"}, nil, false},
+		{"StatTrak™ M4A1-S | Hyper Beast", []string{"*"}, nil, true},
+		{"Sticker | Crown (Foil)", []string{"AK-47"}, []string{"sticker"}, false},
+	}
+	for _, tt := range tests {
+		if got := nameMatches(tt.name, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("nameMatches(%q, %q, %q) = %v, want %v", tt.name, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestSeedWanted(t *testing.T) {
+	seeds := []int{661, 387}
+	tests := []struct {
+		seed *int
+		want bool
+	}{
+		{intPtr(661), true},
+		{intPtr(387), true},
+		{intPtr(1), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := seedWanted(&Item{PaintSeed: tt.seed}, seeds); got != tt.want {
+			t.Errorf("seedWanted(%v) = %v, want %v", tt.seed, got, tt.want)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Seeds = seeds
+	d, items := newTestWatcher(t, nil, cfg)
+	d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Case Hardened (Field-Tested)", "ui_price": "150", "ui_paintseed": 661}`))
+	d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Case Hardened (Field-Tested)", "ui_price": "150"}`))
+	if item := nextItem(t, items); !item.HighPriority {
+		t.Error("item with a wanted seed is not high priority")
+	}
+	if item := nextItem(t, items); item.HighPriority {
+		t.Error("item without a seed is high priority")
+	}
+}
+
+func TestQualityAllowed(t *testing.T) {
+	set := qualitySet([]string{"StatTrak", "SV", "normal"})
+	tests := []struct {
+		quality string
+		want    bool
+	}{
+		{"stattrak", true},
+		{"StatTrak™", true},
+		{"ST", true},
+		{" Souvenir ", true},
+		{"sv", true},
+		{"--", true},
+		{"", true},
+		{"★", false},
+		{"★ StatTrak™", false},
+		{"genuine", false},
+	}
+	for _, tt := range tests {
+		if got := qualityAllowed(tt.quality, set); got != tt.want {
+			t.Errorf("qualityAllowed(%q) = %v, want %v", tt.quality, got, tt.want)
+		}
+	}
+	if !qualityAllowed("genuine", qualitySet(nil)) {
+		t.Error("an empty set does not allow every quality")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Qualities = []string{"stattrak"}
+	d, items := newTestWatcher(t, nil, cfg)
+	d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "i_quality": "--"}`))
+	d.processMessage(feedFrame("newitems_go", `{"i_market_name": "StatTrak™ AK-47 | Redline (Field-Tested)", "ui_price": "30", "i_quality": "StatTrak™"}`))
+	if item := nextItem(t, items); item.Quality != "StatTrak™" {
+		t.Errorf("emitted quality %q, want StatTrak™", item.Quality)
+	}
+	noItem(t, items)
+}
+
+func TestIsValidInspectURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{`steam://rungame/730/76561202255233023/+csgo_econ_action_preview M4108481252793458462A29194971250D1156893335530217395`, true},
+		{`steam://rungame/730/76561202255233023/+csgo_econ_action_preview%20S76561198084749846A29194971250D1156893335530217395`, true},
+		{`steam:\/\/rungame\/730\/76561202255233023\/+csgo_econ_action_preview M4108481252793458462A29194971250D1156893335530217395`, false},
+		{`steam://rungame/730/76561202255233023/+csgo_econ_action_preview M%owner_steamid%A%assetid%D1156893335530217395`, false},
+		{`steam://rungame/570/76561202255233023/+csgo_econ_action_preview M4108481252793458462A29194971250D11568933355`, false},
+		{`https://steamcommunity.com/market/listings/730/AK-47`, false},
+		{`steam://rungame/730/76561202255233023/+csgo_econ_action_preview`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := isValidInspectURL(tt.url); got != tt.want {
+			t.Errorf("isValidInspectURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestRequireInspect(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RequireInspect = true
+	d, items := newTestWatcher(t, nil, cfg)
+	for _, link := range []string{
+		``,
+		`not a link`,
+		// The feed escapes slashes in JSON strings; parseItem undoes that.
+		`steam:\\/\\/rungame\\/730\\/76561202255233023\\/+csgo_econ_action_preview M4108481252793458462A29194971250D1156893335530217395`,
+	} {
+		d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "inspect_url": "`+link+`"}`))
+	}
+	item := nextItem(t, items)
+	if want := `steam://rungame/730/76561202255233023/+csgo_econ_action_preview M4108481252793458462A29194971250D1156893335530217395`; item.InspectURL != want {
+		t.Errorf("inspect URL %q, want %q", item.InspectURL, want)
+	}
+	noItem(t, items)
+}
+
+func TestCurrencyPriceAllowed(t *testing.T) {
+	bands := priceFilter{"USD": {5, 50}, "EUR": {4, 0}}
+	tests := []struct {
+		currency string
+		price    float64
+		strict   bool
+		want     bool
+	}{
+		{"USD", 5, false, true},
+		{"USD", 50.01, false, false},
+		{"usd", 20, false, true},
+		{"EUR", 3.99, false, false},
+		{"EUR", 4000, false, true},
+		{"RUB", 1, false, true},
+		{"RUB", 1, true, false},
+		{"USD", 20, true, true},
+	}
+	for _, tt := range tests {
+		item := &Item{Price: tt.price, Currency: tt.currency}
+		if got := currencyPriceAllowed(item, bands, tt.strict); got != tt.want {
+			t.Errorf("%g %s strict %v: got %v, want %v", tt.price, tt.currency, tt.strict, got, tt.want)
+		}
+	}
+	if !currencyPriceAllowed(&Item{Price: 1, Currency: "RUB"}, nil, true) {
+		t.Error("no bands rejected an item")
+	}
+
+	cfg := DefaultConfig()
+	cfg.PriceFilter = bands
+	cfg.StrictCurrency = true
+	d, items := newTestWatcher(t, nil, cfg)
+	for _, payload := range []string{
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "60", "ui_currency": "USD"}`,
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "1200", "ui_currency": "RUB"}`,
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "ui_currency": "EUR"}`,
+	} {
+		d.processMessage(feedFrame("newitems_go", payload))
+	}
+	if item := nextItem(t, items); item.Currency != "EUR" {
+		t.Errorf("emitted %g %s, want the EUR listing", item.Price, item.Currency)
+	}
+	noItem(t, items)
+}
+
+func TestCurrencyFilter(t *testing.T) {
+	tests := []struct {
+		entries []string
+		allowed map[string]bool
+	}{
+		{nil, map[string]bool{"USD": true, "RUB": true, "": true}},
+		{[]string{"USD", "EUR"}, map[string]bool{"USD": true, "EUR": true, "RUB": false, "": false}},
+		{[]string{"!RUB"}, map[string]bool{"USD": true, "RUB": false, "": true}},
+		{[]string{"USD", "!USD"}, map[string]bool{"USD": false, "EUR": false}},
+	}
+	for _, tt := range tests {
+		f := newCurrencyFilter(tt.entries)
+		for currency, want := range tt.allowed {
+			if got := f.Allowed(currency); got != want {
+				t.Errorf("%q: Allowed(%q) = %v, want %v", tt.entries, currency, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadConfigCurrencies(t *testing.T) {
+	tests := []struct {
+		flag    string
+		want    []string
+		wantErr string
+	}{
+		{flag: "USD,EUR", want: []string{"USD", "EUR"}},
+		{flag: " usd , €", want: []string{"USD", "EUR"}},
+		{flag: "!руб,$", want: []string{"!RUB", "USD"}},
+		{flag: "USD,dollars", wantErr: `unknown currency "dollars"`},
+		{flag: "!", wantErr: `unknown currency "!"`},
+	}
+	for _, tt := range tests {
+		cfg, err := loadConfig([]string{"-currencies", tt.flag}, env(map[string]string{"MARKET_API_KEY": "test-key"}))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("-currencies %q: err = %v, want %q", tt.flag, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("-currencies %q: %v", tt.flag, err)
+			continue
+		}
+		if got := []string(cfg.Currencies); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("-currencies %q = %q, want %q", tt.flag, got, tt.want)
+		}
+	}
+}
+
+func TestWatcherCurrencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		currencies []string
+		want       []string
+	}{
+		{name: "all", want: []string{"USD", "RUB", "EUR"}},
+		{name: "allow", currencies: []string{"USD", "EUR"}, want: []string{"USD", "EUR"}},
+		{name: "deny", currencies: []string{"!RUB"}, want: []string{"USD", "EUR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Currencies = tt.currencies
+			d, items := newTestWatcher(t, nil, cfg)
+			// The feed's symbols are normalized before the check.
+			for _, payload := range []string{
+				`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "ui_currency": "$"}`,
+				`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "1200", "ui_currency": "руб"}`,
+				`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "11", "ui_currency": "€"}`,
+			} {
+				d.processMessage(feedFrame("newitems_go", payload))
+			}
+			for _, want := range tt.want {
+				if item := nextItem(t, items); item.Currency != want {
+					t.Errorf("emitted %g %s, want the %s listing", item.Price, item.Currency, want)
+				}
+			}
+			noItem(t, items)
+		})
+	}
+}
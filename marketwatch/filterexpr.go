@@ -0,0 +1,427 @@
+package marketwatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A filter expression is a boolean condition over item fields, e.g.
+//
+//	price < 50 && name contains "AK-47" && (float < 0.07 || quality == "StatTrak™")
+//
+// Operators, loosest first: ||, &&, !, then the comparisons < <= > >= ==
+// != and contains (case-insensitive substring). A comparison involving a
+// field the item lacks, such as float on a sticker, is false.
+
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeNumber
+	typeString
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	default:
+		return "bool"
+	}
+}
+
+// exprFields are the item fields an expression can refer to. A getter
+// returns nil when the item has no value for the field.
+var exprFields = map[string]struct {
+	typ exprType
+	get func(*Item) interface{}
+}{
+	"name":     {typeString, func(i *Item) interface{} { return i.MarketName }},
+	"quality":  {typeString, func(i *Item) interface{} { return i.Quality }},
+	"currency": {typeString, func(i *Item) interface{} { return i.Currency }},
+	"market":   {typeString, func(i *Item) interface{} { return i.Market }},
+	"price":    {typeNumber, func(i *Item) interface{} { return i.Price }},
+	"float": {typeNumber, func(i *Item) interface{} {
+		if i.Float == nil {
+			return nil
+		}
+		return *i.Float
+	}},
+	"seed": {typeNumber, func(i *Item) interface{} {
+		if i.PaintSeed == nil {
+			return nil
+		}
+		return float64(*i.PaintSeed)
+	}},
+	"discount": {typeNumber, func(i *Item) interface{} {
+		if i.Discount == nil {
+			return nil
+		}
+		return *i.Discount
+	}},
+	"stickers": {typeNumber, func(i *Item) interface{} { return float64(len(i.Stickers)) }},
+	AttrPhase:  {typeString, stringAttr(AttrPhase)},
+	AttrFade:   {typeNumber, numberAttr(AttrFade)},
+	AttrBlue:   {typeNumber, numberAttr(AttrBlue)},
+}
+
+type exprNode interface {
+	typ() exprType
+	eval(*Item) interface{}
+}
+
+// itemFilter is a compiled expression.
+type itemFilter struct {
+	root exprNode
+}
+
+func (f *itemFilter) Match(item *Item) bool {
+	v, _ := f.root.eval(item).(bool)
+	return v
+}
+
+// compileFilter parses src; the errors point at the offending token so a
+// typo fails at startup rather than silently matching nothing.
+func compileFilter(src string) (*itemFilter, error) {
+	tokens, err := lexFilter(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("filter: unexpected %q at %d", tok.text, tok.pos)
+	}
+	if root.typ() != typeBool {
+		return nil, fmt.Errorf("filter: expression is a %s, not a condition", root.typ())
+	}
+	return &itemFilter{root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexFilter(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c, width := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += width
+		case c == '(' || c == ')':
+			kind := tokLParen
+			if c == ')' {
+				kind = tokRParen
+			}
+			tokens = append(tokens, token{kind, string(c), i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("filter: unterminated string at %d", i)
+			}
+			s, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("filter: invalid string at %d: %v", i, err)
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i = end + 1
+		case c >= '0' && c <= '9' || c == '.':
+			end := i
+			for end < len(src) && (src[end] >= '0' && src[end] <= '9' || src[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokNumber, src[i:end], i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(src) {
+				r, n := utf8.DecodeRuneInString(src[end:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				end += n
+			}
+			tokens = append(tokens, token{tokIdent, src[i:end], i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("filter: unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(src)}), nil
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token { return p.tokens[p.pos] }
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "||" && p.peek().kind == tokOp {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newLogical(tok, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "&&" && p.peek().kind == tokOp {
+		tok := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newLogical(tok, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == "!" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if operand.typ() != typeBool {
+			return nil, fmt.Errorf("filter: ! needs a condition at %d", tok.pos)
+		}
+		return notNode{operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.kind == tokIdent && tok.text != "contains" {
+		return nil, fmt.Errorf("filter: unknown operator %q at %d", tok.text, tok.pos)
+	}
+	isComparison := tok.kind == tokOp && tok.text != "&&" && tok.text != "||" && tok.text != "!"
+	if !isComparison && !(tok.kind == tokIdent && tok.text == "contains") {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if left.typ() != right.typ() {
+		return nil, fmt.Errorf("filter: cannot compare %s with %s at %d", left.typ(), right.typ(), tok.pos)
+	}
+	if tok.text == "contains" && left.typ() != typeString {
+		return nil, fmt.Errorf("filter: contains needs strings at %d", tok.pos)
+	}
+	if left.typ() == typeBool && tok.text != "==" && tok.text != "!=" {
+		return nil, fmt.Errorf("filter: %s does not apply to conditions at %d", tok.text, tok.pos)
+	}
+	return compareNode{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid number %q at %d", tok.text, tok.pos)
+		}
+		return literalNode{typeNumber, n}, nil
+	case tokString:
+		return literalNode{typeString, tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return literalNode{typeBool, tok.text == "true"}, nil
+		}
+		field, ok := exprFields[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("filter: unknown field %q at %d", tok.text, tok.pos)
+		}
+		return fieldNode{field.typ, field.get}, nil
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("filter: expected ) at %d, got %q", closing.pos, closing.text)
+		}
+		return inner, nil
+	default:
+		return nil, fmt.Errorf("filter: unexpected %q at %d", tok.text, tok.pos)
+	}
+}
+
+type literalNode struct {
+	t exprType
+	v interface{}
+}
+
+func (n literalNode) typ() exprType          { return n.t }
+func (n literalNode) eval(*Item) interface{} { return n.v }
+
+type fieldNode struct {
+	t   exprType
+	get func(*Item) interface{}
+}
+
+func (n fieldNode) typ() exprType               { return n.t }
+func (n fieldNode) eval(item *Item) interface{} { return n.get(item) }
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n notNode) typ() exprType { return typeBool }
+func (n notNode) eval(item *Item) interface{} {
+	v, _ := n.operand.eval(item).(bool)
+	return !v
+}
+
+type logicalNode struct {
+	and         bool
+	left, right exprNode
+}
+
+func newLogical(tok token, left, right exprNode) (exprNode, error) {
+	if left.typ() != typeBool || right.typ() != typeBool {
+		return nil, fmt.Errorf("filter: %s needs conditions on both sides at %d", tok.text, tok.pos)
+	}
+	return logicalNode{and: tok.text == "&&", left: left, right: right}, nil
+}
+
+func (n logicalNode) typ() exprType { return typeBool }
+func (n logicalNode) eval(item *Item) interface{} {
+	left, _ := n.left.eval(item).(bool)
+	if left != n.and {
+		return left
+	}
+	right, _ := n.right.eval(item).(bool)
+	return right
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n compareNode) typ() exprType { return typeBool }
+func (n compareNode) eval(item *Item) interface{} {
+	left, right := n.left.eval(item), n.right.eval(item)
+	if left == nil || right == nil {
+		return false
+	}
+	switch l := left.(type) {
+	case float64:
+		r := right.(float64)
+		switch n.op {
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		case ">=":
+			return l >= r
+		case "==":
+			return l == r
+		case "!=":
+			return l != r
+		}
+	case string:
+		r := right.(string)
+		switch n.op {
+		case "contains":
+			return strings.Contains(strings.ToLower(l), strings.ToLower(r))
+		case "==":
+			return strings.EqualFold(l, r)
+		case "!=":
+			return !strings.EqualFold(l, r)
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		case ">=":
+			return l >= r
+		}
+	case bool:
+		r := right.(bool)
+		if n.op == "==" {
+			return l == r
+		}
+		return l != r
+	}
+	return false
+}
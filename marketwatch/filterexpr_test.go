@@ -0,0 +1,150 @@
+package marketwatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterExpression(t *testing.T) {
+	redline := &Item{MarketName: "AK-47 | Redline (Field-Tested)", Quality: "StatTrak™", Price: 30, Currency: "USD", Float: floatPtr(0.05)}
+	sticker := &Item{MarketName: "Sticker | Crown (Foil)", Quality: "--", Price: 800, Currency: "USD"}
+	tests := []struct {
+		expr    string
+		redline bool
+		sticker bool
+	}{
+		{`price < 50`, true, false},
+		{`price < 50 && name contains "ak-47" && float < 0.07`, true, false},
+		{`name contains "AK-47" || name contains "Crown"`, true, true},
+		{`quality == "stattrak™"`, true, false},
+		{`quality != "StatTrak™"`, false, true},
+		// A missing float makes the comparison false either way.
+		{`float < 0.07`, true, false},
+		{`!(float < 0.07)`, false, true},
+		{`!(float >= 0.07)`, true, true},
+		// && binds tighter than ||.
+		{`price > 100 || price < 50 && float < 0.01`, false, true},
+		{`(price > 100 || price < 50) && float < 0.01`, false, false},
+		{`price > 100 && price < 1000 || name contains "redline"`, true, true},
+		{`price > 100`, false, true},
+		{`!(price > 100) && !(name contains "crown")`, true, false},
+		{`stickers == 0 && currency == "usd"`, true, true},
+		{`(price < 50) == true`, true, false},
+		{`true`, true, true},
+	}
+	for _, tt := range tests {
+		f, err := compileFilter(tt.expr)
+		if err != nil {
+			t.Errorf("compileFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(redline); got != tt.redline {
+			t.Errorf("%s on the Redline = %v, want %v", tt.expr, got, tt.redline)
+		}
+		if got := f.Match(sticker); got != tt.sticker {
+			t.Errorf("%s on the sticker = %v, want %v", tt.expr, got, tt.sticker)
+		}
+	}
+}
+
+func TestFilterExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`price <`, "unexpected"},
+		{`price < 50 &&`, "unexpected"},
+		{`colour == "red"`, `unknown field "colour"`},
+		{`price < "50"`, "cannot compare number with string"},
+		{`price contains 5`, "contains needs strings"},
+		{`name like "AK"`, `unknown operator "like"`},
+		{`(price < 50`, "expected )"},
+		{`price < 50)`, "unexpected"},
+		{`name == "AK`, "unterminated string"},
+		{`price`, "not a condition"},
+		{`!price`, "! needs a condition"},
+		{`price < 1.2.3`, "invalid number"},
+		{`price < 50 & float < 1`, "unexpected"},
+		{`(price < 50) < true`, "does not apply to conditions"},
+	}
+	for _, tt := range tests {
+		_, err := compileFilter(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("compileFilter(%q) err = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestLexFilterUnicode(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    []string
+		wantErr string
+	}{
+		{src: `name == "★ Karambit | Fade"`, want: []string{"name", "==", "★ Karambit | Fade"}},
+		{src: `name contains "Сувенир"&&price<5`, want: []string{"name", "contains", "Сувенир", "&&", "price", "<", "5"}},
+		// Letters outside ASCII make up identifiers, whole.
+		{src: `цена < 5`, want: []string{"цена", "<", "5"}},
+		// A no-break space separates tokens like a space.
+		{src: "price\u00a0< 5", want: []string{"price", "<", "5"}},
+		{src: `★ == "x"`, wantErr: `unexpected '★' at 0`},
+		{src: `price < 5 ≤ 6`, wantErr: `unexpected '≤' at 10`},
+	}
+	for _, tt := range tests {
+		tokens, err := lexFilter(tt.src)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("lexFilter(%q) err = %v, want %q", tt.src, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("lexFilter(%q): %v", tt.src, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens[:len(tokens)-1] {
+			got = append(got, tok.text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lexFilter(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	// Through to a match: the unknown field is reported by its full name.
+	if _, err := compileFilter(`naмe == "x"`); err == nil || !strings.Contains(err.Error(), `unknown field "naмe"`) {
+		t.Errorf("err = %v, want the whole identifier", err)
+	}
+	f, err := compileFilter(`name contains "★ karambit" && price > 100`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(&Item{MarketName: "★ Karambit | Fade (Factory New)", Price: 900}) {
+		t.Error("knife does not match")
+	}
+}
+
+func TestWatcherFilterExpression(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Filter = `price < 50 && name contains "AK-47"`
+	d, items := newTestWatcher(t, nil, cfg)
+	for _, payload := range []string{
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "60"}`,
+		`{"i_market_name": "AWP | Asiimov (Field-Tested)", "ui_price": "40"}`,
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "30"}`,
+	} {
+		d.processMessage(feedFrame("newitems_go", payload))
+	}
+	if item := nextItem(t, items); item.Price != 30 {
+		t.Errorf("emitted %s at %g, want the AK-47 at 30", item.MarketName, item.Price)
+	}
+	noItem(t, items)
+}
+
+func TestLoadConfigRejectsFilter(t *testing.T) {
+	_, err := loadConfig([]string{"-filter", `price < 50 && colour == "red"`}, env(map[string]string{"MARKET_API_KEY": "key"}))
+	if err == nil || !strings.Contains(err.Error(), `unknown field "colour" at 14`) {
+		t.Errorf("err = %v, want the unknown field and its position", err)
+	}
+}
@@ -0,0 +1,160 @@
+package marketwatch
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	FloatCheckTimeout     = 3 * time.Second
+	FloatCheckConcurrency = 4
+	MaxFloatCheckBody     = 64 << 10
+	floatCacheMaxEntries  = 50000
+)
+
+// floatChecker looks up the floats the feed leaves out on a float-checker
+// service, which inspects the item in game: it is asked GET
+// <endpoint>?url=<inspect link> and answers {"iteminfo": {"floatvalue":
+// 0.15}} like the csfloat inspect API, or just {"floatvalue": 0.15}. An
+// item's float never changes, so answers are cached by inspect link until
+// floatCacheMaxEntries pushes the oldest out; failures are not cached.
+type floatChecker struct {
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+	slots    chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // oldest first
+}
+
+type cachedFloat struct {
+	inspect string
+	value   float64
+}
+
+// newFloatChecker sends its requests through transport, the one shared
+// with the token requests, so the proxy and TLS settings apply here too.
+func newFloatChecker(endpoint string, transport http.RoundTripper, timeout time.Duration, concurrency int) *floatChecker {
+	return &floatChecker{
+		endpoint: endpoint,
+		client:   &http.Client{Transport: transport},
+		timeout:  timeout,
+		slots:    make(chan struct{}, concurrency),
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Float returns the float for an inspect link, from the cache or the
+// service. Waiting for one of the concurrent slots counts against the
+// timeout.
+func (c *floatChecker) Float(ctx context.Context, inspect string) (value float64, cached bool, err error) {
+	if value, ok := c.cached(inspect); ok {
+		return value, true, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	select {
+	case c.slots <- struct{}{}:
+		defer func() { <-c.slots }()
+	case <-ctx.Done():
+		return 0, false, fmt.Errorf("float checker busy: %w", ctx.Err())
+	}
+
+	value, err = c.fetch(ctx, inspect)
+	if err != nil {
+		return 0, false, err
+	}
+	c.store(inspect, value)
+	return value, false, nil
+}
+
+func (c *floatChecker) fetch(ctx context.Context, inspect string) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"?url="+url.QueryEscape(inspect), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("float checker returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxFloatCheckBody))
+	if err != nil {
+		return 0, err
+	}
+	var data struct {
+		ItemInfo *struct {
+			FloatValue *float64 `json:"floatvalue"`
+		} `json:"iteminfo"`
+		FloatValue *float64 `json:"floatvalue"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0, err
+	}
+	value := data.FloatValue
+	if data.ItemInfo != nil && data.ItemInfo.FloatValue != nil {
+		value = data.ItemInfo.FloatValue
+	}
+	if value == nil {
+		return 0, errors.New("float checker answer has no floatvalue")
+	}
+	if *value < 0 || *value > 1 {
+		return 0, fmt.Errorf("float checker returned float %g out of range", *value)
+	}
+	return *value, nil
+}
+
+func (c *floatChecker) cached(inspect string) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[inspect]; ok {
+		return elem.Value.(*cachedFloat).value, true
+	}
+	return 0, false
+}
+
+func (c *floatChecker) store(inspect string, value float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[inspect]; ok {
+		return
+	}
+	c.entries[inspect] = c.order.PushBack(&cachedFloat{inspect: inspect, value: value})
+	for c.order.Len() > floatCacheMaxEntries {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedFloat).inspect)
+	}
+}
+
+// lookupFloat fills in the float of an item sent without one. When the
+// lookup fails, or shutdown cuts it short, the item goes on as it is.
+func (d *MarketWatcher) lookupFloat(item *Item) {
+	value, cached, err := d.floats.Float(d.ctx, item.InspectURL)
+	switch {
+	case err != nil:
+		d.metrics.floatChecks.WithLabelValues("failed").Inc()
+		d.logger.Debug("Float lookup failed", "market_name", item.MarketName, "err", err)
+		return
+	case cached:
+		d.metrics.floatChecks.WithLabelValues("cached").Inc()
+	default:
+		d.metrics.floatChecks.WithLabelValues("found").Inc()
+	}
+	item.Float = &value
+}
@@ -0,0 +1,331 @@
+package marketwatch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// floatStub stands in for the float-checker service, answering each
+// inspect link with the body in answers, or 404.
+type floatStub struct {
+	*httptest.Server
+	requests atomic.Int32
+	answers  map[string]string
+	// stall, when set, blocks requests until it is closed.
+	stall chan struct{}
+}
+
+func newFloatStub(t *testing.T, answers map[string]string) *floatStub {
+	t.Helper()
+	s := &floatStub{answers: answers}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.stall != nil {
+			select {
+			case <-s.stall:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		body, ok := s.answers[r.URL.Query().Get("url")]
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case strings.HasPrefix(body, "status "):
+			var code int
+			fmt.Sscanf(body, "status %d", &code)
+			w.WriteHeader(code)
+		default:
+			fmt.Fprint(w, body)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *floatStub) checker(timeout time.Duration, concurrency int) *floatChecker {
+	return newFloatChecker(s.URL+"/inspect", http.DefaultTransport, timeout, concurrency)
+}
+
+func TestFloatChecker(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    float64
+		wantErr string
+	}{
+		{name: "iteminfo", answer: `{"iteminfo": {"floatvalue": 0.1523, "paintseed": 661}}`, want: 0.1523},
+		{name: "bare", answer: `{"floatvalue": 0.07}`, want: 0.07},
+		{name: "both", answer: `{"floatvalue": 0.5, "iteminfo": {"floatvalue": 0.25}}`, want: 0.25},
+		{name: "zero", answer: `{"iteminfo": {"floatvalue": 0}}`, want: 0},
+		{name: "server error", answer: "status 500", wantErr: "500 Internal Server Error"},
+		{name: "unknown link", wantErr: "404 Not Found"},
+		{name: "no float", answer: `{"iteminfo": {"paintseed": 661}}`, wantErr: "no floatvalue"},
+		{name: "out of range", answer: `{"floatvalue": 1.5}`, wantErr: "out of range"},
+		{name: "not json", answer: `<html>busy</html>`, wantErr: "invalid character"},
+	}
+	answers := make(map[string]string)
+	for _, tt := range tests {
+		if tt.answer != "" {
+			answers["steam://inspect "+tt.name] = tt.answer
+		}
+	}
+	stub := newFloatStub(t, answers)
+	c := stub.checker(time.Second, 2)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspect := "steam://inspect " + tt.name
+			before := stub.requests.Load()
+			// Answers are cached, failures asked for again.
+			for i := 0; i < 2; i++ {
+				value, cached, err := c.Float(context.Background(), inspect)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Errorf("lookup %d: got %g, %v; want error %q", i, value, err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil || value != tt.want || cached != (i == 1) {
+					t.Errorf("lookup %d: got %g, cached %v, %v; want %g", i, value, cached, err, tt.want)
+				}
+			}
+			want := int32(1)
+			if tt.wantErr != "" {
+				want = 2
+			}
+			if got := stub.requests.Load() - before; got != want {
+				t.Errorf("%d requests to the checker, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestFloatCheckerLimits(t *testing.T) {
+	answers := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		answers[fmt.Sprintf("link %d", i)] = `{"floatvalue": 0.3}`
+	}
+	stub := newFloatStub(t, answers)
+	stub.stall = make(chan struct{})
+	c := stub.checker(time.Minute, 2)
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			_, _, err := c.Float(context.Background(), fmt.Sprintf("link %d", i))
+			done <- err
+		}(i)
+	}
+	waitFor(t, "two lookups in flight", func() bool { return stub.requests.Load() == 2 })
+
+	// With both slots taken the rest give up waiting at their deadline.
+	for i := 2; i < 6; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, _, err := c.Float(ctx, fmt.Sprintf("link %d", i))
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), "float checker busy") {
+			t.Errorf("link %d: err = %v, want busy", i, err)
+		}
+	}
+	if got := stub.requests.Load(); got != 2 {
+		t.Errorf("%d requests to the checker, want 2", got)
+	}
+
+	// The timeout covers a stalled service.
+	start := time.Now()
+	if _, _, err := stub.checker(100*time.Millisecond, 1).Float(context.Background(), "link 5"); err == nil || strings.Contains(err.Error(), "busy") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stalled lookup returned after %s", elapsed)
+	}
+
+	close(stub.stall)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("in-flight lookup: %v", err)
+		}
+	}
+}
+
+func TestWatcherFloatLookup(t *testing.T) {
+	const item = `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "%s", "inspect_url": "steam://rungame/730/76561202255233023/+csgo_econ_action_preview M%dA1D1"%s}`
+	tests := []struct {
+		name  string
+		price string
+		link  int
+		float string // ui_float the feed sends, if any
+		// want is the emitted float, -1 for no float; 0 means not emitted.
+		want    float64
+		lookups map[string]float64
+	}{
+		{name: "found", price: "12", link: 1, want: 0.2, lookups: map[string]float64{"found": 1}},
+		{name: "cached", price: "12", link: 1, want: 0.2, lookups: map[string]float64{"cached": 1}},
+		// Above -max-float once looked up.
+		{name: "filtered by float", price: "12", link: 2, lookups: map[string]float64{"found": 1}},
+		{name: "checker fails", price: "12", link: 3, want: -1, lookups: map[string]float64{"failed": 1}},
+		{name: "sent with a float", price: "12", link: 4, float: `, "ui_float": "0.11"`, want: 0.11},
+		// Dropped by the price filter before any lookup.
+		{name: "too expensive", price: "900", link: 5},
+	}
+	stub := newFloatStub(t, map[string]string{
+		"steam://rungame/730/76561202255233023/+csgo_econ_action_preview M1A1D1": `{"iteminfo": {"floatvalue": 0.2}}`,
+		"steam://rungame/730/76561202255233023/+csgo_econ_action_preview M2A1D1": `{"iteminfo": {"floatvalue": 0.9}}`,
+		"steam://rungame/730/76561202255233023/+csgo_econ_action_preview M3A1D1": "status 503",
+		"steam://rungame/730/76561202255233023/+csgo_econ_action_preview M5A1D1": `{"iteminfo": {"floatvalue": 0.2}}`,
+	})
+	cfg := DefaultConfig()
+	cfg.MaxPrice = 100
+	cfg.MaxFloat = 0.5
+	d, items := newTestWatcher(t, nil, cfg)
+	d.floats = stub.checker(time.Second, 1)
+	d.ctx = context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := map[string]float64{}
+			for _, result := range []string{"found", "cached", "failed"} {
+				before[result] = testutil.ToFloat64(d.metrics.floatChecks.WithLabelValues(result))
+			}
+			d.processMessage(feedFrame("newitems_go", fmt.Sprintf(item, tt.price, tt.link, tt.float)))
+			switch {
+			case tt.want == 0:
+				noItem(t, items)
+			case tt.want < 0:
+				if got := nextItem(t, items); got.Float != nil {
+					t.Errorf("emitted float %g, want none", *got.Float)
+				}
+			default:
+				if got := nextItem(t, items); got.Float == nil || *got.Float != tt.want {
+					t.Errorf("emitted float %v, want %g", got.Float, tt.want)
+				}
+			}
+			for result, n := range before {
+				if got := testutil.ToFloat64(d.metrics.floatChecks.WithLabelValues(result)) - n; got != tt.lookups[result] {
+					t.Errorf("%g %s lookups, want %g", got, result, tt.lookups[result])
+				}
+			}
+		})
+	}
+	if got := stub.requests.Load(); got != 3 {
+		t.Errorf("%d requests to the checker, want 3", got)
+	}
+}
+
+// idPublisher hands what is published to a channel.
+type idPublisher chan []byte
+
+func (p idPublisher) Publish(subject string, data []byte) error {
+	p <- data
+	return nil
+}
+
+func (p idPublisher) Close() error { return nil }
+
+// keyRecorder records the keys a deduper is asked about.
+type keyRecorder struct {
+	deduper
+	keys []string
+}
+
+func (r *keyRecorder) Seen(key string) bool {
+	r.keys = append(r.keys, key)
+	return r.deduper.Seen(key)
+}
+
+func TestFloatLookupKeepsID(t *testing.T) {
+	const inspect = "steam://rungame/730/76561202255233023/+csgo_econ_action_preview M1A1D1"
+	listing := feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "inspect_url": "`+inspect+`"}`)
+	failing := newFloatStub(t, map[string]string{inspect: "status 503"})
+	working := newFloatStub(t, map[string]string{inspect: `{"iteminfo": {"floatvalue": 0.2}}`})
+
+	path := filepath.Join(t.TempDir(), "items.db")
+	store, err := NewSQLiteStore(path, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, items := newTestWatcher(t, nil, nil)
+	d.ctx = context.Background()
+	dedup := &keyRecorder{deduper: newDedupCache(time.Hour)}
+	d.dedup = dedup
+	published := make(idPublisher, 4)
+	queue := newPublishQueue(published, d.metrics, testLogger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+	d.sinks = newSinkFanOut(d.metrics, testLogger)
+	d.sinks.Register("publish", SinkParsed, queue)
+	d.sinks.Register("store", SinkFiltered, storeSink{store})
+	d.sinks.Start(ctx)
+
+	// The lookup works the first time the listing comes in and fails once
+	// dedup has forgotten it: still one listing, and one row.
+	d.floats = working.checker(time.Second, 1)
+	d.processMessage(listing)
+	emitted := nextItem(t, items)
+	if emitted.Float == nil {
+		t.Fatal("float not looked up")
+	}
+	dedup.deduper = newDedupCache(time.Hour)
+	d.floats = failing.checker(time.Second, 1)
+	d.processMessage(listing)
+	if again := nextItem(t, items); again.ID() != emitted.ID() {
+		t.Errorf("relisting without the float has ID %s, want %s", again.ID(), emitted.ID())
+	}
+	d.sinks.Close()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := emitted.ID()
+	for i, key := range dedup.keys {
+		if key != want {
+			t.Errorf("dedup key %d is %s, want %s", i, key, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		var ev struct {
+			Item struct{ ID string }
+		}
+		if err := json.Unmarshal(<-published, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Item.ID != want {
+			t.Errorf("published id %d is %s, want %s", i, ev.Item.ID, want)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var ids []string
+	rows, err := db.Query(`SELECT item_id FROM items`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 1 || ids[0] != want {
+		t.Errorf("stored ids %q, want only %s", ids, want)
+	}
+}
@@ -0,0 +1,82 @@
+package marketwatch
+
+import (
+	"strings"
+)
+
+// FloatBuckets splits the 0-1 float range into fixed-width buckets; the
+// histogram memory is the same no matter how many items go through it.
+const FloatBuckets = 1000
+
+// floatWearBuckets are the Prometheus buckets for item floats, following
+// the wear tier boundaries with extra resolution at the low end.
+var floatWearBuckets = []float64{0.01, 0.02, 0.03, 0.05, 0.07, 0.1, 0.15, 0.2, 0.3, 0.38, 0.45, 0.6, 0.8, 1}
+
+type floatHistogram struct {
+	counts [FloatBuckets]int64
+	count  int64
+	min    float64
+	max    float64
+}
+
+type FloatStats struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	P1    float64 `json:"p1"`
+	P50   float64 `json:"p50"`
+	P99   float64 `json:"p99"`
+}
+
+func (h *floatHistogram) add(value float64) {
+	h.count++
+	if h.count == 1 || value < h.min {
+		h.min = value
+	}
+	if h.count == 1 || value > h.max {
+		h.max = value
+	}
+	bucket := int(value * FloatBuckets)
+	bucket = max(0, min(bucket, FloatBuckets-1))
+	h.counts[bucket]++
+}
+
+// percentile returns the midpoint of the bucket holding the p-th percentile,
+// clamped to the exact min and max seen.
+func (h *floatHistogram) percentile(p float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(p / 100 * float64(h.count))
+	rank = max(1, min(rank, h.count))
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			mid := (float64(i) + 0.5) / FloatBuckets
+			return max(h.min, min(mid, h.max))
+		}
+	}
+	return h.max
+}
+
+func (h *floatHistogram) stats() FloatStats {
+	return FloatStats{
+		Count: h.count,
+		Min:   h.min,
+		Max:   h.max,
+		P1:    h.percentile(1),
+		P50:   h.percentile(50),
+		P99:   h.percentile(99),
+	}
+}
+
+// itemCategory is the weapon or item type, e.g. "AK-47" for
+// "StatTrak™ AK-47 | Redline (Field-Tested)".
+func itemCategory(name string) string {
+	category, _, _ := strings.Cut(name, " | ")
+	category = strings.TrimPrefix(category, "★ ")
+	category = strings.TrimPrefix(category, "StatTrak™ ")
+	category = strings.TrimPrefix(category, "Souvenir ")
+	return strings.TrimSpace(category)
+}
@@ -0,0 +1,109 @@
+package marketwatch
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	FloorWindow     = 24 * time.Hour
+	floorPruneEvery = 10000
+	floorMaxPerName = 10000
+)
+
+type priceObservation struct {
+	price  float64
+	seenAt time.Time
+}
+
+// floorKey is what a floor is kept for: prices for the same name in
+// different currencies are not comparable.
+type floorKey struct {
+	name     string
+	currency string
+}
+
+// priceTracker keeps the lowest price per item name and currency over a
+// rolling window. Each key holds a queue of observations with strictly
+// increasing prices: a new price removes every queued price that is not
+// lower, so the front is always the floor and expired entries only ever
+// leave from the front.
+type priceTracker struct {
+	mu       sync.Mutex
+	window   time.Duration
+	undercut float64
+	names    map[floorKey][]priceObservation
+	observed int
+	now      func() time.Time
+}
+
+// newPriceTracker reports a new low when a price is at least undercutPct
+// percent below the floor of the last window.
+func newPriceTracker(window time.Duration, undercutPct float64) *priceTracker {
+	return &priceTracker{
+		window:   window,
+		undercut: undercutPct / 100,
+		names:    make(map[floorKey][]priceObservation),
+		now:      time.Now,
+	}
+}
+
+// Floor returns the lowest price recorded for name in currency within the
+// window.
+func (t *priceTracker) Floor(name, currency string) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	queue := t.expire(floorKey{name, currency}, t.now())
+	if len(queue) == 0 {
+		return 0, false
+	}
+	return queue[0].price, true
+}
+
+// Observe records price for name in currency and reports whether it
+// undercuts the floor seen so far. The first observation of a name in a
+// currency is never a new low.
+func (t *priceTracker) Observe(name, currency string, price float64) (isNewLow bool) {
+	now := t.now()
+	key := floorKey{name, currency}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	queue := t.expire(key, now)
+	if len(queue) > 0 {
+		isNewLow = price <= queue[0].price*(1-t.undercut)
+	}
+
+	for len(queue) > 0 && queue[len(queue)-1].price >= price {
+		queue = queue[:len(queue)-1]
+	}
+	if len(queue) >= floorMaxPerName {
+		queue = queue[1:]
+	}
+	t.names[key] = append(queue, priceObservation{price: price, seenAt: now})
+
+	if t.observed++; t.observed%floorPruneEvery == 0 {
+		for other := range t.names {
+			t.expire(other, now)
+		}
+	}
+	return isNewLow
+}
+
+// expire drops observations older than the window and forgets keys that
+// have none left. The caller holds t.mu.
+func (t *priceTracker) expire(key floorKey, now time.Time) []priceObservation {
+	queue := t.names[key]
+	i := 0
+	for i < len(queue) && now.Sub(queue[i].seenAt) >= t.window {
+		i++
+	}
+	queue = queue[i:]
+	if len(queue) == 0 {
+		delete(t.names, key)
+		return nil
+	}
+	t.names[key] = queue
+	return queue
+}
@@ -0,0 +1,96 @@
+package marketwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceTracker(t *testing.T) {
+	type step struct {
+		advance  time.Duration
+		name     string
+		currency string
+		price    float64
+		newLow   bool
+		floor    float64 // after the observation
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "undercut",
+			steps: []step{
+				{name: "a", currency: "USD", price: 100, floor: 100},
+				{name: "a", currency: "USD", price: 95, floor: 95},
+				{name: "a", currency: "USD", price: 85.5, newLow: true, floor: 85.5},
+				{name: "a", currency: "USD", price: 90, floor: 85.5},
+			},
+		},
+		{
+			name: "names and currencies are separate",
+			steps: []step{
+				{name: "a", currency: "USD", price: 100, floor: 100},
+				{name: "b", currency: "USD", price: 10, floor: 10},
+				{name: "a", currency: "RUB", price: 50, floor: 50},
+				{name: "a", currency: "USD", price: 80, newLow: true, floor: 80},
+			},
+		},
+		{
+			name: "rolling window",
+			steps: []step{
+				{name: "a", currency: "USD", price: 50, floor: 50},
+				{advance: 30 * time.Minute, name: "a", currency: "USD", price: 70, floor: 50},
+				{advance: 30 * time.Minute, name: "a", currency: "USD", price: 80, floor: 70},
+				// 70 is still within the window, so 60 undercuts it.
+				{advance: 10 * time.Minute, name: "a", currency: "USD", price: 60, newLow: true, floor: 60},
+				{advance: 2 * time.Hour, name: "a", currency: "USD", price: 40, floor: 40},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			tracker := newPriceTracker(time.Hour, 10)
+			tracker.now = clock.Now
+			for i, s := range tt.steps {
+				clock.Advance(s.advance)
+				if got := tracker.Observe(s.name, s.currency, s.price); got != s.newLow {
+					t.Errorf("step %d: Observe(%s %g %s) = %v, want %v", i, s.name, s.price, s.currency, got, s.newLow)
+				}
+				if floor, ok := tracker.Floor(s.name, s.currency); !ok || floor != s.floor {
+					t.Errorf("step %d: floor %g, %v; want %g", i, floor, ok, s.floor)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceTrackerEviction(t *testing.T) {
+	clock := newFakeClock()
+	tracker := newPriceTracker(time.Hour, 10)
+	tracker.now = clock.Now
+	tracker.Observe("a", "USD", 10)
+	clock.Advance(time.Hour)
+	if _, ok := tracker.Floor("a", "USD"); ok {
+		t.Error("floor kept past the window")
+	}
+	if len(tracker.names) != 0 {
+		t.Errorf("%d names kept after expiry", len(tracker.names))
+	}
+}
+
+func TestWatcherFlagsNewLow(t *testing.T) {
+	d, items := newTestWatcher(t, nil, nil)
+	d.floors = newPriceTracker(time.Hour, 10)
+	for _, price := range []string{"100", "80"} {
+		d.processMessage(feedFrame("newitems_go", `{"i_market_name": "Desert Eagle | Blaze (Factory New)", "ui_price": "`+price+`", "ui_currency": "USD"}`))
+	}
+	if item := nextItem(t, items); item.NewLow {
+		t.Error("first sighting flagged as a new low")
+	}
+	item := nextItem(t, items)
+	if !item.NewLow || item.FloorPrice == nil || *item.FloorPrice != 100 {
+		t.Errorf("new low %v, floor %v; want a new low under 100", item.NewLow, item.FloorPrice)
+	}
+}
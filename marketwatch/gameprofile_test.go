@@ -0,0 +1,104 @@
+package marketwatch
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGameProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		game    string
+		payload string
+		want    Item
+	}{
+		{
+			name:    "csgo",
+			game:    "csgo",
+			payload: `{"i_market_name": "AK-47 | Case Hardened (Field-Tested)", "i_quality": "StatTrak™", "ui_price": "150", "ui_currency": "USD", "ui_float": "0.2511", "inspect_url": "steam://rungame/730/1/+csgo_econ_action_preview M1A2D3", "ui_paintseed": 661, "i_classid": "310776566"}`,
+			want:    Item{MarketName: "AK-47 | Case Hardened (Field-Tested)", Quality: "StatTrak™", Price: 150, Currency: "USD", Float: floatPtr(0.2511), InspectURL: "steam://rungame/730/1/+csgo_econ_action_preview M1A2D3", PaintSeed: intPtr(661), ClassID: "310776566"},
+		},
+		{
+			name:    "cs2",
+			game:    "cs2",
+			payload: `{"market_hash_name": "AK-47 | Case Hardened (Field-Tested)", "quality": "StatTrak™", "price": 150, "currency": "USD", "float": 0.2511, "inspect_link": "steam://rungame/730/1/+csgo_econ_action_preview M1A2D3", "paint_seed": 661, "classid": "310776566"}`,
+			want:    Item{MarketName: "AK-47 | Case Hardened (Field-Tested)", Quality: "StatTrak™", Price: 150, Currency: "USD", Float: floatPtr(0.2511), InspectURL: "steam://rungame/730/1/+csgo_econ_action_preview M1A2D3", PaintSeed: intPtr(661), ClassID: "310776566"},
+		},
+		{
+			// The CS:GO keys win when a CS2 payload has both.
+			name:    "cs2 with both keys",
+			game:    "cs2",
+			payload: `{"i_market_name": "AWP | Asiimov (Field-Tested)", "market_hash_name": "ignored", "ui_price": "45.10", "price": 1}`,
+			want:    Item{MarketName: "AWP | Asiimov (Field-Tested)", Price: 45.1},
+		},
+		{
+			// Dota 2 has no float or inspect link, and rarity stands in
+			// for quality.
+			name:    "dota2",
+			game:    "dota2",
+			payload: `{"i_market_name": "Exalted Manifold Paradox", "i_rarity": "Arcana", "ui_price": "30", "ui_currency": "USD", "ui_float": "0.5", "inspect_url": "steam://rungame/570/1", "i_classid": "57939591"}`,
+			want:    Item{MarketName: "Exalted Manifold Paradox", Quality: "Arcana", Price: 30, Currency: "USD", ClassID: "57939591"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePayload(t, tt.game, tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.MarketName != tt.want.MarketName || got.Quality != tt.want.Quality || got.Price != tt.want.Price ||
+				got.Currency != tt.want.Currency || got.InspectURL != tt.want.InspectURL || got.ClassID != tt.want.ClassID {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !equalFloat(got.Float, tt.want.Float) || !equalInt(got.PaintSeed, tt.want.PaintSeed) {
+				t.Errorf("float %v seed %v, want %v and %v", got.Float, got.PaintSeed, tt.want.Float, tt.want.PaintSeed)
+			}
+		})
+	}
+}
+
+func TestGameProfileMarkets(t *testing.T) {
+	tests := []struct {
+		game     string
+		channel  string
+		tokenURL string
+		origin   string
+	}{
+		{"csgo", "newitems_go", "https://market.csgo.com/api/v2/get-ws-token", "https://market.csgo.com"},
+		{"cs2", "newitems_cs2", "https://market.csgo.com/api/v2/get-ws-token", "https://market.csgo.com"},
+		{"dota2", "newitems_dota", "https://market.dota2.net/api/v2/get-ws-token", "https://market.dota2.net"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.game, func(t *testing.T) {
+			cfg, err := loadConfig([]string{"-game", tt.game}, env(map[string]string{"MARKET_API_KEY": "key"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cfg.Markets) != 1 {
+				t.Fatalf("markets %+v, want the %s market", cfg.Markets, tt.game)
+			}
+			market := cfg.Markets[0]
+			if market.Game != tt.game || market.TokenURL != tt.tokenURL || market.Origin != tt.origin {
+				t.Errorf("market %+v, want token URL %s and origin %s", market, tt.tokenURL, tt.origin)
+			}
+
+			d := NewMarketWatcher(market, cfg, testLogger, io.Discard, newMetrics(), newStats())
+			if channels := d.channels(); !slices.Equal(channels, []string{tt.channel}) {
+				t.Errorf("channels %q, want %s", channels, tt.channel)
+			}
+			items := make(chan *Item, 4)
+			d.items = items
+			d.processMessage(feedFrame(tt.channel, `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`))
+			if item := nextItem(t, items); item.Channel != tt.channel || item.Market != tt.game {
+				t.Errorf("item from %s on %s, want %s on %s", item.Market, item.Channel, tt.game, tt.channel)
+			}
+		})
+	}
+
+	_, err := loadConfig([]string{"-game", "tf2"}, env(map[string]string{"MARKET_API_KEY": "key"}))
+	if err == nil || !strings.Contains(err.Error(), `unknown game "tf2"`) {
+		t.Errorf("err = %v, want an unknown game", err)
+	}
+}
@@ -0,0 +1,153 @@
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of ItemEvent. The newitems channels only ever produce listings;
+// history_go reports what happens to items afterwards.
+const (
+	EventListed       = "listed"
+	EventSold         = "sold"
+	EventDelisted     = "delisted"
+	EventPriceChanged = "price_changed"
+)
+
+// ItemEvent is something that happened to a listed item.
+type ItemEvent struct {
+	Kind string
+	Item *Item
+	// At is when the event happened, if the feed said.
+	At *time.Time
+}
+
+// historyKinds maps the spellings the history feed uses for an event onto
+// the ItemEvent kinds.
+var historyKinds = map[string]string{
+	"":              EventSold,
+	"sold":          EventSold,
+	"sale":          EventSold,
+	"buy":           EventSold,
+	"listed":        EventListed,
+	"add":           EventListed,
+	"new":           EventListed,
+	"delisted":      EventDelisted,
+	"removed":       EventDelisted,
+	"remove":        EventDelisted,
+	"cancel":        EventDelisted,
+	"price_changed": EventPriceChanged,
+	"update":        EventPriceChanged,
+	"price":         EventPriceChanged,
+}
+
+// parseHistoryEvent reads a history_go payload. The feed sends sales as a
+// JSON array: [classid_instanceid, unix time, market name, price, ...].
+// Other events come as an object with the newitems fields plus "event"
+// naming the kind; without it the object is a sale too.
+func parseHistoryEvent(payload []byte, profile *GameProfile) (*ItemEvent, error) {
+	var raw interface{}
+	if err := decodeJSON(payload, &raw); err != nil {
+		return nil, err
+	}
+	switch v := raw.(type) {
+	case []interface{}:
+		return parseHistoryArray(v, profile)
+	case map[string]interface{}:
+		return parseHistoryObject(v, profile)
+	default:
+		return nil, fmt.Errorf("unexpected history payload %T", raw)
+	}
+}
+
+func parseHistoryArray(fields []interface{}, profile *GameProfile) (*ItemEvent, error) {
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("history entry has %d fields, want at least 4", len(fields))
+	}
+	data := map[string]interface{}{
+		profile.Fields.MarketName[0]: fields[2],
+		profile.Fields.Price[0]:      fields[3],
+	}
+	item, err := parseItem(data, profile)
+	if err != nil {
+		return nil, err
+	}
+	at := optionalTime(map[string]interface{}{"time": fields[1]}, "time")
+	return &ItemEvent{Kind: EventSold, Item: item, At: at}, nil
+}
+
+func parseHistoryObject(data map[string]interface{}, profile *GameProfile) (*ItemEvent, error) {
+	name := strings.ToLower(getValue(data, "event"))
+	kind, ok := historyKinds[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown history event %q", name)
+	}
+	item, err := parseItem(data, profile)
+	if err != nil {
+		return nil, err
+	}
+	return &ItemEvent{Kind: kind, Item: item}, nil
+}
+
+// MarshalItemEvent encodes ev in the same envelope as MarshalEvent, with
+// the event kind in place of "newitem".
+func MarshalItemEvent(ev *ItemEvent) ([]byte, error) {
+	return marshalEvent(ev.Kind, ev.Item, nil)
+}
+
+// handleHistory emits history events for items passing the name filters.
+// Price and float filters are left out: they describe what to buy, while a
+// sale of a watched item is worth seeing at any price.
+func (d *MarketWatcher) handleHistory(channel string, payload []byte) {
+	ev, err := parseHistoryEvent(payload, d.profile)
+	if err != nil {
+		d.metrics.parseErrors.Inc()
+		var perr *priceError
+		if errors.As(err, &perr) {
+			d.logger.Warn("Skipping history event with unparseable price", "err", err)
+		} else {
+			d.logger.Error("History event parse failed", "err", err)
+		}
+		d.captureParseError(channelFrame(channel, payload))
+		return
+	}
+	item := ev.Item
+	item.Market = d.market.Name
+	item.Channel = channel
+	item.ReceivedAt = time.Now()
+	d.metrics.historyEvents.WithLabelValues(ev.Kind).Inc()
+
+	filters := d.filters.current()
+	if !nameMatches(item.MarketName, filters.Include, filters.Exclude) {
+		return
+	}
+	d.emitEvent(ev)
+}
+
+// emitEvent passes ev to the sinks taking events and writes it to the
+// output.
+func (d *MarketWatcher) emitEvent(ev *ItemEvent) {
+	item := ev.Item
+	d.stats.recordEvent(ev.Kind)
+	d.sinks.DeliverEvent(ev)
+
+	if d.config.JSONOutput() {
+		line, err := marshalEvent(ev.Kind, ev.Item, d.fields)
+		if err != nil {
+			d.logger.Error("Event encode failed", "err", err)
+			return
+		}
+		d.writeEvent(line)
+		return
+	}
+	attrs := itemAttrs(item)
+	// itemAttrs starts with the new_item event attribute.
+	attrs[1] = ev.Kind
+	if ev.At != nil {
+		attrs = append(attrs, "event_time", ev.At.UTC())
+	}
+	d.logger.Log(context.Background(), d.config.ItemLevel(), "Item event", attrs...)
+}
@@ -0,0 +1,131 @@
+package marketwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryEvent(t *testing.T) {
+	soldAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payload string
+		kind    string
+		item    string
+		price   float64
+		at      *time.Time
+		wantErr bool
+	}{
+		{
+			name:    "sale array",
+			payload: `["310776560_302028390", 1714566600, "AK-47 | Redline (Field-Tested)", "12.50", "USD"]`,
+			kind:    EventSold,
+			item:    "AK-47 | Redline (Field-Tested)",
+			price:   12.5,
+			at:      &soldAt,
+		},
+		{
+			name:    "sold object",
+			payload: `{"event": "sold", "i_market_name": "AWP | Asiimov (Field-Tested)", "ui_price": 45}`,
+			kind:    EventSold,
+			item:    "AWP | Asiimov (Field-Tested)",
+			price:   45,
+		},
+		{
+			name:    "object without event",
+			payload: `{"i_market_name": "AWP | Asiimov (Field-Tested)", "ui_price": 45}`,
+			kind:    EventSold,
+			item:    "AWP | Asiimov (Field-Tested)",
+			price:   45,
+		},
+		{
+			name:    "listed",
+			payload: `{"event": "add", "i_market_name": "Operation Bravo Case", "ui_price": "1.5"}`,
+			kind:    EventListed,
+			item:    "Operation Bravo Case",
+			price:   1.5,
+		},
+		{
+			name:    "delisted",
+			payload: `{"event": "Removed", "i_market_name": "Sticker | Crown (Foil)", "ui_price": "830"}`,
+			kind:    EventDelisted,
+			item:    "Sticker | Crown (Foil)",
+			price:   830,
+		},
+		{
+			name:    "price changed",
+			payload: `{"event": "price_changed", "i_market_name": "Sticker | Crown (Foil)", "ui_price": "790"}`,
+			kind:    EventPriceChanged,
+			item:    "Sticker | Crown (Foil)",
+			price:   790,
+		},
+		{name: "unknown event", payload: `{"event": "gift", "i_market_name": "Sticker | Crown (Foil)", "ui_price": "1"}`, wantErr: true},
+		{name: "short array", payload: `["310776560_302028390", 1714566600, "AK-47 | Redline (Field-Tested)"]`, wantErr: true},
+		{name: "bad price", payload: `["310776560_302028390", 1714566600, "AK-47 | Redline (Field-Tested)", "free"]`, wantErr: true},
+		{name: "scalar", payload: `42`, wantErr: true},
+		{name: "not json", payload: `sold!`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := parseHistoryEvent([]byte(tt.payload), gameProfiles["csgo"])
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsed %+v, want an error", ev)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Kind != tt.kind || ev.Item.MarketName != tt.item || ev.Item.Price != tt.price {
+				t.Errorf("got %s of %q at %g, want %s of %q at %g", ev.Kind, ev.Item.MarketName, ev.Item.Price, tt.kind, tt.item, tt.price)
+			}
+			if (ev.At == nil) != (tt.at == nil) || ev.At != nil && !ev.At.Equal(*tt.at) {
+				t.Errorf("event time %v, want %v", ev.At, tt.at)
+			}
+		})
+	}
+}
+
+func TestWatcherHistoryEvents(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Channels = []string{"newitems_go", "history_go"}
+	cfg.Format = FormatJSON
+	cfg.Include = []string{"crown"}
+	// History events skip the price filters.
+	cfg.MaxPrice = 10
+	d, _ := newTestWatcher(t, nil, cfg)
+	var out bytes.Buffer
+	d.out = &out
+
+	for _, payload := range []string{
+		`{"event": "add", "i_market_name": "Sticker | Crown (Foil)", "ui_price": "830"}`,
+		`{"event": "price_changed", "i_market_name": "Sticker | Crown (Foil)", "ui_price": "790"}`,
+		`{"event": "sold", "i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"}`,
+		`["310776560_302028390", 1714566600, "Sticker | Crown (Foil)", "790"]`,
+		`{"event": "remove", "i_market_name": "Sticker | Crown (Foil)", "ui_price": "790"}`,
+	} {
+		d.processMessage(feedFrame("history_go", payload))
+	}
+
+	var kinds []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var ev Event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("decode %s: %v", line, err)
+		}
+		if ev.Channel != "history_go" || ev.Item.MarketName != "Sticker | Crown (Foil)" {
+			t.Errorf("unexpected event %s", line)
+		}
+		kinds = append(kinds, ev.Event)
+	}
+	if got, want := strings.Join(kinds, " "), "listed price_changed sold delisted"; got != want {
+		t.Errorf("events %q, want %q", got, want)
+	}
+	if got := d.stats.Snapshot().Events[EventSold]; got != 1 {
+		t.Errorf("/stats counts %d sales, want 1", got)
+	}
+}
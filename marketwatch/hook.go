@@ -0,0 +1,120 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const HookTimeout = 5 * time.Second
+
+// TradeHook is called for every item that passes all filters. ctx ends
+// when the hook timeout passes or the watcher shuts down; a hook should
+// give up then.
+type TradeHook interface {
+	OnMatch(ctx context.Context, item *Item) error
+}
+
+type NoopHook struct{}
+
+func (NoopHook) OnMatch(context.Context, *Item) error { return nil }
+
+// HTTPHook posts matched items as JSON to a user-provided endpoint, e.g. a
+// buying bot. With a Secret the request is signed, see VerifySignature.
+type HTTPHook struct {
+	URL    string
+	Client *http.Client
+	Secret []byte
+}
+
+func NewHTTPHook(url string, timeout time.Duration) *HTTPHook {
+	return &HTTPHook{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+func (h *HTTPHook) OnMatch(ctx context.Context, item *Item) error {
+	body, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(h.Secret) > 0 {
+		ts := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(SignatureHeader, signBody(h.Secret, ts, body))
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("hook %s returned %s", h.URL, resp.Status)
+	}
+	return nil
+}
+
+// hookRunner fires all registered hooks concurrently, each bounded by its
+// own timeout, without blocking the caller. A hook that times out has its
+// context canceled, which ends the HTTPHook's request.
+type hookRunner struct {
+	mu      sync.RWMutex
+	hooks   []TradeHook
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+func newHookRunner(timeout time.Duration, logger *slog.Logger) *hookRunner {
+	return &hookRunner{timeout: timeout, logger: logger}
+}
+
+func (r *hookRunner) Register(hook TradeHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+func (r *hookRunner) Run(ctx context.Context, item *Item) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, hook := range r.hooks {
+		go r.call(ctx, hook, item)
+	}
+}
+
+func (r *hookRunner) call(ctx context.Context, hook TradeHook, item *Item) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.OnMatch(ctx, item)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.logger.Warn("Trade hook timed out", "hook", fmt.Sprintf("%T", hook), "market_name", item.MarketName, "timeout", r.timeout)
+	case ctx.Err() == nil:
+		r.logger.Error("Trade hook failed", "hook", fmt.Sprintf("%T", hook), "market_name", item.MarketName, "err", err)
+	}
+}
@@ -0,0 +1,88 @@
+package marketwatch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookRunnerCancels(t *testing.T) {
+	tests := []struct {
+		name string
+		// status is what the endpoint answers; 0 stalls until the request
+		// is canceled.
+		status   int
+		shutdown bool
+		log      string // expected in the log, or "" for a clean call
+		canceled bool
+	}{
+		{name: "answered", status: http.StatusOK},
+		{name: "failed", status: http.StatusInternalServerError, log: `level=ERROR msg="Trade hook failed"`},
+		{name: "timed out", log: `level=WARN msg="Trade hook timed out"`, canceled: true},
+		{name: "shutdown", shutdown: true, canceled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan struct{})
+			canceled := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// With the body read the server notices the client hanging up.
+				io.Copy(io.Discard, r.Body)
+				close(received)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				select {
+				case <-r.Context().Done():
+					close(canceled)
+				case <-time.After(5 * time.Second):
+				}
+			}))
+			defer srv.Close()
+
+			var log strings.Builder
+			out := &lockedWriter{w: &log}
+			timeout := 100 * time.Millisecond
+			if tt.shutdown {
+				timeout = time.Minute
+			}
+			r := newHookRunner(timeout, slog.New(slog.NewTextHandler(out, nil)))
+			// The client's own timeout is well past the runner's.
+			r.Register(NewHTTPHook(srv.URL, time.Minute))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r.Run(ctx, &Item{MarketName: "AK-47 | Redline (Field-Tested)", Price: 12})
+			<-received
+			if tt.shutdown {
+				cancel()
+			}
+			if tt.canceled {
+				select {
+				case <-canceled:
+				case <-time.After(2 * time.Second):
+					t.Fatal("hook request not canceled")
+				}
+			}
+			logged := func() string {
+				out.mu.Lock()
+				defer out.mu.Unlock()
+				return log.String()
+			}
+			if tt.log != "" {
+				waitFor(t, "the hook log line", func() bool { return strings.Contains(logged(), tt.log) })
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+			if got := logged(); got != "" {
+				t.Errorf("logged %q, want nothing", got)
+			}
+		})
+	}
+}
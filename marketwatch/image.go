@@ -0,0 +1,44 @@
+package marketwatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SteamImageCDN serves item icons, either by icon hash or by class.
+	SteamImageCDN = "https://community.cloudflare.steamstatic.com/economy/image/"
+	// ImageSize is the bounding box requested from the CDN.
+	ImageSize = "360fx360f"
+)
+
+// imageKeys are the fields the feed may carry an image in, as a full URL
+// or a Steam icon hash.
+var imageKeys = []string{"image", "i_icon_url", "icon_url"}
+
+// feedImageURL returns the image the feed sent, if any.
+func feedImageURL(data map[string]interface{}) string {
+	for _, key := range imageKeys {
+		v := strings.ReplaceAll(getValue(data, key), `\/`, `/`)
+		switch {
+		case v == "":
+			continue
+		case strings.HasPrefix(v, "https://") || strings.HasPrefix(v, "http://"):
+			return v
+		case strings.HasPrefix(v, "//"):
+			return "https:" + v
+		default:
+			return SteamImageCDN + v + "/" + ImageSize
+		}
+	}
+	return ""
+}
+
+// classImageURL builds the CDN URL for an item class. Without an app id or
+// class id there is no image.
+func classImageURL(appID int, classID string) string {
+	if appID == 0 || classID == "" || classID == "0" {
+		return ""
+	}
+	return fmt.Sprintf("%sclass/%d/%s/%s", SteamImageCDN, appID, classID, ImageSize)
+}
@@ -0,0 +1,68 @@
+package marketwatch
+
+import "testing"
+
+func TestFeedImageURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "none", payload: `{}`},
+		{name: "empty", payload: `{"image": ""}`},
+		{name: "full url", payload: `{"image": "https://cdn.example.com/ak.png"}`, want: "https://cdn.example.com/ak.png"},
+		{name: "escaped url", payload: `{"image": "https:\\/\\/cdn.example.com\\/ak.png"}`, want: "https://cdn.example.com/ak.png"},
+		{name: "protocol relative", payload: `{"icon_url": "//cdn.example.com/ak.png"}`, want: "https://cdn.example.com/ak.png"},
+		{name: "icon hash", payload: `{"i_icon_url": "-9a81dlWLwJ2UUGcVs_nsVtzdOEdtWwKGZZLQHTxDZ7I56KU0Zwwo4NUX4oFJZEHLbXH5ApeO4YmlhxYQknCRvCo04DEVlxkKgpot7HxfDhjxszJemkV09-5lpKKqPrxN7LEmyVQ7MEpiLuSrYmnjQO3-UdsZGHyd4_Bd1RvNQ7T_FDrw-_ng5Pu75iY1zI97bhLsvQz"}`, want: SteamImageCDN + "-9a81dlWLwJ2UUGcVs_nsVtzdOEdtWwKGZZLQHTxDZ7I56KU0Zwwo4NUX4oFJZEHLbXH5ApeO4YmlhxYQknCRvCo04DEVlxkKgpot7HxfDhjxszJemkV09-5lpKKqPrxN7LEmyVQ7MEpiLuSrYmnjQO3-UdsZGHyd4_Bd1RvNQ7T_FDrw-_ng5Pu75iY1zI97bhLsvQz/360fx360f"},
+		{name: "first key wins", payload: `{"image": "https://a.example.com/1.png", "icon_url": "abc"}`, want: "https://a.example.com/1.png"},
+	}
+	for _, tt := range tests {
+		var data map[string]interface{}
+		if err := decodeJSON([]byte(tt.payload), &data); err != nil {
+			t.Fatal(err)
+		}
+		if got := feedImageURL(data); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassImageURL(t *testing.T) {
+	tests := []struct {
+		appID   int
+		classID string
+		want    string
+	}{
+		{730, "310776566", "https://community.cloudflare.steamstatic.com/economy/image/class/730/310776566/360fx360f"},
+		{570, "57939591", "https://community.cloudflare.steamstatic.com/economy/image/class/570/57939591/360fx360f"},
+		{730, "", ""},
+		{730, "0", ""},
+		{0, "310776566", ""},
+	}
+	for _, tt := range tests {
+		if got := classImageURL(tt.appID, tt.classID); got != tt.want {
+			t.Errorf("classImageURL(%d, %q) = %q, want %q", tt.appID, tt.classID, got, tt.want)
+		}
+	}
+}
+
+func TestWatcherImageURL(t *testing.T) {
+	d, items := newTestWatcher(t, nil, nil)
+	d.market.AppID = 730
+	for _, payload := range []string{
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "i_classid": "310776566"}`,
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12", "i_classid": "310776566", "image": "https://cdn.example.com/ak.png"}`,
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"}`,
+	} {
+		d.processMessage(feedFrame("newitems_go", payload))
+	}
+	for _, want := range []string{
+		SteamImageCDN + "class/730/310776566/" + ImageSize,
+		"https://cdn.example.com/ak.png",
+		"",
+	} {
+		if item := nextItem(t, items); item.ImageURL != want {
+			t.Errorf("image %q, want %q", item.ImageURL, want)
+		}
+	}
+}
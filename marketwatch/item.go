@@ -0,0 +1,425 @@
+package marketwatch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Item struct {
+	MarketName string  `json:"market_name"`
+	Quality    string  `json:"quality,omitempty"`
+	Price      float64 `json:"price"`
+	Currency   string  `json:"currency"`
+	// RawCurrency is ui_currency as sent; Currency is its ISO 4217 code.
+	RawCurrency string     `json:"raw_currency,omitempty"`
+	Float       *float64   `json:"float,omitempty"`
+	Stickers    []Sticker  `json:"stickers,omitempty"`
+	InspectURL  string     `json:"inspect_url,omitempty"`
+	PaintSeed   *int       `json:"paint_seed,omitempty"`
+	PaintIndex  *int       `json:"paint_index,omitempty"`
+	ListedAt    *time.Time `json:"listed_at,omitempty"`
+	ClassID     string     `json:"classid,omitempty"`
+	InstanceID  string     `json:"instanceid,omitempty"`
+	ImageURL    string     `json:"image_url,omitempty"`
+	// Attributes holds the extras listed in attributeFields, e.g. phase.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	HighPriority bool     `json:"high_priority,omitempty"`
+	FloorPrice   *float64 `json:"floor_price,omitempty"`
+	NewLow       bool     `json:"new_low,omitempty"`
+
+	// Set on a relisting at another price, with -price-changes.
+	PreviousPrice  *float64 `json:"previous_price,omitempty"`
+	PriceChangePct *float64 `json:"price_change_pct,omitempty"`
+
+	ReferencePrice *float64 `json:"reference_price,omitempty"`
+	Discount       *float64 `json:"discount,omitempty"`
+
+	BasePrice    *float64 `json:"base_price,omitempty"`
+	BaseCurrency string   `json:"base_currency,omitempty"`
+	Unconverted  bool     `json:"unconverted,omitempty"`
+
+	// Problems that did not prevent parsing, logged by the caller.
+	warnings []string
+	// id is ID as of parsing, before lookups fill in more fields.
+	id string
+
+	// Where and when the item was received; carried in the event envelope.
+	Market     string    `json:"-"`
+	Channel    string    `json:"-"`
+	ReceivedAt time.Time `json:"-"`
+}
+
+// parseItem reads a listing payload, taking each field from the keys the
+// profile's FieldMap gives for it.
+func parseItem(data map[string]interface{}, profile *GameProfile) (*Item, error) {
+	fields := &profile.Fields
+	item := &Item{
+		MarketName:  firstValue(data, fields.MarketName),
+		Quality:     firstValue(data, fields.Quality),
+		RawCurrency: firstValue(data, fields.Currency),
+		InspectURL:  strings.ReplaceAll(firstValue(data, fields.InspectURL), `\/`, `/`),
+	}
+	item.Currency, _ = normalizeCurrency(item.RawCurrency)
+	if item.MarketName == "" {
+		return nil, fmt.Errorf("missing %s", strings.Join(fields.MarketName, " or "))
+	}
+
+	_, rawPrice := firstRaw(data, fields.Price)
+	price, err := priceValue(rawPrice)
+	if err != nil {
+		return nil, &priceError{raw: rawPrice, err: err}
+	}
+	item.Price = price
+
+	key, rawFloat := firstRaw(data, fields.Float)
+	floatValue, err := parseFloatValue(rawFloat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	item.Float = floatValue
+
+	_, rawStickers := firstRaw(data, fields.Stickers)
+	item.Stickers, item.warnings = parseStickers(rawStickers)
+
+	item.PaintSeed = optionalInt(data, fields.PaintSeed...)
+	item.PaintIndex = optionalInt(data, fields.PaintIndex...)
+	item.ListedAt = optionalTime(data, fields.ListedAt...)
+	item.ClassID = firstValue(data, fields.ClassID)
+	item.InstanceID = firstValue(data, fields.InstanceID)
+	item.ImageURL = feedImageURL(data)
+	item.Attributes = parseAttributes(data, item.MarketName)
+	item.id = item.feedID()
+
+	return item, nil
+}
+
+// optionalInt returns the first of keys holding an integer value. Missing,
+// empty or malformed values yield nil since not every item carries them.
+func optionalInt(data map[string]interface{}, keys ...string) *int {
+	for _, key := range keys {
+		val, ok := data[key]
+		if !ok || val == nil || val == "" {
+			continue
+		}
+		n, err := intValue(val)
+		if err != nil {
+			continue
+		}
+		return &n
+	}
+	return nil
+}
+
+// listedTimeLayouts are the string timestamps seen besides Unix times.
+var listedTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// optionalTime returns the first of keys holding a timestamp: Unix seconds
+// (or milliseconds) as a number or digit string, or one of
+// listedTimeLayouts, taken as UTC when it has no zone. Zero and unreadable
+// values yield nil.
+func optionalTime(data map[string]interface{}, keys ...string) *time.Time {
+	for _, key := range keys {
+		val, ok := data[key]
+		if !ok || val == nil || val == "" {
+			continue
+		}
+		t, err := timeValue(val)
+		if err != nil || t.IsZero() {
+			continue
+		}
+		return &t
+	}
+	return nil
+}
+
+func timeValue(val interface{}) (time.Time, error) {
+	if s, ok := val.(string); ok {
+		s = strings.TrimSpace(s)
+		for _, layout := range listedTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+	}
+	unix, err := numberValue(val)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if unix <= 0 {
+		return time.Time{}, nil
+	}
+	// Second timestamps stay below 1e12 until the year 33658.
+	if unix > 1e12 {
+		return time.UnixMilli(int64(unix)).UTC(), nil
+	}
+	return time.Unix(int64(unix), 0).UTC(), nil
+}
+
+type Sticker struct {
+	ID   int      `json:"id,omitempty"`
+	Name string   `json:"name,omitempty"`
+	Wear *float64 `json:"wear,omitempty"`
+}
+
+func (s Sticker) String() string {
+	label := s.Name
+	if label == "" {
+		label = "#" + strconv.Itoa(s.ID)
+	}
+	if s.Wear != nil {
+		label += fmt.Sprintf(" (wear %g)", *s.Wear)
+	}
+	return label
+}
+
+// parseStickers accepts both shapes the feed uses: an array of bare ids and
+// an array of {"id", "name", "wear"} objects. Entries it can't read are
+// skipped and reported as warnings rather than failing the whole item.
+func parseStickers(val interface{}) ([]Sticker, []string) {
+	if val == nil {
+		return nil, nil
+	}
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, []string{fmt.Sprintf("stickers has type %T", val)}
+	}
+
+	var stickers []Sticker
+	var warnings []string
+	for i, entry := range list {
+		obj, ok := entry.(map[string]interface{})
+		if !ok {
+			id, err := intValue(entry)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("sticker %d: %v", i, err))
+				continue
+			}
+			stickers = append(stickers, Sticker{ID: id})
+			continue
+		}
+
+		var sticker Sticker
+		if raw, ok := obj["id"]; ok {
+			id, err := intValue(raw)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("sticker %d id: %v", i, err))
+			}
+			sticker.ID = id
+		}
+		if name, ok := obj["name"].(string); ok {
+			sticker.Name = name
+		}
+		wear, err := parseFloatValue(obj["wear"])
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("sticker %d wear: %v", i, err))
+		}
+		sticker.Wear = wear
+		if sticker.ID == 0 && sticker.Name == "" {
+			warnings = append(warnings, fmt.Sprintf("sticker %d has neither id nor name", i))
+			continue
+		}
+		stickers = append(stickers, sticker)
+	}
+	return stickers, warnings
+}
+
+type priceError struct {
+	raw interface{}
+	err error
+}
+
+func (e *priceError) Error() string {
+	return fmt.Sprintf("ui_price %v: %v", e.raw, e.err)
+}
+
+func (e *priceError) Unwrap() error {
+	return e.err
+}
+
+func priceValue(val interface{}) (float64, error) {
+	if s, ok := val.(string); ok {
+		return parsePrice(s)
+	}
+	return numberValue(val)
+}
+
+// parseFloatValue returns nil for absent float values, which the feed sends
+// as a missing key, null, an empty string or the literal "<nil>".
+func parseFloatValue(val interface{}) (*float64, error) {
+	if s, ok := val.(string); ok {
+		if s = strings.TrimSpace(s); s == "" || s == "<nil>" {
+			return nil, nil
+		}
+	}
+	if val == nil {
+		return nil, nil
+	}
+	f, err := numberValue(val)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// decodeJSON unmarshals data keeping numbers as json.Number, so integer IDs
+// and prices are not rounded through float64 on the way in.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func numberValue(val interface{}) (float64, error) {
+	switch v := val.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case nil:
+		return 0, errors.New("value is missing")
+	default:
+		return 0, fmt.Errorf("unexpected type %T", val)
+	}
+}
+
+// intValue converts an integer field exactly; json.Number values are parsed
+// as int64 instead of going through float64.
+func intValue(val interface{}) (int, error) {
+	switch v := val.(type) {
+	case json.Number:
+		n, err := strconv.ParseInt(v.String(), 10, 64)
+		return int(n), err
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v))
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+		return int(v), nil
+	case nil:
+		return 0, errors.New("value is missing")
+	default:
+		return 0, fmt.Errorf("unexpected type %T", val)
+	}
+}
+
+func itemAttrs(item *Item) []any {
+	attrs := []any{
+		"event", "new_item",
+		"market_name", item.MarketName,
+		"quality", item.Quality,
+		"price", item.Price,
+		"currency", item.Currency,
+	}
+	if item.RawCurrency != item.Currency {
+		attrs = append(attrs, "raw_currency", item.RawCurrency)
+	}
+	if item.Float != nil {
+		attrs = append(attrs, "float", *item.Float)
+	}
+	if len(item.Stickers) > 0 {
+		labels := make([]string, len(item.Stickers))
+		for i, s := range item.Stickers {
+			labels[i] = s.String()
+		}
+		attrs = append(attrs, "stickers", strings.Join(labels, ", "))
+	}
+	if item.InspectURL != "" {
+		attrs = append(attrs, "inspect_url", item.InspectURL)
+	}
+	if item.PaintSeed != nil {
+		attrs = append(attrs, "paint_seed", *item.PaintSeed)
+	}
+	if item.PaintIndex != nil {
+		attrs = append(attrs, "paint_index", *item.PaintIndex)
+	}
+	for _, field := range attributeFields {
+		if value, ok := item.Attributes[field.name]; ok {
+			attrs = append(attrs, field.name, value)
+		}
+	}
+	if item.ListedAt != nil {
+		attrs = append(attrs, "listed_at", *item.ListedAt, "latency", item.Latency())
+	}
+	if item.HighPriority {
+		attrs = append(attrs, "high_priority", true)
+	}
+	if item.NewLow {
+		attrs = append(attrs, "new_low", true, "floor_price", *item.FloorPrice)
+	}
+	if item.PreviousPrice != nil {
+		attrs = append(attrs, "previous_price", *item.PreviousPrice, "price_change_pct", *item.PriceChangePct)
+	}
+	if item.Discount != nil {
+		attrs = append(attrs, "reference_price", *item.ReferencePrice, "discount", *item.Discount)
+	}
+	if item.BasePrice != nil {
+		attrs = append(attrs, "base_price", *item.BasePrice, "base_currency", item.BaseCurrency)
+	}
+	if item.Unconverted {
+		attrs = append(attrs, "unconverted", true)
+	}
+	return attrs
+}
+
+// IDLength is the number of hex digits in an item ID.
+const IDLength = 32
+
+// ID is a stable key for the listing: a truncated SHA-256 over the market
+// name, inspect link, float, price and listing time. Fields set on receipt,
+// such as ReceivedAt or the enrichments, are left out, so every sink and
+// every run derives the same ID for the same listing. For parsed items it
+// is fixed at parse time: a float the checker fills in later, or fails to,
+// does not change it.
+func (item *Item) ID() string {
+	if item.id != "" {
+		return item.id
+	}
+	return item.feedID()
+}
+
+func (item *Item) feedID() string {
+	floatValue, listedAt := "", ""
+	if item.Float != nil {
+		floatValue = strconv.FormatFloat(*item.Float, 'g', -1, 64)
+	}
+	if item.ListedAt != nil {
+		listedAt = item.ListedAt.UTC().Format(time.RFC3339Nano)
+	}
+	h := sha256.New()
+	for _, field := range []string{item.MarketName, item.InspectURL, floatValue,
+		strconv.FormatFloat(item.Price, 'f', -1, 64), listedAt} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:IDLength]
+}
+
+// MarshalJSON adds the ID to the item's fields.
+func (item *Item) MarshalJSON() ([]byte, error) {
+	type fields Item
+	return json.Marshal(struct {
+		ID string `json:"id"`
+		*fields
+	}{item.ID(), (*fields)(item)})
+}
+
+// Latency is how long after listing the item was received, or zero when
+// the feed did not say when it was listed.
+func (item *Item) Latency() time.Duration {
+	if item.ListedAt == nil || item.ReceivedAt.IsZero() {
+		return 0
+	}
+	return item.ReceivedAt.Sub(*item.ListedAt)
+}
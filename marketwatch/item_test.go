@@ -0,0 +1,372 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// parsePayload decodes a payload the way handleNewItem does and parses it
+// with the profile of game.
+func parsePayload(t *testing.T, game, payload string) (*Item, error) {
+	t.Helper()
+	var data map[string]interface{}
+	if err := decodeJSON([]byte(payload), &data); err != nil {
+		t.Fatalf("decode %s: %v", payload, err)
+	}
+	return parseItem(data, gameProfiles[game])
+}
+
+func TestParseItem(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		price    float64
+		float    *float64
+		stickers []Sticker
+		wantErr  bool
+	}{
+		{
+			name:     "float and stickers",
+			payload:  `{"i_market_name": "AWP | Asiimov (Field-Tested)", "ui_price": "45.10", "ui_float": "0.2711", "stickers": [5021, 4783]}`,
+			price:    45.1,
+			float:    floatPtr(0.2711),
+			stickers: []Sticker{{ID: 5021}, {ID: 4783}},
+		},
+		{
+			name:    "float without stickers",
+			payload: `{"i_market_name": "Glock-18 | Fade (Factory New)", "ui_price": 320, "ui_float": 0.011}`,
+			price:   320,
+			float:   floatPtr(0.011),
+		},
+		{
+			name:     "stickers without float",
+			payload:  `{"i_market_name": "Sealed Graffiti | Lambda", "ui_price": "0.03", "stickers": [12]}`,
+			price:    0.03,
+			stickers: []Sticker{{ID: 12}},
+		},
+		{
+			name:    "neither",
+			payload: `{"i_market_name": "Operation Bravo Case", "ui_price": "1.5", "ui_float": "", "stickers": []}`,
+			price:   1.5,
+		},
+		{
+			name:    "missing name",
+			payload: `{"ui_price": "1.5"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unreadable float",
+			payload: `{"i_market_name": "Operation Bravo Case", "ui_price": "1.5", "ui_float": "worn"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := parsePayload(t, "csgo", tt.payload)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsed %+v, want an error", item)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Price != tt.price {
+				t.Errorf("price = %g, want %g", item.Price, tt.price)
+			}
+			if !equalFloat(item.Float, tt.float) {
+				t.Errorf("float = %v, want %v", item.Float, tt.float)
+			}
+			if !equalStickers(item.Stickers, tt.stickers) {
+				t.Errorf("stickers = %v, want %v", item.Stickers, tt.stickers)
+			}
+		})
+	}
+}
+
+func equalFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalStickers(a, b []Sticker) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Name != b[i].Name || !equalFloat(a[i].Wear, b[i].Wear) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseFloatValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      interface{}
+		want    *float64
+		wantErr bool
+	}{
+		{name: "nil", in: nil},
+		{name: "empty", in: ""},
+		{name: "blank", in: "  "},
+		{name: "nil literal", in: "<nil>"},
+		{name: "string", in: "0.0712", want: floatPtr(0.0712)},
+		{name: "number", in: json.Number("0.5"), want: floatPtr(0.5)},
+		{name: "float64", in: 0.25, want: floatPtr(0.25)},
+		{name: "zero", in: "0", want: floatPtr(0)},
+		{name: "garbage", in: "n/a", wantErr: true},
+		{name: "wrong type", in: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFloatValue(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !equalFloat(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseItemPaintSeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		seed   *int
+		index  *int
+	}{
+		{name: "absent"},
+		{name: "ui keys", fields: `, "ui_paintseed": 661, "ui_paintindex": "44"`, seed: intPtr(661), index: intPtr(44)},
+		{name: "fallback keys", fields: `, "paintseed": "387", "paintindex": 44`, seed: intPtr(387), index: intPtr(44)},
+		{name: "zero seed", fields: `, "ui_paintseed": 0`, seed: intPtr(0)},
+		{name: "empty", fields: `, "ui_paintseed": "", "ui_paintindex": null`},
+		{name: "malformed", fields: `, "ui_paintseed": "abc", "ui_paintindex": 4.5`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := parsePayload(t, "csgo", `{"i_market_name": "AK-47 | Case Hardened (Field-Tested)", "ui_price": "150"`+tt.fields+`}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalInt(item.PaintSeed, tt.seed) || !equalInt(item.PaintIndex, tt.index) {
+				t.Errorf("seed %v index %v, want %v and %v", item.PaintSeed, item.PaintIndex, tt.seed, tt.index)
+			}
+		})
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func equalInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestNumberPrecision(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		price    string
+		stickers []Sticker
+	}{
+		{
+			name:     "15-digit sticker id",
+			payload:  `{"i_market_name": "AWP | Dragon Lore (Factory New)", "ui_price": 9000.01, "stickers": [123456789012345]}`,
+			price:    "9000.01",
+			stickers: []Sticker{{ID: 123456789012345}},
+		},
+		{
+			name:     "id beyond float64 precision",
+			payload:  `{"i_market_name": "AWP | Dragon Lore (Factory New)", "ui_price": 1, "stickers": [{"id": 9007199254740993}]}`,
+			price:    "1",
+			stickers: []Sticker{{ID: 9007199254740993}},
+		},
+		{
+			name:    "price keeps its digits",
+			payload: `{"i_market_name": "M9 Bayonet | Lore (Minimal Wear)", "ui_price": 1234.5}`,
+			price:   "1234.5",
+		},
+		{
+			name:    "sub-cent price",
+			payload: `{"i_market_name": "Sticker | Tyloo", "ui_price": 0.005}`,
+			price:   "0.005",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data map[string]interface{}
+			if err := decodeJSON([]byte(tt.payload), &data); err != nil {
+				t.Fatal(err)
+			}
+			if got := getValue(data, "ui_price"); got != tt.price {
+				t.Errorf("getValue = %q, want %q", got, tt.price)
+			}
+			item, err := parseItem(data, gameProfiles["csgo"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalStickers(item.Stickers, tt.stickers) {
+				t.Errorf("stickers = %v, want %v", item.Stickers, tt.stickers)
+			}
+		})
+	}
+}
+
+func TestParseStickers(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		want     []Sticker
+		warnings int
+	}{
+		{name: "absent", json: `null`},
+		{name: "empty", json: `[]`},
+		{name: "numeric array", json: `[5021, 4783]`, want: []Sticker{{ID: 5021}, {ID: 4783}}},
+		{
+			name: "object array",
+			json: `[{"id": 5021, "name": "Crown (Foil)", "wear": 0.12}, {"name": "Titan | Katowice 2014"}]`,
+			want: []Sticker{{ID: 5021, Name: "Crown (Foil)", Wear: floatPtr(0.12)}, {Name: "Titan | Katowice 2014"}},
+		},
+		{name: "string ids", json: `["12", "x"]`, want: []Sticker{{ID: 12}}, warnings: 1},
+		{name: "object without id or name", json: `[{"wear": 0.5}, {"id": 7}]`, want: []Sticker{{ID: 7}}, warnings: 1},
+		{name: "unreadable wear", json: `[{"id": 7, "wear": "scratched"}]`, want: []Sticker{{ID: 7}}, warnings: 1},
+		{name: "not an array", json: `{"id": 7}`, warnings: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var val interface{}
+			if err := decodeJSON([]byte(tt.json), &val); err != nil {
+				t.Fatal(err)
+			}
+			got, warnings := parseStickers(val)
+			if !equalStickers(got, tt.want) {
+				t.Errorf("stickers = %v, want %v", got, tt.want)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("warnings %q, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestParseItemListedAt(t *testing.T) {
+	listed := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		fields string
+		want   *time.Time
+	}{
+		{name: "absent"},
+		{name: "epoch seconds", fields: `, "ui_date": 1714566600`, want: &listed},
+		{name: "epoch seconds as string", fields: `, "ui_date": "1714566600"`, want: &listed},
+		{name: "epoch milliseconds", fields: `, "time": 1714566600000`, want: &listed},
+		{name: "rfc3339", fields: `, "ui_date": "2024-05-01T14:30:00+02:00"`, want: &listed},
+		{name: "without zone", fields: `, "ui_date": "2024-05-01 12:30:00"`, want: &listed},
+		{name: "fallback key", fields: `, "ui_date": "", "time": "2024-05-01T12:30:00"`, want: &listed},
+		{name: "zero", fields: `, "ui_date": 0`},
+		{name: "unreadable", fields: `, "ui_date": "last tuesday"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := parsePayload(t, "csgo", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"`+tt.fields+`}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (item.ListedAt == nil) != (tt.want == nil) || item.ListedAt != nil && !item.ListedAt.Equal(*tt.want) {
+				t.Errorf("listed at %v, want %v", item.ListedAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemLatency(t *testing.T) {
+	listed := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		item Item
+		want time.Duration
+	}{
+		{name: "listed", item: Item{ListedAt: &listed, ReceivedAt: listed.Add(1500 * time.Millisecond)}, want: 1500 * time.Millisecond},
+		{name: "not listed", item: Item{ReceivedAt: listed}},
+		{name: "not received", item: Item{ListedAt: &listed}},
+	}
+	for _, tt := range tests {
+		if got := tt.item.Latency(); got != tt.want {
+			t.Errorf("%s: latency %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestItemID(t *testing.T) {
+	listed := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	base := func() *Item {
+		return &Item{
+			MarketName: "AK-47 | Redline (Field-Tested)",
+			InspectURL: "steam://rungame/730/76561202255233023/+csgo_econ_action_preview M4108481252793458462A29194971250D1156893335530217395",
+			Float:      floatPtr(0.2711),
+			Price:      12.5,
+			ListedAt:   &listed,
+		}
+	}
+	id := base().ID()
+	if len(id) != IDLength {
+		t.Fatalf("ID %q has %d digits, want %d", id, len(id), IDLength)
+	}
+
+	same := []struct {
+		name   string
+		change func(*Item)
+	}{
+		{name: "received later", change: func(i *Item) { i.ReceivedAt = time.Now() }},
+		{name: "other zone", change: func(i *Item) { at := listed.In(time.FixedZone("MSK", 3*3600)); i.ListedAt = &at }},
+		{name: "enriched", change: func(i *Item) { i.Market, i.ImageURL, i.HighPriority = "csgo", "https://cdn.example.com/ak.png", true }},
+	}
+	for _, tt := range same {
+		item := base()
+		tt.change(item)
+		if got := item.ID(); got != id {
+			t.Errorf("%s: ID %s, want %s", tt.name, got, id)
+		}
+	}
+
+	differ := []struct {
+		name   string
+		change func(*Item)
+	}{
+		{name: "name", change: func(i *Item) { i.MarketName = "AK-47 | Redline (Minimal Wear)" }},
+		{name: "inspect link", change: func(i *Item) { i.InspectURL = "" }},
+		{name: "float", change: func(i *Item) { i.Float = floatPtr(0.2712) }},
+		{name: "no float", change: func(i *Item) { i.Float = nil }},
+		{name: "price", change: func(i *Item) { i.Price = 12.51 }},
+		{name: "listed", change: func(i *Item) { at := listed.Add(time.Second); i.ListedAt = &at }},
+		{name: "fields run together", change: func(i *Item) { i.MarketName, i.InspectURL = i.MarketName+i.InspectURL, "" }},
+	}
+	for _, tt := range differ {
+		item := base()
+		tt.change(item)
+		if got := item.ID(); got == id {
+			t.Errorf("%s: ID unchanged", tt.name)
+		}
+	}
+
+	out, err := json.Marshal(base())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct{ ID string }
+	if err := json.Unmarshal(out, &decoded); err != nil || decoded.ID != id {
+		t.Errorf("JSON id %q, want %s: %v", decoded.ID, id, err)
+	}
+}
@@ -0,0 +1,142 @@
+package marketwatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ListingRateWindow is the width in seconds of the rolling window for the
+// listings-per-minute rate.
+const ListingRateWindow = 60
+
+// Listing rate alert states.
+const (
+	rateNormal = iota
+	rateHigh
+	rateLow
+)
+
+// listingRate counts new listings in a ring of per-second buckets. Each
+// bucket remembers the second it counts, so a stale one is reset the next
+// time it is written and skipped when summing; record is O(1).
+type listingRate struct {
+	mu      sync.Mutex
+	buckets [ListingRateWindow]int64
+	seconds [ListingRateWindow]int64
+	started time.Time
+
+	// Alert thresholds in listings per minute, 0 when unset, and the
+	// hysteresis as a fraction of the threshold.
+	high, low  float64
+	hysteresis float64
+	state      int
+
+	now     func() time.Time
+	alert   func(text string)
+	metrics *metrics
+	logger  *slog.Logger
+}
+
+func newListingRate(high, low, hysteresisPct float64, m *metrics, logger *slog.Logger) *listingRate {
+	r := &listingRate{
+		high:       high,
+		low:        low,
+		hysteresis: hysteresisPct / 100,
+		now:        time.Now,
+		metrics:    m,
+		logger:     logger,
+	}
+	r.started = r.now()
+	return r
+}
+
+func (r *listingRate) record() {
+	second := r.now().Unix()
+	idx := second % ListingRateWindow
+	r.mu.Lock()
+	if r.seconds[idx] != second {
+		r.seconds[idx] = second
+		r.buckets[idx] = 0
+	}
+	r.buckets[idx]++
+	r.mu.Unlock()
+}
+
+// Rate is the number of listings in the last minute.
+func (r *listingRate) Rate() float64 {
+	now := r.now().Unix()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for i, second := range r.seconds {
+		if second > now-ListingRateWindow && second <= now {
+			total += r.buckets[i]
+		}
+	}
+	return float64(total)
+}
+
+// check compares the rate with the thresholds and alerts on a crossing.
+// An alert clears only once the rate is back past the threshold by the
+// hysteresis, so a rate hovering at a threshold alerts once. The low
+// threshold is not checked until a full window has been counted.
+func (r *listingRate) check() {
+	rate := r.Rate()
+	r.metrics.listingRate.Set(rate)
+
+	r.mu.Lock()
+	prev := r.state
+	warm := r.now().Sub(r.started) >= ListingRateWindow*time.Second
+	switch r.state {
+	case rateNormal:
+		if r.high > 0 && rate > r.high {
+			r.state = rateHigh
+		} else if r.low > 0 && warm && rate < r.low {
+			r.state = rateLow
+		}
+	case rateHigh:
+		if rate < r.high*(1-r.hysteresis) {
+			r.state = rateNormal
+		}
+	case rateLow:
+		if rate > r.low*(1+r.hysteresis) {
+			r.state = rateNormal
+		}
+	}
+	state := r.state
+	r.mu.Unlock()
+	if state == prev {
+		return
+	}
+
+	var text string
+	switch state {
+	case rateHigh:
+		text = fmt.Sprintf("Listing rate spiked to %.0f/min, above %g/min", rate, r.high)
+	case rateLow:
+		text = fmt.Sprintf("Listing rate dropped to %.0f/min, below %g/min", rate, r.low)
+	default:
+		text = fmt.Sprintf("Listing rate back to normal at %.0f/min", rate)
+	}
+	r.logger.Warn("Listing rate alert", "event", "listing_rate", "rate", rate, "message", text)
+	if r.alert != nil {
+		r.alert(text)
+	}
+}
+
+// Run checks the rate once a second.
+func (r *listingRate) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
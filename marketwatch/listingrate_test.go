@@ -0,0 +1,75 @@
+package marketwatch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestListingRateAlerts(t *testing.T) {
+	clock := newFakeClock()
+	m := newMetrics()
+	r := newListingRate(10, 2, 20, m, testLogger)
+	r.now = clock.Now
+	r.started = clock.Now()
+	var alerts []string
+	r.alert = func(text string) { alerts = append(alerts, text) }
+
+	steps := []struct {
+		advance  time.Duration
+		listings int
+		rate     float64
+		alert    string // prefix of the alert the check sends, if any
+	}{
+		// Too early to call the rate low.
+		{0, 0, 0, ""},
+		{0, 3, 3, ""},
+		{time.Second, 8, 11, "Listing rate spiked to 11/min"},
+		{time.Second, 0, 11, ""},
+		// The first second leaves the window; 8 is not below 10 by the 20%
+		// hysteresis yet.
+		{58 * time.Second, 0, 8, ""},
+		// The bucket for the second second is reused.
+		{time.Second, 7, 7, "Listing rate back to normal at 7/min"},
+		{61 * time.Second, 1, 1, "Listing rate dropped to 1/min"},
+		{time.Second, 1, 2, ""},
+		{time.Second, 1, 3, "Listing rate back to normal at 3/min"},
+		{time.Second, 0, 3, ""},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		for j := 0; j < s.listings; j++ {
+			r.record()
+		}
+		alerts = nil
+		r.check()
+		if got := r.Rate(); got != s.rate {
+			t.Errorf("step %d: rate %g, want %g", i, got, s.rate)
+		}
+		if got := testutil.ToFloat64(m.listingRate); got != s.rate {
+			t.Errorf("step %d: gauge %g, want %g", i, got, s.rate)
+		}
+		switch {
+		case s.alert == "" && len(alerts) > 0:
+			t.Errorf("step %d: unexpected alert %q", i, alerts)
+		case s.alert != "" && (len(alerts) != 1 || !strings.HasPrefix(alerts[0], s.alert)):
+			t.Errorf("step %d: alerts %q, want %q", i, alerts, s.alert)
+		}
+	}
+}
+
+func TestListingRateUnsetThresholds(t *testing.T) {
+	clock := newFakeClock()
+	r := newListingRate(0, 0, 20, newMetrics(), testLogger)
+	r.now = clock.Now
+	r.started = clock.Now()
+	r.alert = func(text string) { t.Errorf("alert %q without thresholds", text) }
+	for i := 0; i < 1000; i++ {
+		r.record()
+	}
+	r.check()
+	clock.Advance(2 * time.Minute)
+	r.check()
+}
@@ -0,0 +1,102 @@
+package marketwatch
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FilterSettings are the item filters that can be changed while the watcher
+// runs, through POST /config. The other filters are fixed at startup.
+type FilterSettings struct {
+	MinPrice  float64  `json:"min_price"`
+	MaxPrice  float64  `json:"max_price"`
+	MinFloat  float64  `json:"min_float"`
+	MaxFloat  float64  `json:"max_float"`
+	Include   []string `json:"include"`
+	Exclude   []string `json:"exclude"`
+	Qualities []string `json:"qualities"`
+	Filter    string   `json:"filter"`
+}
+
+func (c *Config) filterSettings() FilterSettings {
+	return FilterSettings{
+		MinPrice:  c.MinPrice,
+		MaxPrice:  c.MaxPrice,
+		MinFloat:  c.MinFloat,
+		MaxFloat:  c.MaxFloat,
+		Include:   c.Include,
+		Exclude:   c.Exclude,
+		Qualities: c.Qualities,
+		Filter:    c.Filter,
+	}
+}
+
+// activeFilters is one validated set of settings with its lookups built.
+// It is never modified, so an item is checked against a single set even if
+// an update lands halfway through.
+type activeFilters struct {
+	FilterSettings
+	qualities map[string]bool
+	expr      *itemFilter
+}
+
+func buildFilters(s FilterSettings) (*activeFilters, error) {
+	if s.MinPrice < 0 || s.MaxPrice < 0 || (s.MaxPrice > 0 && s.MinPrice > s.MaxPrice) {
+		return nil, fmt.Errorf("invalid price range %.2f-%.2f", s.MinPrice, s.MaxPrice)
+	}
+	if s.MinFloat < 0 || s.MaxFloat < 0 || (s.MaxFloat > 0 && s.MinFloat > s.MaxFloat) {
+		return nil, fmt.Errorf("invalid float range %g-%g", s.MinFloat, s.MaxFloat)
+	}
+	f := &activeFilters{FilterSettings: s, qualities: qualitySet(s.Qualities)}
+	if s.Filter != "" {
+		expr, err := compileFilter(s.Filter)
+		if err != nil {
+			return nil, err
+		}
+		f.expr = expr
+	}
+	return f, nil
+}
+
+// liveFilters holds the filters every watcher consults, shared so an update
+// applies to all markets at once.
+type liveFilters struct {
+	mu     sync.RWMutex
+	active *activeFilters
+}
+
+func newLiveFilters(s FilterSettings) (*liveFilters, error) {
+	active, err := buildFilters(s)
+	if err != nil {
+		return nil, err
+	}
+	return &liveFilters{active: active}, nil
+}
+
+func (f *liveFilters) current() *activeFilters {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.active
+}
+
+// Update replaces the settings; invalid ones are rejected and the running
+// filters are left as they were.
+func (f *liveFilters) Update(s FilterSettings) error {
+	active, err := buildFilters(s)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.active = active
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *liveFilters) Settings() FilterSettings {
+	return f.current().FilterSettings
+}
+
+func (f *activeFilters) any() bool {
+	return f.MinPrice > 0 || f.MaxPrice > 0 || f.MinFloat > 0 || f.MaxFloat > 0 ||
+		len(f.Include) > 0 || len(f.Exclude) > 0 || len(f.Qualities) > 0 || f.expr != nil
+}
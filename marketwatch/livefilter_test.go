@@ -0,0 +1,113 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConfigUpdate(t *testing.T) {
+	d, items := newTestWatcher(t, nil, nil)
+	api := &apiServer{filters: d.filters, watchers: []*MarketWatcher{d}, logger: testLogger}
+	control := httptest.NewServer(api.controlHandler())
+	defer control.Close()
+	public := httptest.NewServer(api.handler())
+	defer public.Close()
+
+	matches := func(price string) bool {
+		d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "`+price+`"}`))
+		select {
+		case <-items:
+			return true
+		default:
+			return false
+		}
+	}
+
+	steps := []struct {
+		name   string
+		body   string
+		status int
+		// maxPrice is the max_price GET /config reports afterwards.
+		maxPrice float64
+		// passes and fails are prices that must and must not match.
+		passes, fails string
+	}{
+		{name: "unfiltered", passes: "60"},
+		{name: "update", body: `{"max_price": 50}`, status: http.StatusOK, maxPrice: 50, passes: "40", fails: "60"},
+		{name: "invalid range", body: `{"min_price": 80}`, status: http.StatusBadRequest, maxPrice: 50, passes: "40", fails: "60"},
+		{name: "unknown field", body: `{"colour": "red"}`, status: http.StatusBadRequest, maxPrice: 50, passes: "40"},
+		{name: "invalid expression", body: `{"filter": "price <"}`, status: http.StatusBadRequest, maxPrice: 50, passes: "40"},
+		{name: "expression", body: `{"filter": "price > 30"}`, status: http.StatusOK, maxPrice: 50, passes: "40", fails: "20"},
+		{name: "clear", body: `{"max_price": 0, "filter": ""}`, status: http.StatusOK, passes: "60"},
+	}
+	for _, s := range steps {
+		if s.body != "" {
+			resp, err := http.Post(control.URL+"/config", "application/json", strings.NewReader(s.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != s.status {
+				t.Errorf("%s: POST /config = %d, want %d", s.name, resp.StatusCode, s.status)
+			}
+		}
+
+		resp, err := http.Get(public.URL + "/config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var settings FilterSettings
+		err = json.NewDecoder(resp.Body).Decode(&settings)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if settings.MaxPrice != s.maxPrice {
+			t.Errorf("%s: max_price = %g, want %g", s.name, settings.MaxPrice, s.maxPrice)
+		}
+
+		if s.passes != "" && !matches(s.passes) {
+			t.Errorf("%s: item at %s filtered out", s.name, s.passes)
+		}
+		if s.fails != "" && matches(s.fails) {
+			t.Errorf("%s: item at %s passed", s.name, s.fails)
+		}
+	}
+
+	resp, err := http.Post(public.URL+"/config", "application/json", strings.NewReader(`{"max_price": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST to the read-only API = %d, want 405", resp.StatusCode)
+	}
+}
+
+// TestConfigUpdateConcurrent is for -race: updates land while the read
+// loop consults the filters.
+func TestConfigUpdateConcurrent(t *testing.T) {
+	d, _ := newTestWatcher(t, nil, nil)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"}`))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if err := d.filters.Update(FilterSettings{MaxPrice: float64(i % 20), Include: []string{"ak-47"}}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
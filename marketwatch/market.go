@@ -0,0 +1,35 @@
+package marketwatch
+
+import (
+	"fmt"
+	"net/url"
+)
+
+type MarketConfig struct {
+	Name      string `json:"name" yaml:"name"`
+	WSURL     string `json:"ws_url" yaml:"ws_url"`
+	Origin    string `json:"origin" yaml:"origin"`
+	TokenURL  string `json:"token_url" yaml:"token_url"`
+	PricesURL string `json:"prices_url,omitempty" yaml:"prices_url,omitempty"`
+	// HistoryURL serves items listed since a Unix time, used by -backfill.
+	HistoryURL string   `json:"history_url,omitempty" yaml:"history_url,omitempty"`
+	Channels   []string `json:"channels,omitempty" yaml:"channels,omitempty"`
+	// Game names the GameProfile for the market's payloads, -game if empty.
+	Game string `json:"game,omitempty" yaml:"game,omitempty"`
+	// AppID is the Steam app the market trades, used for item images.
+	AppID int `json:"app_id,omitempty" yaml:"app_id,omitempty"`
+}
+
+func (m MarketConfig) validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("market without a name")
+	}
+	if m.WSURL == "" || m.TokenURL == "" {
+		return fmt.Errorf("market %s: ws_url and token_url are required", m.Name)
+	}
+	return nil
+}
+
+func (m MarketConfig) tokenRequestURL(apiKey string) string {
+	return fmt.Sprintf("%s?key=%s", m.TokenURL, url.QueryEscape(apiKey))
+}
@@ -0,0 +1,461 @@
+// Package marketwatch watches the CS market WebSocket feeds and delivers
+// new listings that pass the configured filters.
+//
+// The market-ws command is a thin wrapper around it; to embed the watcher,
+// build a Config (DefaultConfig or LoadConfig), start Run and read Items:
+//
+//	cfg := marketwatch.DefaultConfig()
+//	cfg.APIKey = key
+//	w := marketwatch.New(*cfg)
+//	go func() {
+//		for item := range w.Items() {
+//			...
+//		}
+//	}()
+//	err := w.Run(ctx)
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const ItemsBufferSize = 100
+
+// Watcher runs one MarketWatcher per market and API key together with the
+// sinks the config asks for.
+type Watcher struct {
+	config *Config
+	logger *slog.Logger
+	items  chan *Item
+	stats  *Stats
+	// Set when the config names a blacklist or watchlist file; Run loads
+	// them.
+	blacklist *blacklist
+	watchlist *watchlist
+	sinks     []namedSink
+}
+
+type namedSink struct {
+	name string
+	sink Sink
+}
+
+// New does no I/O; everything the config asks for is set up by Run, which
+// also reports setup errors.
+func New(cfg Config) *Watcher {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.APIKey != "" && !slices.Contains(cfg.APIKeys, cfg.APIKey) {
+		cfg.APIKeys = append(stringList{cfg.APIKey}, cfg.APIKeys...)
+	}
+	w := &Watcher{
+		config: &cfg,
+		logger: logger,
+		items:  make(chan *Item, ItemsBufferSize),
+		stats:  newStats(),
+	}
+	if cfg.BlacklistPath != "" {
+		w.blacklist = newBlacklist(cfg.BlacklistPath)
+	}
+	if cfg.WatchlistPath != "" {
+		w.watchlist = newWatchlist(cfg.WatchlistPath)
+	}
+	return w
+}
+
+// ReloadBlacklist reads the blacklist file again, keeping the current
+// entries if it cannot. The command calls it on SIGHUP.
+func (w *Watcher) ReloadBlacklist() error {
+	if w.blacklist == nil {
+		return errors.New("no blacklist file configured")
+	}
+	if err := w.blacklist.Load(); err != nil {
+		return fmt.Errorf("load blacklist: %w", err)
+	}
+	w.logger.Info("Blacklist reloaded", "path", w.blacklist.path, "entries", w.blacklist.Len())
+	return nil
+}
+
+// ReloadWatchlist reads the watchlist file again, keeping the current
+// names if it cannot. The command calls it on SIGHUP.
+func (w *Watcher) ReloadWatchlist() error {
+	if w.watchlist == nil {
+		return errors.New("no watchlist file configured")
+	}
+	if err := w.watchlist.Load(); err != nil {
+		return fmt.Errorf("load watchlist: %w", err)
+	}
+	w.logger.Info("Watchlist reloaded", "path", w.watchlist.path, "names", w.watchlist.Len())
+	return nil
+}
+
+// AddSink delivers the items passing the filters to sink as well, next to
+// the sinks the config sets up. It must be called before Run.
+func (w *Watcher) AddSink(name string, sink Sink) {
+	w.sinks = append(w.sinks, namedSink{name: name, sink: sink})
+}
+
+// Stats returns the session counters so far, the same ones GET /stats
+// serves.
+func (w *Watcher) Stats() StatsSnapshot {
+	return w.stats.Snapshot()
+}
+
+// Items delivers the items that passed every filter, the same ones written
+// to Config.Output. Items are dropped while the buffer is full, so a
+// consumer that falls behind cannot stall the feed. The channel is closed
+// when Run returns.
+func (w *Watcher) Items() <-chan *Item {
+	return w.items
+}
+
+// Run connects to every configured market and blocks until ctx is cancelled
+// or all of them have given up, in which case it returns their errors. With
+// ReplayPath set it replays the file through the first market instead.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.items)
+	cfg, logger := w.config, w.logger
+	if len(cfg.APIKeys) == 0 {
+		return errors.New("API key is not set")
+	}
+	if err := resolveMarkets(cfg); err != nil {
+		return err
+	}
+
+	filters, err := newLiveFilters(cfg.filterSettings())
+	if err != nil {
+		return err
+	}
+	fields, err := parseFields(cfg.Fields)
+	if err != nil {
+		return err
+	}
+	if w.blacklist != nil {
+		if err := w.blacklist.Load(); err != nil {
+			return fmt.Errorf("load blacklist: %w", err)
+		}
+		logger.Info("Blacklist loaded", "path", cfg.BlacklistPath, "entries", w.blacklist.Len())
+	}
+	if w.watchlist != nil {
+		if err := w.watchlist.Load(); err != nil {
+			return fmt.Errorf("load watchlist: %w", err)
+		}
+		logger.Info("Watchlist loaded", "path", cfg.WatchlistPath, "names", w.watchlist.Len())
+	}
+	if cfg.JSONOutput() && cfg.jsonIndent() != "" {
+		logger.Warn("JSON output is indented: an event spans several lines, so it is not JSONL")
+	}
+
+	m := newMetrics()
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(ctx, cfg.MetricsAddr, m, logger)
+	}
+
+	// Notifications and float lookups go out through -proxy and the TLS
+	// settings, same as the feed.
+	tlsConfig, err := newTLSConfig(cfg.CAFile, cfg.PinSHA256)
+	if err != nil {
+		return fmt.Errorf("TLS setup: %w", err)
+	}
+	httpClient, dialer, err := newTransport(cfg.Proxy, tlsConfig, time.Duration(cfg.HTTPTimeout))
+	if err != nil {
+		return fmt.Errorf("transport setup: %w", err)
+	}
+	// Servers without permessage-deflate just decline the extension.
+	dialer.EnableCompression = cfg.Compression
+
+	var notifiers []Notifier
+	if cfg.DiscordWebhook != "" {
+		notifiers = append(notifiers, NewDiscordNotifier(cfg.DiscordWebhook, httpClient.Transport))
+	}
+	if cfg.TelegramToken != "" {
+		telegram := NewTelegramNotifier(cfg.TelegramToken, cfg.TelegramChatID, httpClient.Transport, logger)
+		go telegram.Run(ctx)
+		notifiers = append(notifiers, telegram)
+	}
+	var notifier *notifyDispatcher
+	if len(notifiers) > 0 {
+		notifier = newNotifyDispatcher(logger, notifiers...)
+		go notifier.Run(ctx)
+	}
+
+	var listings *listingRate
+	if cfg.ListingRateHigh > 0 || cfg.ListingRateLow > 0 {
+		listings = newListingRate(cfg.ListingRateHigh, cfg.ListingRateLow, cfg.ListingRateHysteresis, m, logger)
+		if notifier != nil {
+			listings.alert = notifier.Alert
+		}
+		go listings.Run(ctx)
+	}
+
+	var store Store
+	if cfg.DBPath != "" || cfg.PostgresDSN != "" {
+		var err error
+		if cfg.PostgresDSN != "" {
+			store, err = NewPostgresStore(cfg.PostgresDSN, logger)
+		} else {
+			store, err = NewSQLiteStore(cfg.DBPath, logger)
+		}
+		if err != nil {
+			return fmt.Errorf("open store: %w", err)
+		}
+		defer store.Close()
+	}
+
+	var publisher *publishQueue
+	if cfg.NATSURL != "" || len(cfg.KafkaBrokers) > 0 {
+		var p Publisher
+		if cfg.NATSURL != "" {
+			var err error
+			p, err = NewNATSPublisher(cfg.NATSURL, cfg.Topic)
+			if err != nil {
+				return fmt.Errorf("connect to NATS: %w", err)
+			}
+		} else {
+			p = NewKafkaPublisher(cfg.KafkaBrokers, cfg.Topic, logger)
+		}
+		defer p.Close()
+		publisher = newPublishQueue(p, m, logger)
+		go publisher.Run(ctx)
+	}
+
+	var cooldowns *cooldownTracker
+	if cfg.PerNameCooldown > 0 {
+		cooldowns = newCooldownTracker(time.Duration(cfg.PerNameCooldown), cfg.CooldownBypassPrice)
+	}
+
+	var floors *priceTracker
+	if cfg.UndercutPct > 0 {
+		floors = newPriceTracker(time.Duration(cfg.FloorWindow), cfg.UndercutPct)
+	}
+
+	var priceChanges *priceChangeTracker
+	if cfg.PriceChanges {
+		priceChanges = newPriceChangeTracker(time.Duration(cfg.PriceChangeTTL))
+	}
+
+	var dedup deduper
+	window := time.Duration(cfg.DedupWindow)
+	if window == 0 && len(cfg.APIKeys) > 1 {
+		logger.Info("Deduplication enabled for multiple API keys", "window", DedupWindow)
+		window = DedupWindow
+	}
+	if window > 0 {
+		if cfg.DedupStrategy == DedupBloom {
+			dedup = newRotatingBloom(window, cfg.DedupCapacity, cfg.DedupFPRate)
+		} else {
+			dedup = newDedupCache(window)
+		}
+	}
+	if cfg.PersistDedup != "" {
+		persisted, err := openPersistentDedup(cfg.PersistDedup, time.Duration(cfg.PersistDedupTTL), logger)
+		if err != nil {
+			return fmt.Errorf("open persistent dedup: %w", err)
+		}
+		defer persisted.Close()
+		if dedup != nil {
+			dedup = dedupChain{dedup, persisted}
+		} else {
+			dedup = persisted
+		}
+	}
+
+	var rates RateProvider
+	if cfg.BaseCurrency != "" {
+		fx := newFXRateProvider(logger)
+		go fx.Run(ctx)
+		rates = fx
+	}
+
+	var hooks *hookRunner
+	if len(cfg.TradeHookURLs) > 0 {
+		hooks = newHookRunner(time.Duration(cfg.HookTimeout), logger)
+		for _, url := range cfg.TradeHookURLs {
+			hook := NewHTTPHook(url, time.Duration(cfg.HookTimeout))
+			hook.Secret = []byte(cfg.WebhookSecret)
+			hooks.Register(hook)
+		}
+	}
+
+	var csvOut *csvWriter
+	if cfg.CSVPath != "" {
+		var err error
+		csvOut, err = newCSVWriter(cfg.CSVPath, cfg.CSVMaxSize, fields)
+		if err != nil {
+			return fmt.Errorf("open CSV: %w", err)
+		}
+		defer csvOut.Close()
+		go csvOut.Run(ctx)
+	}
+
+	var capture io.Writer
+	if cfg.CapturePath != "" {
+		captureFile, err := os.OpenFile(cfg.CapturePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open capture file: %w", err)
+		}
+		defer captureFile.Close()
+		capture = &lockedWriter{w: captureFile}
+	}
+
+	var unparsed *parseErrorCapture
+	if cfg.ParseErrorsDir != "" {
+		var err error
+		unparsed, err = newParseErrorCapture(cfg.ParseErrorsDir, cfg.ParseErrorsMax)
+		if err != nil {
+			return fmt.Errorf("open parse errors directory: %w", err)
+		}
+	}
+
+	var recent *itemRing
+	var stream *streamHub
+	if cfg.HTTPAddr != "" {
+		recent = newItemRing(cfg.RingSize)
+		stream = newStreamHub()
+	}
+
+	sinks := newSinkFanOut(m, logger)
+	if store != nil {
+		sinks.Register("store", SinkFiltered, storeSink{store})
+	}
+	if publisher != nil {
+		sinks.Register("publish", SinkParsed, publisher)
+	}
+	if recent != nil {
+		sinks.Register("recent", SinkMatched, recent)
+		sinks.Register("stream", SinkMatched, stream)
+	}
+	if csvOut != nil {
+		sinks.Register("csv", SinkMatched, csvOut)
+	}
+	if notifier != nil {
+		sinks.Register("notify", SinkMatched, notifier)
+	}
+	if hooks != nil {
+		sinks.Register("hooks", SinkMatched, hooks)
+	}
+	for _, extra := range w.sinks {
+		sinks.Register(extra.name, SinkMatched, extra.sink)
+	}
+	sinks.Start(ctx)
+	defer sinks.Close()
+
+	var limiter *throttle
+	if cfg.SampleRate > 1 || cfg.RateLimit > 0 {
+		limiter = newThrottle(cfg.SampleRate, cfg.RateLimit)
+	}
+
+	var floats *floatChecker
+	if cfg.FloatCheckURL != "" {
+		floats = newFloatChecker(cfg.FloatCheckURL, httpClient.Transport, time.Duration(cfg.FloatTimeout), cfg.FloatConcurrency)
+	}
+
+	stats := w.stats
+	if cfg.BandwidthStats {
+		stats.bandwidth = newBandwidthMeter(m)
+		go stats.bandwidth.Run(ctx)
+	}
+	if cfg.StatsInterval > 0 {
+		go stats.LogEvery(ctx, time.Duration(cfg.StatsInterval), logger)
+	}
+	defer stats.Log(logger)
+
+	var out io.Writer = io.Discard
+	if cfg.Output != nil {
+		out = &lockedWriter{w: cfg.Output}
+	}
+	var watchers []*MarketWatcher
+	for _, market := range cfg.Markets {
+		var refs ReferencePriceProvider
+		if cfg.MinDiscount > 0 && market.PricesURL != "" {
+			provider := newPriceListProvider(market.PricesURL, logger.With("market", market.Name))
+			go provider.Run(ctx)
+			refs = provider
+		}
+		for i, key := range cfg.APIKeys {
+			watcherLogger := logger.With("market", market.Name)
+			watcher := NewMarketWatcher(market, cfg, watcherLogger, out, m, stats)
+			// Every key gets its own connection to the same channels; the
+			// shared dedup cache drops the items they have in common.
+			if len(cfg.APIKeys) > 1 {
+				watcher.name = fmt.Sprintf("%s/%d", market.Name, i+1)
+				watcher.logger = watcherLogger.With("account", i+1)
+			}
+			watcher.apiKey = key
+			watcher.refs = refs
+			watchers = append(watchers, watcher)
+		}
+	}
+	// Ready once for the process, whichever market gets there first.
+	ready := new(sync.Once)
+	for _, watcher := range watchers {
+		watcher.ready = ready
+		watcher.items = w.items
+		watcher.filters = filters
+		watcher.fields = fields
+		watcher.sinks = sinks
+		watcher.notifier = notifier
+		watcher.dedup = dedup
+		watcher.floors = floors
+		watcher.priceChanges = priceChanges
+		watcher.floats = floats
+		watcher.ctx = ctx
+		watcher.cooldowns = cooldowns
+		watcher.rates = rates
+		watcher.throttle = limiter
+		watcher.capture = capture
+		watcher.unparsed = unparsed
+		watcher.bandwidth = stats.bandwidth
+		watcher.listings = listings
+		watcher.blacklist = w.blacklist
+		watcher.watchlist = w.watchlist
+		watcher.httpClient = httpClient
+		watcher.dialer = dialer
+	}
+
+	api := &apiServer{ring: recent, stream: stream, watchers: watchers, stats: stats, filters: filters, listings: listings, logger: logger}
+	if cfg.HTTPAddr != "" {
+		go serveAPI(ctx, cfg.HTTPAddr, api, logger)
+	}
+	if cfg.ControlAddr != "" {
+		go serveControl(ctx, cfg.ControlAddr, api, logger)
+	}
+
+	if cfg.ReplayPath != "" {
+		watcher := watchers[0]
+		watcher.logger.Info("Replaying messages", "path", cfg.ReplayPath)
+		if err := watcher.Replay(ctx, cfg.ReplayPath, cfg.ReplayRate); err != nil && !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("replay: %w", err)
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(watchers))
+	for i, watcher := range watchers {
+		wg.Add(1)
+		go func(i int, watcher *MarketWatcher) {
+			defer wg.Done()
+			if err := watcher.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				watcher.logger.Error("Watcher stopped", "err", err)
+				errs[i] = fmt.Errorf("%s: %w", watcher.name, err)
+			}
+		}(i, watcher)
+	}
+	wg.Wait()
+	// With ctx cancelled this is a shutdown, whatever failed before it.
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,191 @@
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	messagesReceived prometheus.Counter
+	itemsParsed      prometheus.Counter
+	parseErrors      prometheus.Counter
+	itemsDropped     prometheus.Counter
+	publishDropped   prometheus.Counter
+	sinkDropped      *prometheus.CounterVec
+	sinkErrors       *prometheus.CounterVec
+	framesDropped    prometheus.Counter
+	bytesReceived    prometheus.Counter
+	reconnects       prometheus.Counter
+	tokenRefreshes   prometheus.Counter
+	historyEvents    *prometheus.CounterVec
+	priceChanges     prometheus.Counter
+	floatChecks      *prometheus.CounterVec
+	connected        *prometheus.GaugeVec
+	tokenBreaker     *prometheus.GaugeVec
+	state            *prometheus.GaugeVec
+	itemPrices       prometheus.Histogram
+	itemFloats       prometheus.Histogram
+	itemLatency      prometheus.Histogram
+	messageRate      prometheus.Gauge
+	messagePeakRate  prometheus.Gauge
+	listingRate      prometheus.Gauge
+	dialPhases       *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		messagesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_messages_received_total",
+			Help: "WebSocket messages received.",
+		}),
+		itemsParsed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_items_parsed_total",
+			Help: "Items successfully parsed from the feed.",
+		}),
+		parseErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_parse_errors_total",
+			Help: "Messages or items that failed to parse.",
+		}),
+		itemsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_items_dropped_total",
+			Help: "Items dropped by sampling or rate limiting.",
+		}),
+		sinkDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "market_sink_dropped_total",
+			Help: "Items dropped because a sink's queue was full, by sink.",
+		}, []string{"sink"}),
+		sinkErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "market_sink_errors_total",
+			Help: "Items a sink failed to consume, by sink.",
+		}, []string{"sink"}),
+		publishDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_publish_dropped_total",
+			Help: "Items not published because the publish queue was full.",
+		}),
+		framesDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_frames_dropped_total",
+			Help: "Messages dropped because the -workers queue was full.",
+		}),
+		bytesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_bytes_received_total",
+			Help: "Payload bytes read from the WebSocket, counted with -bandwidth-stats.",
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_reconnects_total",
+			Help: "Reconnect attempts.",
+		}),
+		tokenRefreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_token_refreshes_total",
+			Help: "Successful WebSocket token updates.",
+		}),
+		historyEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "market_history_events_total",
+			Help: "Events received on history channels, by kind.",
+		}, []string{"kind"}),
+		priceChanges: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "market_price_changes_total",
+			Help: "Items relisted at another price, with -price-changes.",
+		}),
+		floatChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "market_float_checks_total",
+			Help: "Float lookups on the -float-checker-url service, by result: found, cached or failed.",
+		}, []string{"result"}),
+		connected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "market_connected",
+			Help: "1 while the WebSocket connection to the market is up.",
+		}, []string{"market"}),
+		tokenBreaker: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "market_token_breaker_state",
+			Help: "State of the token endpoint circuit breaker: 0 closed, 1 half-open, 2 open.",
+		}, []string{"market"}),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "market_connection_state",
+			Help: "Connection state: 0 disconnected, 1 connecting, 2 authenticating, 3 subscribed, 4 reconnecting.",
+		}, []string{"market"}),
+		itemPrices: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "market_item_price",
+			Help:    "Prices of parsed items in their own currency.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 16),
+		}),
+		itemFloats: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "market_item_float",
+			Help:    "Float values of parsed items.",
+			Buckets: floatWearBuckets,
+		}),
+		itemLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "market_item_latency_seconds",
+			Help:    "Time from an item's listing to it being received, for items carrying a listing time.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 14),
+		}),
+		messageRate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "market_message_rate",
+			Help: "Messages per second averaged over the last minute, with -bandwidth-stats.",
+		}),
+		messagePeakRate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "market_message_rate_peak",
+			Help: "Most messages received in a single second this session, with -bandwidth-stats.",
+		}),
+		dialPhases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "market_dial_phase_seconds",
+			Help:    "Time spent in each phase of a WebSocket dial: dns, connect, tls, upgrade.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"phase"}),
+		listingRate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "market_listing_rate",
+			Help: "New listings received in the last minute, with -listing-rate-high or -listing-rate-low.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.messagesReceived,
+		m.itemsParsed,
+		m.parseErrors,
+		m.itemsDropped,
+		m.publishDropped,
+		m.sinkDropped,
+		m.sinkErrors,
+		m.framesDropped,
+		m.bytesReceived,
+		m.reconnects,
+		m.tokenRefreshes,
+		m.historyEvents,
+		m.priceChanges,
+		m.floatChecks,
+		m.connected,
+		m.tokenBreaker,
+		m.state,
+		m.itemPrices,
+		m.itemFloats,
+		m.itemLatency,
+		m.messageRate,
+		m.messagePeakRate,
+		m.listingRate,
+		m.dialPhases,
+	)
+	return m
+}
+
+func serveMetrics(ctx context.Context, addr string, m *metrics, logger *slog.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), CloseTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving metrics", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Metrics server failed", "err", err)
+	}
+}
@@ -0,0 +1,220 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NotifyQueueSize = 100
+	NotifyTimeout   = 10 * time.Second
+)
+
+type Notifier interface {
+	Notify(ctx context.Context, item *Item) error
+}
+
+// Alerter is implemented by notifiers that can also deliver plain text
+// alerts about the market, such as a listing rate spike.
+type Alerter interface {
+	Alert(ctx context.Context, text string) error
+}
+
+// notifyDispatcher delivers items to notifiers from its own goroutine so a
+// slow sink never blocks the read loop. Items are dropped when the queue is
+// full.
+type notifyDispatcher struct {
+	notifiers []Notifier
+	queue     chan *Item
+	alerts    chan string
+	logger    *slog.Logger
+}
+
+func newNotifyDispatcher(logger *slog.Logger, notifiers ...Notifier) *notifyDispatcher {
+	return &notifyDispatcher{
+		notifiers: notifiers,
+		queue:     make(chan *Item, NotifyQueueSize),
+		alerts:    make(chan string, NotifyQueueSize),
+		logger:    logger,
+	}
+}
+
+func (n *notifyDispatcher) Enqueue(item *Item) {
+	select {
+	case n.queue <- item:
+	default:
+		n.logger.Warn("Notification queue full, dropping item", "market_name", item.MarketName)
+	}
+}
+
+// Alert queues text for the notifiers that implement Alerter.
+func (n *notifyDispatcher) Alert(text string) {
+	select {
+	case n.alerts <- text:
+	default:
+		n.logger.Warn("Notification queue full, dropping alert", "message", text)
+	}
+}
+
+func (n *notifyDispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-n.queue:
+			for _, notifier := range n.notifiers {
+				notifyCtx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+				if err := notifier.Notify(notifyCtx, item); err != nil {
+					n.logger.Error("Notify failed", "err", err)
+				}
+				cancel()
+			}
+		case text := <-n.alerts:
+			for _, notifier := range n.notifiers {
+				alerter, ok := notifier.(Alerter)
+				if !ok {
+					continue
+				}
+				notifyCtx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+				if err := alerter.Alert(notifyCtx, text); err != nil {
+					n.logger.Error("Alert failed", "err", err)
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+type discordNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewDiscordNotifier posts through transport, so the proxy and TLS settings
+// apply to the webhook too.
+func NewDiscordNotifier(webhookURL string, transport http.RoundTripper) Notifier {
+	return &discordNotifier{webhookURL: webhookURL, client: &http.Client{Transport: transport}}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordImage struct {
+	URL string `json:"url"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Fields    []discordField `json:"fields"`
+	Thumbnail *discordImage  `json:"thumbnail,omitempty"`
+}
+
+func (n *discordNotifier) Notify(ctx context.Context, item *Item) error {
+	title := item.MarketName
+	if item.HighPriority {
+		title = "⭐ " + title
+	}
+	embed := discordEmbed{
+		Title: title,
+		Fields: []discordField{
+			{Name: "Price", Value: fmt.Sprintf("%.2f %s", item.Price, item.Currency), Inline: true},
+		},
+	}
+	if item.Float != nil {
+		embed.Fields = append(embed.Fields, discordField{
+			Name:   "Float",
+			Value:  strconv.FormatFloat(*item.Float, 'f', -1, 64),
+			Inline: true,
+		})
+	}
+	if item.NewLow {
+		embed.Fields = append(embed.Fields, discordField{
+			Name:   "Below floor",
+			Value:  fmt.Sprintf("%.2f %s", *item.FloorPrice, item.Currency),
+			Inline: true,
+		})
+	}
+	if item.PaintSeed != nil {
+		embed.Fields = append(embed.Fields, discordField{Name: "Seed", Value: strconv.Itoa(*item.PaintSeed), Inline: true})
+	}
+	if item.InspectURL != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Inspect", Value: item.InspectURL})
+	}
+	if item.ImageURL != "" {
+		embed.Thumbnail = &discordImage{URL: item.ImageURL}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"embeds": []discordEmbed{embed}})
+	if err != nil {
+		return err
+	}
+	return n.send(ctx, body)
+}
+
+func (n *discordNotifier) Alert(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]interface{}{"content": text})
+	if err != nil {
+		return err
+	}
+	return n.send(ctx, body)
+}
+
+// send posts body, retrying once after a 429.
+func (n *discordNotifier) send(ctx context.Context, body []byte) error {
+	retryAfter, err := n.post(ctx, body)
+	if err == nil || retryAfter < 0 {
+		return err
+	}
+
+	select {
+	case <-time.After(retryAfter):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	_, err = n.post(ctx, body)
+	return err
+}
+
+// post sends the webhook body. On a 429 response it returns the delay
+// requested by the server; a negative delay means the error is final.
+func (n *discordNotifier) post(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return parseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("discord webhook rate limited")
+	}
+	if resp.StatusCode >= 300 {
+		return -1, fmt.Errorf("discord webhook returned %s", resp.Status)
+	}
+	return 0, nil
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || seconds < 0 {
+		return time.Second
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
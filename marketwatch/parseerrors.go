@@ -0,0 +1,79 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ParseErrorsMax         = 100
+	parseErrorFilePattern  = "parse_error_*.json"
+	parseErrorFileTemplate = "parse_error_%s_%04d.json"
+)
+
+// parseErrorCapture keeps the raw frames that failed to parse, one file
+// each, so they can be fed back with -replay once the parser is fixed.
+// Only the newest max files are kept. The names sort by time.
+type parseErrorCapture struct {
+	dir string
+	max int
+
+	mu    sync.Mutex
+	seq   int
+	files []string // oldest first
+}
+
+func newParseErrorCapture(dir string, max int) (*parseErrorCapture, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, parseErrorFilePattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	c := &parseErrorCapture{dir: dir, max: max, files: files}
+	return c, c.prune()
+}
+
+// Save writes frame to a new file and returns its path.
+func (c *parseErrorCapture) Save(frame []byte) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq = (c.seq + 1) % 10000
+	name := fmt.Sprintf(parseErrorFileTemplate, time.Now().UTC().Format("20060102_150405.000000"), c.seq)
+	path := filepath.Join(c.dir, name)
+	data := make([]byte, 0, len(frame)+1)
+	data = append(append(data, frame...), '\n')
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	c.files = append(c.files, path)
+	return path, c.prune()
+}
+
+func (c *parseErrorCapture) prune() error {
+	var err error
+	for len(c.files) > c.max {
+		if rerr := os.Remove(c.files[0]); rerr != nil && !os.IsNotExist(rerr) {
+			err = rerr
+		}
+		c.files = c.files[1:]
+	}
+	return err
+}
+
+// channelFrame rebuilds the frame a channel payload came in, so a capture
+// of it replays like the original.
+func channelFrame(channel string, payload []byte) []byte {
+	frame, _ := json.Marshal(struct {
+		Type string `json:"type"`
+		Data string `json:"data"`
+	}{channel, string(payload)})
+	return frame
+}
@@ -0,0 +1,101 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorCapture(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   []byte
+		capture bool
+	}{
+		{name: "data not a string", frame: []byte(`{"type": "newitems_go", "data": {"i_market_name": "Sticker | Tyloo"}}`), capture: true},
+		{name: "payload not JSON", frame: feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": `), capture: true},
+		{name: "item without a name", frame: feedFrame("newitems_go", `{"ui_price": "0.03"}`), capture: true},
+		{name: "malformed price", frame: feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "abc"}`), capture: true},
+		{name: "valid item", frame: feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`)},
+		// Not a feed frame at all, so there is nothing to replay.
+		{name: "not JSON", frame: []byte("pong?")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "parse_errors")
+			d, _ := newTestWatcher(t, nil, nil)
+			var err error
+			if d.unparsed, err = newParseErrorCapture(dir, ParseErrorsMax); err != nil {
+				t.Fatal(err)
+			}
+			d.processMessage(tt.frame)
+
+			files, _ := filepath.Glob(filepath.Join(dir, parseErrorFilePattern))
+			if !tt.capture {
+				if len(files) != 0 {
+					t.Errorf("captured %q", files)
+				}
+				return
+			}
+			if len(files) != 1 {
+				t.Fatalf("captured %d files, want 1", len(files))
+			}
+			data, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Channel payloads are captured in a rebuilt frame, so compare
+			// the decoded frames.
+			var got, want interface{}
+			if err := json.Unmarshal(data, &got); err != nil || !strings.HasSuffix(string(data), "}\n") {
+				t.Fatalf("captured %q: %v", data, err)
+			}
+			json.Unmarshal(tt.frame, &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("captured %q, want the frame %q", data, tt.frame)
+			}
+		})
+	}
+}
+
+func TestParseErrorCaptureBound(t *testing.T) {
+	dir := t.TempDir()
+	// Files from an earlier run count against the bound, oldest first.
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf(parseErrorFileTemplate, fmt.Sprintf("20240501_120000.00000%d", i), i)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newParseErrorCapture(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, parseErrorFilePattern))
+	if len(files) != 2 || !strings.Contains(files[0], "120000.000001") {
+		t.Fatalf("files %q after opening, want the newest two", files)
+	}
+
+	var saved []string
+	for i := 0; i < 5; i++ {
+		path, err := c.Save([]byte(fmt.Sprintf(`{"n": %d}`, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, path)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, parseErrorFilePattern))
+	if strings.Join(files, " ") != strings.Join(saved[3:], " ") {
+		t.Errorf("files %q, want the last two saved %q", files, saved[3:])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+}
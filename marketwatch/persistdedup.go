@@ -0,0 +1,269 @@
+package marketwatch
+
+import (
+	"container/list"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	PersistDedupTTL   = 24 * time.Hour
+	persistDedupSweep = 10 * time.Minute
+)
+
+// persistDedupMemory caps the ids a persistentDedup keeps in memory.
+var persistDedupMemory = dedupMaxEntries
+
+const persistDedupSchema = `
+CREATE TABLE IF NOT EXISTS seen (
+	key     TEXT PRIMARY KEY,
+	seen_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_seen_seen_at ON seen (seen_at);
+`
+
+// persistentDedup remembers item ids for retention in a SQLite file, so
+// items seen before a restart stay suppressed after it. The newest ids, up
+// to persistDedupMemory, are kept in memory, oldest first; once older ones have been
+// evicted a key missing from memory is looked up in the file. New ids are
+// written in batches from a background goroutine, like the item store does.
+type persistentDedup struct {
+	db        *sql.DB
+	retention time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // of *dedupEntry, oldest first
+	// spilled is set once ids were evicted, or not loaded, that the file
+	// still has.
+	spilled bool
+
+	queue  chan dedupRecord
+	closed chan struct{}
+	done   chan struct{}
+}
+
+type dedupRecord struct {
+	key    string
+	seenAt time.Time
+}
+
+// openPersistentDedup opens or creates the file at path, dropping the ids
+// older than retention and compacting it before loading the rest.
+func openPersistentDedup(path string, retention time.Duration, logger *slog.Logger) (*persistentDedup, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	p := &persistentDedup{
+		db:        db,
+		retention: retention,
+		logger:    logger,
+		now:       time.Now,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+		queue:     make(chan dedupRecord, storeQueueSize),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := p.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *persistentDedup) load() error {
+	if _, err := p.db.Exec(persistDedupSchema); err != nil {
+		return err
+	}
+	cutoff := p.now().Add(-p.retention).UnixMilli()
+	res, err := p.db.Exec(`DELETE FROM seen WHERE seen_at < ?`, cutoff)
+	if err != nil {
+		return fmt.Errorf("expire: %w", err)
+	}
+	if expired, _ := res.RowsAffected(); expired > 0 {
+		if _, err := p.db.Exec(`VACUUM`); err != nil {
+			return fmt.Errorf("compact: %w", err)
+		}
+	}
+
+	var total int
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM seen`).Scan(&total); err != nil {
+		return err
+	}
+	rows, err := p.db.Query(`SELECT key, seen_at FROM seen ORDER BY seen_at DESC LIMIT ?`, persistDedupMemory)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var seenAt int64
+		if err := rows.Scan(&key, &seenAt); err != nil {
+			return err
+		}
+		p.entries[key] = p.order.PushFront(&dedupEntry{key: key, seenAt: time.UnixMilli(seenAt)})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	p.spilled = total > p.order.Len()
+	p.logger.Info("Persistent dedup loaded", "items", total, "in_memory", p.order.Len(), "retention", p.retention)
+	return nil
+}
+
+// Seen records key and reports whether it was recorded within retention,
+// in this run or an earlier one. A repeat does not extend its lifetime.
+func (p *persistentDedup) Seen(key string) bool {
+	now := p.now()
+	p.mu.Lock()
+	if elem, ok := p.entries[key]; ok {
+		if now.Sub(elem.Value.(*dedupEntry).seenAt) < p.retention {
+			p.mu.Unlock()
+			return true
+		}
+		p.order.Remove(elem)
+	} else if p.spilled && p.seenOnDisk(key, now) {
+		p.mu.Unlock()
+		return true
+	}
+	p.entries[key] = p.order.PushBack(&dedupEntry{key: key, seenAt: now})
+	for p.order.Len() > persistDedupMemory {
+		oldest := p.order.Remove(p.order.Front()).(*dedupEntry)
+		delete(p.entries, oldest.key)
+		p.spilled = true
+	}
+	p.mu.Unlock()
+
+	select {
+	case p.queue <- dedupRecord{key: key, seenAt: now}:
+	case <-p.closed:
+	default:
+		p.logger.Warn("Persistent dedup queue full, item not saved", "id", key)
+	}
+	return false
+}
+
+// seenOnDisk looks key up in the file for a miss in memory. An id evicted
+// before its batch was written is not found there; with the memory limit
+// far above a batch that only happens under a flood of new ids.
+func (p *persistentDedup) seenOnDisk(key string, now time.Time) bool {
+	var seenAt int64
+	err := p.db.QueryRow(`SELECT seen_at FROM seen WHERE key = ?`, key).Scan(&seenAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			p.logger.Error("Persistent dedup lookup failed", "err", err)
+		}
+		return false
+	}
+	return now.Sub(time.UnixMilli(seenAt)) < p.retention
+}
+
+func (p *persistentDedup) Close() error {
+	close(p.closed)
+	<-p.done
+	return p.db.Close()
+}
+
+func (p *persistentDedup) run() {
+	defer close(p.done)
+	flush := time.NewTicker(StoreBatchWindow)
+	defer flush.Stop()
+	sweep := time.NewTicker(persistDedupSweep)
+	defer sweep.Stop()
+
+	var batch []dedupRecord
+	for {
+		select {
+		case rec := <-p.queue:
+			batch = append(batch, rec)
+			if len(batch) >= StoreBatchSize {
+				p.write(batch)
+				batch = nil
+			}
+		case <-flush.C:
+			if len(batch) > 0 {
+				p.write(batch)
+				batch = nil
+			}
+		case <-sweep.C:
+			p.expire()
+		case <-p.closed:
+			p.drain(batch)
+			return
+		}
+	}
+}
+
+func (p *persistentDedup) drain(batch []dedupRecord) {
+	for {
+		select {
+		case rec := <-p.queue:
+			batch = append(batch, rec)
+		default:
+			if len(batch) > 0 {
+				p.write(batch)
+			}
+			return
+		}
+	}
+}
+
+func (p *persistentDedup) write(batch []dedupRecord) {
+	err := func() error {
+		tx, err := p.db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		for _, rec := range batch {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO seen (key, seen_at) VALUES (?, ?)`, rec.key, rec.seenAt.UnixMilli()); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("insert: %w", err)
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		p.logger.Error("Persistent dedup write failed", "err", err, "items", len(batch))
+	}
+}
+
+// expire forgets the ids older than retention, in memory and on disk.
+func (p *persistentDedup) expire() {
+	cutoff := p.now().Add(-p.retention)
+	p.mu.Lock()
+	for front := p.order.Front(); front != nil; front = p.order.Front() {
+		entry := front.Value.(*dedupEntry)
+		if !entry.seenAt.Before(cutoff) {
+			break
+		}
+		p.order.Remove(front)
+		delete(p.entries, entry.key)
+	}
+	p.mu.Unlock()
+	if _, err := p.db.Exec(`DELETE FROM seen WHERE seen_at < ?`, cutoff.UnixMilli()); err != nil {
+		p.logger.Error("Persistent dedup expiry failed", "err", err)
+	}
+}
+
+// dedupChain is seen when any of its dedupers has seen the key. Every one
+// records it.
+type dedupChain []deduper
+
+func (c dedupChain) Seen(key string) bool {
+	seen := false
+	for _, d := range c {
+		if d.Seen(key) {
+			seen = true
+		}
+	}
+	return seen
+}
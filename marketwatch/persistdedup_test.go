@@ -0,0 +1,156 @@
+package marketwatch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func countSeen(t *testing.T, p *persistentDedup) int {
+	t.Helper()
+	var n int
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM seen`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPersistentDedupRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	p, err := openPersistentDedup(path, time.Hour, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two days ago, long past the retention, and just now.
+	p.now = func() time.Time { return time.Now().Add(-48 * time.Hour) }
+	p.Seen("stale")
+	p.now = time.Now
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{
+		{"recent", false},
+		{"recent", true},
+		{"other", false},
+	} {
+		if got := p.Seen(tt.key); got != tt.want {
+			t.Errorf("Seen(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close wrote what was queued; reopening expires the stale id.
+	p, err = openPersistentDedup(path, time.Hour, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if n := countSeen(t, p); n != 2 {
+		t.Errorf("%d ids kept on disk, want 2", n)
+	}
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{
+		{"recent", true},
+		{"other", true},
+		{"stale", false},
+		{"new", false},
+	} {
+		if got := p.Seen(tt.key); got != tt.want {
+			t.Errorf("after restart Seen(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	// An id is forgotten once its retention has passed, even while running.
+	p.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if p.Seen("recent") {
+		t.Error("id still seen after its retention")
+	}
+	p.expire()
+	p.mu.Lock()
+	_, kept := p.entries["other"]
+	p.mu.Unlock()
+	if kept {
+		t.Error("expired id kept in memory")
+	}
+}
+
+func TestWatcherPersistentDedup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	frame := feedFrame("newitems_go", `{"i_market_name": "M4A4 | Howl (Minimal Wear)", "ui_price": "5200", "ui_float": "0.09"}`)
+	for run, want := range []int{1, 0} {
+		p, err := openPersistentDedup(path, time.Hour, testLogger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, items := newTestWatcher(t, nil, nil)
+		d.dedup = dedupChain{newDedupCache(time.Minute), p}
+		d.processMessage(frame)
+		d.processMessage(frame)
+		for i := 0; i < want; i++ {
+			nextItem(t, items)
+		}
+		noItem(t, items)
+		if err := p.Close(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+}
+
+func TestPersistentDedupMemoryLimit(t *testing.T) {
+	defer func(n int) { persistDedupMemory = n }(persistDedupMemory)
+	persistDedupMemory = 2
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	p, err := openPersistentDedup(path, time.Hour, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inMemory := func() int {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.entries)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		p.Seen(key)
+	}
+	// "a" is evicted from memory; once written the file still has it.
+	waitFor(t, "the ids written", func() bool { return countSeen(t, p) == 3 })
+	steps := []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"c", true},
+		{"d", false},
+		{"d", true},
+	}
+	for _, tt := range steps {
+		if got := p.Seen(tt.key); got != tt.want {
+			t.Errorf("Seen(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+		if n := inMemory(); n > 2 {
+			t.Errorf("after Seen(%q) %d ids in memory, want at most 2", tt.key, n)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart loads only the newest ids and looks the rest up.
+	p, err = openPersistentDedup(path, time.Hour, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if n := inMemory(); n != 2 {
+		t.Errorf("%d ids loaded, want 2", n)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if !p.Seen(key) {
+			t.Errorf("after restart Seen(%q) = false, want true", key)
+		}
+	}
+}
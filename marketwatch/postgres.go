@@ -0,0 +1,78 @@
+package marketwatch
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	PostgresMaxConns    = 4
+	PostgresConnMaxIdle = 5 * time.Minute
+	// PostgresRetries is how often a batch is retried while the database is
+	// unreachable before its items are dropped.
+	PostgresRetries = 5
+)
+
+// item_id is Item.ID, so the same listing seen again by a replay or a
+// second account updates its row instead of adding one.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS items (
+	id          BIGSERIAL PRIMARY KEY,
+	item_id     TEXT NOT NULL UNIQUE,
+	market_name TEXT NOT NULL,
+	quality     TEXT,
+	price       DOUBLE PRECISION NOT NULL,
+	currency    TEXT,
+	float_value DOUBLE PRECISION,
+	inspect_url TEXT,
+	received_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_items_market_name ON items (market_name);
+CREATE INDEX IF NOT EXISTS idx_items_received_at ON items (received_at);
+CREATE TABLE IF NOT EXISTS events (
+	id          BIGSERIAL PRIMARY KEY,
+	kind        TEXT NOT NULL,
+	item_id     TEXT NOT NULL,
+	market_name TEXT NOT NULL,
+	price       DOUBLE PRECISION NOT NULL,
+	currency    TEXT,
+	inspect_url TEXT,
+	event_at    TIMESTAMPTZ,
+	received_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_market_name ON events (market_name);
+`
+
+const postgresEventInsert = `INSERT INTO events
+	(kind, item_id, market_name, price, currency, inspect_url, event_at, received_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+const postgresUpsert = `INSERT INTO items
+	(market_name, quality, price, currency, float_value, inspect_url, received_at, item_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (item_id) DO UPDATE SET
+		quality = EXCLUDED.quality,
+		currency = EXCLUDED.currency,
+		float_value = COALESCE(EXCLUDED.float_value, items.float_value),
+		received_at = EXCLUDED.received_at`
+
+// NewPostgresStore connects to dsn and creates the items table if needed.
+// Writes are batched like the SQLite store's and retried while the
+// database is down.
+func NewPostgresStore(dsn string, logger *slog.Logger) (Store, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(PostgresMaxConns)
+	db.SetConnMaxIdleTime(PostgresConnMaxIdle)
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return newSQLStore(db, postgresUpsert, postgresEventInsert, PostgresRetries, logger), nil
+}
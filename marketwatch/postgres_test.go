@@ -0,0 +1,91 @@
+//go:build postgres
+
+package marketwatch
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgresStore runs against the database in MARKET_TEST_PG_DSN:
+//
+//	MARKET_TEST_PG_DSN=postgres://localhost/market_test?sslmode=disable go test -tags postgres ./marketwatch
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("MARKET_TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("MARKET_TEST_PG_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Names unique to this run, so rows from earlier runs don't count.
+	name := fmt.Sprintf("Test Item %d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM items WHERE market_name LIKE $1`, name+"%")
+		db.Exec(`DELETE FROM events WHERE market_name LIKE $1`, name+"%")
+	})
+
+	store, err := NewPostgresStore(dsn, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	first := &Item{MarketName: name, Quality: "--", Price: 12.5, Currency: "USD", Float: floatPtr(0.25), ListedAt: &listed}
+	relisted := *first
+	relisted.Quality = "StatTrak™"
+	other := &Item{MarketName: name + " (other)", Price: 3, Currency: "USD"}
+	// A float looked up for the second sighting fills in the row.
+	looked := &Item{MarketName: name + " (looked up)", Price: 8, Currency: "USD"}
+	looked.id = looked.ID()
+	found := *looked
+	found.Float = floatPtr(0.07)
+	for _, item := range []*Item{first, &relisted, other, looked, &found} {
+		if err := store.SaveItem(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, ok := store.(EventStore)
+	if !ok {
+		t.Fatal("the Postgres store does not keep events")
+	}
+	if err := events.SaveEvent(&ItemEvent{Kind: EventSold, Item: other}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		arg   string
+		want  int
+	}{
+		{name: "one row per item", query: `SELECT count(*) FROM items WHERE market_name LIKE $1`, arg: name + "%", want: 3},
+		{name: "upsert updated the row", query: `SELECT count(*) FROM items WHERE market_name = $1 AND quality = 'StatTrak™'`, arg: name, want: 1},
+		{name: "upsert filled in the float", query: `SELECT count(*) FROM items WHERE market_name = $1 AND float_value = 0.07`, arg: name + " (looked up)", want: 1},
+		{name: "event row", query: `SELECT count(*) FROM events WHERE market_name LIKE $1`, arg: name + "%", want: 1},
+	}
+	for _, tt := range tests {
+		var got int
+		if err := db.QueryRow(tt.query, tt.arg).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: %d rows, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// Reopening finds the schema in place.
+	store, err = NewPostgresStore(dsn, testLogger)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	store.Close()
+}
@@ -0,0 +1,112 @@
+package marketwatch
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	PriceChangeTTL        = 24 * time.Hour
+	priceChangeMaxEntries = 100000
+)
+
+// priceChangeTracker remembers the last price of each item, identified by
+// its inspect link, so a relisting at another price can be reported. An
+// entry lives for ttl after the item was last seen; past maxEntries the
+// least recently seen ones go first.
+type priceChangeTracker struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // least recently seen first
+	now     func() time.Time
+}
+
+type lastPrice struct {
+	identity string
+	price    float64
+	currency string
+	seenAt   time.Time
+}
+
+func newPriceChangeTracker(ttl time.Duration) *priceChangeTracker {
+	return &priceChangeTracker{
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Observe records the item's price and returns the previous one when it
+// differs. Items without an inspect link have no identity and are skipped,
+// as are prices in a different currency than the last one.
+func (t *priceChangeTracker) Observe(item *Item) (previous float64, changed bool) {
+	if item.InspectURL == "" {
+		return 0, false
+	}
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.evict(now)
+
+	if elem, ok := t.entries[item.InspectURL]; ok {
+		last := elem.Value.(*lastPrice)
+		previous = last.price
+		changed = last.currency == item.Currency && last.price != item.Price
+		last.price, last.currency, last.seenAt = item.Price, item.Currency, now
+		t.order.MoveToBack(elem)
+		return previous, changed
+	}
+	t.entries[item.InspectURL] = t.order.PushBack(&lastPrice{
+		identity: item.InspectURL,
+		price:    item.Price,
+		currency: item.Currency,
+		seenAt:   now,
+	})
+	return 0, false
+}
+
+func (t *priceChangeTracker) evict(now time.Time) {
+	for front := t.order.Front(); front != nil; front = t.order.Front() {
+		last := front.Value.(*lastPrice)
+		if now.Sub(last.seenAt) < t.ttl && t.order.Len() < priceChangeMaxEntries {
+			return
+		}
+		t.order.Remove(front)
+		delete(t.entries, last.identity)
+	}
+}
+
+// reportPriceChange marks a relisted item with its previous price and,
+// when it passes the name filters like history events do, emits a
+// price_changed event and alerts the notifiers. The item itself then goes
+// on as a new listing.
+func (d *MarketWatcher) reportPriceChange(item *Item, previous float64) {
+	pct := priceChangePct(previous, item.Price)
+	item.PreviousPrice, item.PriceChangePct = &previous, &pct
+	d.metrics.priceChanges.Inc()
+
+	filters := d.filters.current()
+	if !nameMatches(item.MarketName, filters.Include, filters.Exclude) {
+		return
+	}
+	d.emitEvent(&ItemEvent{Kind: EventPriceChanged, Item: item})
+	if d.notifier != nil {
+		d.notifier.Alert(fmt.Sprintf("%s relisted: %g → %g %s (%+.2f%%)",
+			item.MarketName, previous, item.Price, item.Currency, pct))
+	}
+}
+
+// priceChangePct is the change from previous to price in percent, rounded
+// to two decimals.
+func priceChangePct(previous, price float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return math.Round((price-previous)/previous*10000) / 100
+}
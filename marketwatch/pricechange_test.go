@@ -0,0 +1,136 @@
+package marketwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceChangeTracker(t *testing.T) {
+	clock := newFakeClock()
+	tr := newPriceChangeTracker(time.Hour)
+	tr.now = clock.Now
+
+	const link = "steam://rungame/730/76561202255233023/+csgo_econ_action_preview M1A2D3"
+	steps := []struct {
+		advance  time.Duration
+		inspect  string
+		price    float64
+		currency string
+		previous float64
+		changed  bool
+	}{
+		{0, link, 10, "USD", 0, false},
+		{time.Minute, link, 10, "USD", 10, false},
+		{time.Minute, link, 12.5, "USD", 10, true},
+		// Another currency is not comparable, but becomes the last price.
+		{time.Minute, link, 11, "EUR", 12.5, false},
+		{time.Minute, link, 9, "EUR", 11, true},
+		// Without an inspect link the item has no identity.
+		{0, "", 1, "USD", 0, false},
+		{0, "", 2, "USD", 0, false},
+		// Past the TTL the last price is forgotten.
+		{time.Hour, link, 20, "EUR", 0, false},
+		{59 * time.Minute, link, 25, "EUR", 20, true},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		previous, changed := tr.Observe(&Item{InspectURL: s.inspect, Price: s.price, Currency: s.currency})
+		if previous != s.previous || changed != s.changed {
+			t.Errorf("step %d: Observe(%g %s) = %g, %v; want %g, %v", i, s.price, s.currency, previous, changed, s.previous, s.changed)
+		}
+	}
+}
+
+func TestPriceChangePct(t *testing.T) {
+	tests := []struct {
+		previous, price, want float64
+	}{
+		{10, 12.5, 25},
+		{12.5, 10, -20},
+		{3, 4, 33.33},
+		{3, 2, -33.33},
+		{0, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := priceChangePct(tt.previous, tt.price); got != tt.want {
+			t.Errorf("priceChangePct(%g, %g) = %g, want %g", tt.previous, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestWatcherPriceChanges(t *testing.T) {
+	const redline = `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "%s", "ui_currency": "USD", "inspect_url": "steam://rungame/730/76561202255233023/+csgo_econ_action_preview M4108481252793458462A29194971250D1156893335530217395"}`
+	tests := []struct {
+		name   string
+		prices []string
+		// previous and pct are the price change events' values, in order.
+		previous []float64
+		pct      []float64
+	}{
+		{name: "changed", prices: []string{"10", "12.5"}, previous: []float64{10}, pct: []float64{25}},
+		{name: "unchanged", prices: []string{"10", "10"}},
+		{name: "changed twice", prices: []string{"10", "8", "10.4"}, previous: []float64{10, 8}, pct: []float64{-20, 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Format = FormatJSON
+			d, items := newTestWatcher(t, nil, cfg)
+			// Without dedup, so the unchanged relisting reaches the tracker.
+			d.priceChanges = newPriceChangeTracker(PriceChangeTTL)
+			d.notifier = newNotifyDispatcher(testLogger)
+			var out bytes.Buffer
+			d.out = &out
+
+			for _, price := range tt.prices {
+				d.processMessage(feedFrame("newitems_go", strings.Replace(redline, "%s", price, 1)))
+			}
+
+			var previous, pct []float64
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var ev Event
+				if err := json.Unmarshal([]byte(line), &ev); err != nil {
+					t.Fatalf("decode %s: %v", line, err)
+				}
+				if ev.Event != EventPriceChanged {
+					continue
+				}
+				if ev.Item.PreviousPrice == nil || ev.Item.PriceChangePct == nil {
+					t.Fatalf("price change event without the change: %s", line)
+				}
+				previous = append(previous, *ev.Item.PreviousPrice)
+				pct = append(pct, *ev.Item.PriceChangePct)
+			}
+			if !reflect.DeepEqual(previous, tt.previous) || !reflect.DeepEqual(pct, tt.pct) {
+				t.Errorf("price changes from %v by %v%%, want from %v by %v%%", previous, pct, tt.previous, tt.pct)
+			}
+			if got := len(d.notifier.alerts); got != len(tt.previous) {
+				t.Errorf("%d alerts queued, want %d", got, len(tt.previous))
+			}
+			for len(d.notifier.alerts) > 0 {
+				if alert := <-d.notifier.alerts; !strings.HasPrefix(alert, "AK-47 | Redline (Field-Tested) relisted: ") {
+					t.Errorf("alert %q", alert)
+				}
+			}
+
+			// Relisted items still go out as new listings, marked with the change.
+			var marked int
+			for range tt.prices {
+				if item := nextItem(t, items); item.PreviousPrice != nil {
+					marked++
+				}
+			}
+			if marked != len(tt.previous) {
+				t.Errorf("%d emitted items marked as relisted, want %d", marked, len(tt.previous))
+			}
+			noItem(t, items)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package marketwatch
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	PublishQueueSize = 1000
+	DefaultTopic     = "market.items"
+	kafkaBatchWindow = 10 * time.Millisecond
+)
+
+// Publisher sends encoded items to a message bus. subject identifies the
+// stream within the publisher's topic; the watcher uses the market name.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+	Close() error
+}
+
+type natsPublisher struct {
+	conn  *nats.Conn
+	topic string
+}
+
+// NewNATSPublisher publishes to "<topic>.<subject>".
+func NewNATSPublisher(url, topic string) (Publisher, error) {
+	conn, err := nats.Connect(url, nats.Name("market-ws"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn: conn, topic: topic}, nil
+}
+
+func (p *natsPublisher) Publish(subject string, data []byte) error {
+	return p.conn.Publish(p.topic+"."+subject, data)
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher writes to topic with subject as the message key, so
+// all items of one market land in the same partition.
+func NewKafkaPublisher(brokers []string, topic string, logger *slog.Logger) Publisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: kafkaBatchWindow,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				logger.Error("Kafka write failed", "messages", len(messages), "err", err)
+			}
+		},
+	}}
+}
+
+func (p *kafkaPublisher) Publish(subject string, data []byte) error {
+	return p.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(subject), Value: data})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+type publication struct {
+	subject string
+	data    []byte
+}
+
+// publishQueue hands items to a Publisher from its own goroutine, dropping
+// them when the queue is full rather than stalling the read loop.
+type publishQueue struct {
+	publisher Publisher
+	queue     chan publication
+	metrics   *metrics
+	logger    *slog.Logger
+}
+
+func newPublishQueue(publisher Publisher, m *metrics, logger *slog.Logger) *publishQueue {
+	return &publishQueue{
+		publisher: publisher,
+		queue:     make(chan publication, PublishQueueSize),
+		metrics:   m,
+		logger:    logger,
+	}
+}
+
+func (q *publishQueue) Enqueue(subject string, data []byte) {
+	select {
+	case q.queue <- publication{subject: subject, data: data}:
+	default:
+		q.metrics.publishDropped.Inc()
+	}
+}
+
+func (q *publishQueue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-q.queue:
+			if err := q.publisher.Publish(p.subject, p.data); err != nil {
+				q.logger.Error("Publish failed", "subject", p.subject, "err", err)
+			}
+		}
+	}
+}
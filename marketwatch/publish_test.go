@@ -0,0 +1,101 @@
+package marketwatch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// runNATSServer starts an in-process NATS server on a random port.
+func runNATSServer(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestNATSPublisher(t *testing.T) {
+	srv := runNATSServer(t)
+	sub, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	msgs := make(chan *nats.Msg, 16)
+	if _, err := sub.ChanSubscribe(DefaultTopic+".>", msgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, err := NewNATSPublisher(srv.ClientURL(), DefaultTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	q := newPublishQueue(publisher, newMetrics(), testLogger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	items := []*Item{
+		{Market: "csgo", MarketName: "AK-47 | Redline (Field-Tested)", Price: 12.5, Currency: "USD"},
+		{Market: "dota", MarketName: "Exalted Manifold Paradox", Price: 30, Currency: "USD"},
+	}
+	for _, item := range items {
+		if err := q.Consume(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, item := range items {
+		select {
+		case msg := <-msgs:
+			if want := DefaultTopic + "." + item.Market; msg.Subject != want {
+				t.Errorf("subject = %q, want %q", msg.Subject, want)
+			}
+			var ev Event
+			if err := json.Unmarshal(msg.Data, &ev); err != nil {
+				t.Fatalf("decode %s: %v", msg.Data, err)
+			}
+			if ev.Event != EventNewItem || ev.Market != item.Market || ev.Item.MarketName != item.MarketName {
+				t.Errorf("got %s, want %s from %s", msg.Data, item.MarketName, item.Market)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no message for %s", item.MarketName)
+		}
+	}
+}
+
+func TestNewNATSPublisherUnreachable(t *testing.T) {
+	srv := runNATSServer(t)
+	url := srv.ClientURL()
+	srv.Shutdown()
+	if p, err := NewNATSPublisher(url, DefaultTopic); err == nil {
+		p.Close()
+		t.Fatal("connected to a stopped server")
+	}
+}
+
+func TestPublishQueueDropsWhenFull(t *testing.T) {
+	m := newMetrics()
+	q := newPublishQueue(nil, m, testLogger)
+	for i := 0; i < PublishQueueSize+5; i++ {
+		q.Enqueue("test", []byte("{}"))
+	}
+	if got := testutil.ToFloat64(m.publishDropped); got != 5 {
+		t.Errorf("dropped %g, want 5", got)
+	}
+}
@@ -0,0 +1,121 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// oversizedFrame is how large the frame sent past the read limit is. It is
+// streamed, so only the client could buffer it whole.
+const oversizedFrame = 64 << 20
+
+// sendOversized streams a text frame of size bytes.
+func sendOversized(conn *websocket.Conn, size int) {
+	w, err := conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return
+	}
+	chunk := bytes.Repeat([]byte("x"), 64<<10)
+	for sent := 0; sent < size; sent += len(chunk) {
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+	}
+	w.Close()
+}
+
+func TestListenReadLimit(t *testing.T) {
+	small := feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`)
+	tests := []struct {
+		name  string
+		limit int64
+		feed  func(conn *websocket.Conn)
+		items int
+		err   error
+	}{
+		{
+			name:  "oversized frame",
+			limit: 4 << 10,
+			feed: func(conn *websocket.Conn) {
+				sendFrames(conn, small)
+				sendOversized(conn, oversizedFrame)
+			},
+			items: 1,
+			err:   websocket.ErrReadLimit,
+		},
+		{
+			name:  "frame at the limit",
+			limit: int64(len(small)),
+			feed: func(conn *websocket.Conn) {
+				sendFrames(conn, small)
+				conn.Close()
+			},
+			items: 1,
+			err:   ErrConnClosed,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFeedServer(t, func(_ int, conn *websocket.Conn) { tt.feed(conn) })
+			cfg := DefaultConfig()
+			cfg.MaxMessageSize = tt.limit
+			d, items := newTestWatcher(t, srv, cfg)
+			var log strings.Builder
+			d.logger = slog.New(slog.NewTextHandler(&lockedWriter{w: &log}, nil))
+			if err := d.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			err := d.Listen(context.Background())
+			runtime.ReadMemStats(&after)
+			if !errors.Is(err, tt.err) || !errors.Is(err, ErrConnClosed) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			for i := 0; i < tt.items; i++ {
+				nextItem(t, items)
+			}
+			noItem(t, items)
+			if tt.err != websocket.ErrReadLimit {
+				return
+			}
+			if !strings.Contains(log.String(), "event=read_limit") {
+				t.Errorf("log %q does not report the limit", log.String())
+			}
+			if grown := after.TotalAlloc - before.TotalAlloc; grown > oversizedFrame/4 {
+				t.Errorf("allocated %d bytes reading a %d byte frame", grown, oversizedFrame)
+			}
+		})
+	}
+}
+
+func TestRunReconnectsAfterReadLimit(t *testing.T) {
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		if n == 1 {
+			sendOversized(conn, 1<<20)
+			return
+		}
+		sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`))
+	})
+	cfg := DefaultConfig()
+	cfg.MaxMessageSize = 4 << 10
+	d, items := newTestWatcher(t, srv, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+	nextItem(t, items)
+	cancel()
+	<-done
+	if n := srv.conns.Load(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+}
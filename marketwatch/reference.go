@@ -0,0 +1,155 @@
+package marketwatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ReferenceRefreshEvery = 10 * time.Minute
+	ReferenceRetryDelay   = 1 * time.Minute
+)
+
+// ReferencePriceProvider returns what an item normally sells for, used to
+// compute the discount of a new listing.
+type ReferencePriceProvider interface {
+	ReferencePrice(name string) (price float64, currency string, ok bool)
+}
+
+// priceListProvider caches the market's own price list (the lowest offer
+// per item name) and refreshes it in Run.
+type priceListProvider struct {
+	url    string
+	client *http.Client
+	logger *slog.Logger
+
+	mu       sync.RWMutex
+	currency string
+	prices   map[string]float64
+}
+
+func newPriceListProvider(url string, logger *slog.Logger) *priceListProvider {
+	return &priceListProvider{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+		logger: logger,
+	}
+}
+
+func (p *priceListProvider) ReferencePrice(name string) (float64, string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.prices[name]
+	return price, p.currency, ok && price > 0
+}
+
+// Run loads the price list and refreshes it until ctx is cancelled.
+func (p *priceListProvider) Run(ctx context.Context) {
+	for {
+		wait := ReferenceRefreshEvery
+		if err := p.refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("Reference price refresh failed", "err", err)
+			wait = ReferenceRetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *priceListProvider) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("price list endpoint returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var data struct {
+		Success  bool   `json:"success"`
+		Currency string `json:"currency"`
+		Items    []struct {
+			Name  string      `json:"market_hash_name"`
+			Price interface{} `json:"price"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return err
+	}
+	if !data.Success || len(data.Items) == 0 {
+		return errors.New("price list is empty")
+	}
+
+	prices := make(map[string]float64, len(data.Items))
+	for _, item := range data.Items {
+		if price, err := priceValue(item.Price); err == nil {
+			prices[item.Name] = price
+		}
+	}
+
+	p.mu.Lock()
+	p.currency = strings.ToUpper(data.Currency)
+	p.prices = prices
+	p.mu.Unlock()
+	p.logger.Info("Reference prices updated", "items", len(prices), "currency", p.currency)
+	return nil
+}
+
+// applyReference sets the item's reference price and discount in percent.
+// Items without a reference price in a comparable currency are left as is.
+func applyReference(item *Item, refs ReferencePriceProvider, rates RateProvider) {
+	ref, currency, ok := refs.ReferencePrice(item.MarketName)
+	if !ok {
+		return
+	}
+
+	price := item.Price
+	switch {
+	case strings.EqualFold(item.Currency, currency):
+	case item.BasePrice != nil && strings.EqualFold(item.BaseCurrency, currency):
+		price = *item.BasePrice
+	case rates != nil:
+		rate, err := rates.Rate(item.Currency, currency)
+		if err != nil {
+			return
+		}
+		price *= rate
+	default:
+		return
+	}
+
+	discount := (ref - price) / ref * 100
+	item.ReferencePrice = &ref
+	item.Discount = &discount
+}
+
+// discountMatches reports whether the item is at least minDiscount percent
+// below its reference price. Items without a reference always match.
+func discountMatches(item *Item, minDiscount float64) bool {
+	return minDiscount <= 0 || item.Discount == nil || *item.Discount >= minDiscount
+}
@@ -0,0 +1,125 @@
+package marketwatch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// stubReferences returns fixed reference prices in one currency.
+type stubReferences struct {
+	currency string
+	prices   map[string]float64
+}
+
+func (s stubReferences) ReferencePrice(name string) (float64, string, bool) {
+	price, ok := s.prices[name]
+	return price, s.currency, ok
+}
+
+// stubRates converts at fixed rates keyed "FROM>TO".
+type stubRates map[string]float64
+
+func (s stubRates) Rate(from, to string) (float64, error) {
+	if rate, ok := s[from+">"+to]; ok {
+		return rate, nil
+	}
+	return 0, fmt.Errorf("no rate from %s to %s", from, to)
+}
+
+func TestApplyReference(t *testing.T) {
+	refs := stubReferences{currency: "USD", prices: map[string]float64{"AK-47 | Redline (Field-Tested)": 20}}
+	tests := []struct {
+		name     string
+		item     Item
+		rates    RateProvider
+		discount *float64
+	}{
+		{name: "same currency", item: Item{Price: 15, Currency: "USD"}, discount: floatPtr(25)},
+		{name: "currency case", item: Item{Price: 15, Currency: "usd"}, discount: floatPtr(25)},
+		{name: "above reference", item: Item{Price: 25, Currency: "USD"}, discount: floatPtr(-25)},
+		{name: "converted base price", item: Item{Price: 1500, Currency: "RUB", BasePrice: floatPtr(16), BaseCurrency: "USD"}, discount: floatPtr(20)},
+		{name: "rate lookup", item: Item{Price: 1000, Currency: "RUB"}, rates: stubRates{"RUB>USD": 0.01}, discount: floatPtr(50)},
+		{name: "no rate", item: Item{Price: 1000, Currency: "RUB"}, rates: stubRates{}},
+		{name: "other currency without rates", item: Item{Price: 15, Currency: "EUR"}},
+		{name: "no reference", item: Item{MarketName: "Operation Bravo Case", Price: 1, Currency: "USD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			if item.MarketName == "" {
+				item.MarketName = "AK-47 | Redline (Field-Tested)"
+			}
+			applyReference(&item, refs, tt.rates)
+			if !equalFloat(item.Discount, tt.discount) {
+				t.Errorf("discount = %v, want %v", item.Discount, tt.discount)
+			}
+			if (item.ReferencePrice == nil) != (tt.discount == nil) {
+				t.Errorf("reference price = %v", item.ReferencePrice)
+			}
+		})
+	}
+}
+
+func TestWatcherMinDiscount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinDiscount = 20
+	d, items := newTestWatcher(t, nil, cfg)
+	d.refs = stubReferences{currency: "USD", prices: map[string]float64{
+		"AK-47 | Redline (Field-Tested)": 20,
+		"AWP | Asiimov (Field-Tested)":   50,
+	}}
+	for _, payload := range []string{
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "19", "ui_currency": "USD"}`,
+		`{"i_market_name": "AWP | Asiimov (Field-Tested)", "ui_price": "35", "ui_currency": "USD"}`,
+		`{"i_market_name": "Operation Bravo Case", "ui_price": "1.5", "ui_currency": "USD"}`,
+	} {
+		d.processMessage(feedFrame("newitems_go", payload))
+	}
+
+	if item := nextItem(t, items); item.MarketName != "AWP | Asiimov (Field-Tested)" || !equalFloat(item.Discount, floatPtr(30)) {
+		t.Errorf("got %s with discount %v, want the AWP at 30%%", item.MarketName, item.Discount)
+	}
+	if item := nextItem(t, items); item.MarketName != "Operation Bravo Case" || item.Discount != nil {
+		t.Errorf("got %s with discount %v, want the case untagged", item.MarketName, item.Discount)
+	}
+	noItem(t, items)
+}
+
+func TestPriceListProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		prices  map[string]float64
+		wantErr bool
+	}{
+		{
+			name:   "list",
+			status: http.StatusOK,
+			body:   `{"success": true, "currency": "usd", "items": [{"market_hash_name": "AK-47 | Redline (Field-Tested)", "price": "20.5"}, {"market_hash_name": "Operation Bravo Case", "price": 0}]}`,
+			prices: map[string]float64{"AK-47 | Redline (Field-Tested)": 20.5},
+		},
+		{name: "empty", status: http.StatusOK, body: `{"success": true, "items": []}`, wantErr: true},
+		{name: "failed", status: http.StatusOK, body: `{"success": false}`, wantErr: true},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true},
+		{name: "malformed", status: http.StatusOK, body: `{"success": tr`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPriceListProvider(tokenServer(t, tt.status, tt.body).URL, testLogger)
+			err := p.refresh(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			for _, name := range []string{"AK-47 | Redline (Field-Tested)", "Operation Bravo Case"} {
+				price, currency, ok := p.ReferencePrice(name)
+				want, wantOK := tt.prices[name]
+				if ok != wantOK || ok && (price != want || currency != "USD") {
+					t.Errorf("ReferencePrice(%q) = %g %s %v, want %g USD %v", name, price, currency, ok, want, wantOK)
+				}
+			}
+		})
+	}
+}
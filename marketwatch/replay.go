@@ -0,0 +1,75 @@
+package marketwatch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+const maxReplayLine = 16 << 20
+
+// Replay feeds newline-delimited raw messages from path through
+// processMessage, at most perSecond messages per second (0 for no delay).
+func (d *MarketWatcher) Replay(ctx context.Context, path string, perSecond float64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var delay time.Duration
+	if perSecond > 0 {
+		delay = time.Duration(float64(time.Second) / perSecond)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+
+	count := 0
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		d.processMessage(line)
+		count++
+
+		if delay > 0 {
+			sleepContext(ctx, delay)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("replay %s: %w", path, err)
+	}
+	d.logger.Info("Replay finished", "messages", count)
+	return nil
+}
+
+// captureParseError saves a frame that failed to parse for -parse-errors-dir.
+func (d *MarketWatcher) captureParseError(frame []byte) {
+	if d.unparsed == nil {
+		return
+	}
+	path, err := d.unparsed.Save(frame)
+	if err != nil {
+		d.logger.Error("Parse error capture failed", "err", err)
+		return
+	}
+	d.logger.Info("Saved message that failed to parse", "path", path)
+}
+
+func (d *MarketWatcher) captureMessage(msg []byte) {
+	if d.capture == nil {
+		return
+	}
+	line := make([]byte, 0, len(msg)+1)
+	line = append(append(line, msg...), '\n')
+	if _, err := d.capture.Write(line); err != nil {
+		d.logger.Error("Capture write failed", "err", err)
+	}
+}
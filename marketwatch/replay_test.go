@@ -0,0 +1,49 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCaptureReplay(t *testing.T) {
+	names := []string{"Clutch Case", "Sticker | Titan (Holo) | Katowice 2014", "AWP | Dragon Lore (Factory New)"}
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		for i, name := range names {
+			sendFrames(conn, feedFrame("newitems_go", fmt.Sprintf(`{"i_market_name": %q, "ui_price": "%d"}`, name, i+1)))
+		}
+	})
+	var captured bytes.Buffer
+	live, items := newTestWatcher(t, srv, nil)
+	live.capture = &lockedWriter{w: &captured}
+	listen(t, live)
+	for range names {
+		nextItem(t, items)
+	}
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	// Blank lines are skipped.
+	if err := os.WriteFile(path, append(captured.Bytes(), '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replay, replayed := newTestWatcher(t, nil, nil)
+	if err := replay.Replay(context.Background(), path, 0); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range names {
+		item := nextItem(t, replayed)
+		if item.MarketName != want || item.Price != float64(i+1) {
+			t.Errorf("replayed %q at %g, want %q at %d", item.MarketName, item.Price, want, i+1)
+		}
+	}
+	noItem(t, replayed)
+
+	if err := replay.Replay(context.Background(), filepath.Join(t.TempDir(), "missing"), 0); err == nil {
+		t.Error("replaying a missing file succeeded")
+	}
+}
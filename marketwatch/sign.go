@@ -0,0 +1,52 @@
+package marketwatch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Signature-Timestamp"
+
+	// SignatureMaxAge is how old a signed request VerifySignature accepts.
+	SignatureMaxAge = 5 * time.Minute
+)
+
+var (
+	errSignatureMismatch = errors.New("signature does not match")
+	errSignatureExpired  = errors.New("signature timestamp outside the allowed window")
+)
+
+// signBody returns the X-Signature value for body sent at ts: "sha256="
+// and the hex HMAC-SHA256, keyed with secret, of the decimal Unix
+// timestamp, a "." and the raw request body bytes.
+func signBody(secret []byte, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a request signed by HTTPHook, given the values of
+// its X-Signature and X-Signature-Timestamp headers and the unmodified body.
+// Requests older or newer than maxAge are rejected to limit replays.
+func VerifySignature(secret, body []byte, timestamp, signature string, maxAge time.Duration) error {
+	ts, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > maxAge || age < -maxAge {
+		return errSignatureExpired
+	}
+	if !hmac.Equal([]byte(signBody(secret, ts, body)), []byte(strings.TrimSpace(signature))) {
+		return errSignatureMismatch
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("shared secret")
+	body := []byte(`{"market_name":"AK-47 | Redline (Field-Tested)","price":12.5}`)
+	now := time.Now().Unix()
+	signature := signBody(secret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		body      []byte
+		timestamp string
+		signature string
+		want      error
+	}{
+		{name: "valid", timestamp: strconv.FormatInt(now, 10), signature: signature},
+		{name: "padded headers", timestamp: " " + strconv.FormatInt(now, 10), signature: signature + " "},
+		{name: "wrong secret", secret: []byte("other"), timestamp: strconv.FormatInt(now, 10), signature: signature, want: errSignatureMismatch},
+		{name: "modified body", body: []byte(`{"market_name":"AK-47 | Redline (Field-Tested)","price":1.25}`), timestamp: strconv.FormatInt(now, 10), signature: signature, want: errSignatureMismatch},
+		{name: "timestamp not signed", timestamp: strconv.FormatInt(now+1, 10), signature: signature, want: errSignatureMismatch},
+		{name: "replayed", timestamp: strconv.FormatInt(now-600, 10), signature: signBody(secret, now-600, body), want: errSignatureExpired},
+		{name: "from the future", timestamp: strconv.FormatInt(now+600, 10), signature: signBody(secret, now+600, body), want: errSignatureExpired},
+		{name: "bad timestamp", timestamp: "yesterday", signature: signature, want: errors.New("invalid signature timestamp")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, b := secret, body
+			if tt.secret != nil {
+				s = tt.secret
+			}
+			if tt.body != nil {
+				b = tt.body
+			}
+			err := VerifySignature(s, b, tt.timestamp, tt.signature, SignatureMaxAge)
+			if tt.want == nil && err != nil || tt.want != nil && (err == nil || err.Error() != tt.want.Error()) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPHookSigns(t *testing.T) {
+	secret := []byte("shared secret")
+	verified := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified <- VerifySignature(secret, body, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), SignatureMaxAge)
+	}))
+	defer srv.Close()
+
+	hook := NewHTTPHook(srv.URL, time.Second)
+	hook.Secret = secret
+	if err := hook.OnMatch(context.Background(), &Item{MarketName: "AK-47 | Redline (Field-Tested)", Price: 12.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-verified; err != nil {
+		t.Errorf("hook request does not verify: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package marketwatch
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// SinkQueueSize is how many items each sink may fall behind by before the
+// fan-out drops items for it.
+const SinkQueueSize = 1000
+
+// Sink receives items from the fan-out. Each sink has its own goroutine
+// and queue, so a slow or failing sink delays and fails only itself; an
+// error is logged and counted, and the next item is delivered as usual.
+type Sink interface {
+	Consume(ctx context.Context, item *Item) error
+}
+
+// EventSink is a Sink that also takes ItemEvents: what history channels
+// report about listed items, and relistings with -price-changes. Events are
+// delivered to EventSinks of every stage.
+type EventSink interface {
+	Sink
+	ConsumeEvent(ctx context.Context, ev *ItemEvent) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, item *Item) error
+
+func (f SinkFunc) Consume(ctx context.Context, item *Item) error {
+	return f(ctx, item)
+}
+
+// Which items a sink is registered for.
+const (
+	// SinkParsed sinks get every parsed item that is not blacklisted,
+	// before any filter: the NATS/Kafka publisher passes on the whole feed.
+	SinkParsed = iota
+	// SinkFiltered sinks get the items passing the currency, name,
+	// watchlist, quality and discount filters that are not duplicates,
+	// before the price and float filters: the database.
+	SinkFiltered
+	// SinkMatched sinks get the items passing the filters, like Items().
+	SinkMatched
+)
+
+// sinkFanOut delivers items to the registered sinks. It is shared by all
+// watchers; sinks are registered before Start.
+type sinkFanOut struct {
+	logger  *slog.Logger
+	metrics *metrics
+	workers []*sinkWorker
+	closed  chan struct{}
+	wg      sync.WaitGroup
+}
+
+type sinkWorker struct {
+	name   string
+	stage  int
+	sink   Sink
+	events EventSink // sink, when it takes events
+	queue  chan sinkEntry
+}
+
+// sinkEntry is an item or an event.
+type sinkEntry struct {
+	item  *Item
+	event *ItemEvent
+}
+
+func newSinkFanOut(m *metrics, logger *slog.Logger) *sinkFanOut {
+	return &sinkFanOut{logger: logger, metrics: m, closed: make(chan struct{})}
+}
+
+func (f *sinkFanOut) Register(name string, stage int, sink Sink) {
+	events, _ := sink.(EventSink)
+	f.workers = append(f.workers, &sinkWorker{
+		name:   name,
+		stage:  stage,
+		sink:   sink,
+		events: events,
+		queue:  make(chan sinkEntry, SinkQueueSize),
+	})
+}
+
+// Start runs a goroutine per sink until Close.
+func (f *sinkFanOut) Start(ctx context.Context) {
+	for _, w := range f.workers {
+		f.wg.Add(1)
+		go f.run(ctx, w)
+	}
+}
+
+// Close stops the sinks once they have consumed the items already queued,
+// so nothing is lost on shutdown or at the end of a replay. It must come
+// before the sinks' own resources are closed.
+func (f *sinkFanOut) Close() {
+	close(f.closed)
+	f.wg.Wait()
+}
+
+// Deliver queues item for the sinks of stage, dropping it for those whose
+// queue is full. The watcher goes on filling in the item for the later
+// stages while the sinks read it, so they get a copy.
+func (f *sinkFanOut) Deliver(stage int, item *Item) {
+	if f == nil {
+		return
+	}
+	var copied *Item
+	for _, w := range f.workers {
+		if w.stage != stage {
+			continue
+		}
+		if copied == nil {
+			c := *item
+			copied = &c
+		}
+		f.queue(w, sinkEntry{item: copied})
+	}
+}
+
+// DeliverEvent queues ev for the sinks taking events, like Deliver.
+func (f *sinkFanOut) DeliverEvent(ev *ItemEvent) {
+	if f == nil {
+		return
+	}
+	var copied *ItemEvent
+	for _, w := range f.workers {
+		if w.events == nil {
+			continue
+		}
+		if copied == nil {
+			item := *ev.Item
+			copied = &ItemEvent{Kind: ev.Kind, Item: &item, At: ev.At}
+		}
+		f.queue(w, sinkEntry{event: copied})
+	}
+}
+
+func (f *sinkFanOut) queue(w *sinkWorker, entry sinkEntry) {
+	select {
+	case w.queue <- entry:
+	default:
+		f.metrics.sinkDropped.WithLabelValues(w.name).Inc()
+		f.logger.Debug("Sink queue full, dropping item", "sink", w.name, "market_name", entry.marketName())
+	}
+}
+
+func (e sinkEntry) marketName() string {
+	if e.event != nil {
+		return e.event.Item.MarketName
+	}
+	return e.item.MarketName
+}
+
+func (f *sinkFanOut) run(ctx context.Context, w *sinkWorker) {
+	defer f.wg.Done()
+	for {
+		select {
+		case entry := <-w.queue:
+			f.consume(ctx, w, entry)
+		case <-f.closed:
+			// Shutdown cancels ctx; the remaining items still deserve a
+			// try.
+			ctx := context.WithoutCancel(ctx)
+			for {
+				select {
+				case entry := <-w.queue:
+					f.consume(ctx, w, entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (f *sinkFanOut) consume(ctx context.Context, w *sinkWorker, entry sinkEntry) {
+	var err error
+	if entry.event != nil {
+		err = w.events.ConsumeEvent(ctx, entry.event)
+	} else {
+		err = w.sink.Consume(ctx, entry.item)
+	}
+	if err != nil {
+		f.metrics.sinkErrors.WithLabelValues(w.name).Inc()
+		f.logger.Error("Sink failed", "sink", w.name, "market_name", entry.marketName(), "err", err)
+	}
+}
+
+// storeSink saves items to a Store, and events when it is an EventStore.
+type storeSink struct{ store Store }
+
+func (s storeSink) Consume(_ context.Context, item *Item) error {
+	return s.store.SaveItem(item)
+}
+
+func (s storeSink) ConsumeEvent(_ context.Context, ev *ItemEvent) error {
+	if events, ok := s.store.(EventStore); ok {
+		return events.SaveEvent(ev)
+	}
+	return nil
+}
+
+func (q *publishQueue) Consume(_ context.Context, item *Item) error {
+	event, err := MarshalEvent(item)
+	if err != nil {
+		return err
+	}
+	q.Enqueue(item.Market, event)
+	return nil
+}
+
+func (q *publishQueue) ConsumeEvent(_ context.Context, ev *ItemEvent) error {
+	event, err := MarshalItemEvent(ev)
+	if err != nil {
+		return err
+	}
+	q.Enqueue(ev.Item.Market, event)
+	return nil
+}
+
+func (c *csvWriter) Consume(_ context.Context, item *Item) error {
+	return c.Write(item)
+}
+
+func (n *notifyDispatcher) Consume(_ context.Context, item *Item) error {
+	n.Enqueue(item)
+	return nil
+}
+
+func (r *hookRunner) Consume(ctx context.Context, item *Item) error {
+	r.Run(ctx, item)
+	return nil
+}
+
+func (r *itemRing) Consume(_ context.Context, item *Item) error {
+	r.Add(item)
+	return nil
+}
+
+func (h *streamHub) Consume(_ context.Context, item *Item) error {
+	h.Publish(item)
+	return nil
+}
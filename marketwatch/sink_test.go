@@ -0,0 +1,169 @@
+package marketwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recordingSink records the items and events it consumes. With a gate it
+// blocks on each item until the gate is closed, and with err it fails
+// every item after recording it.
+type recordingSink struct {
+	mu     sync.Mutex
+	items  []string
+	events []string
+	gate   chan struct{}
+	err    error
+}
+
+func (s *recordingSink) Consume(ctx context.Context, item *Item) error {
+	s.mu.Lock()
+	s.items = append(s.items, item.MarketName)
+	s.mu.Unlock()
+	if s.gate != nil {
+		<-s.gate
+	}
+	return s.err
+}
+
+func (s *recordingSink) ConsumeEvent(ctx context.Context, ev *ItemEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, ev.Kind+" "+ev.Item.MarketName)
+	s.mu.Unlock()
+	return s.err
+}
+
+func (s *recordingSink) consumed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.items...)
+}
+
+func TestSinkFanOut(t *testing.T) {
+	m := newMetrics()
+	f := newSinkFanOut(m, testLogger)
+	gate := make(chan struct{})
+	sinks := []struct {
+		name  string
+		stage int
+		sink  *recordingSink
+		// want is how many of the matched items the sink consumes.
+		want    int
+		errors  float64
+		dropped float64
+	}{
+		{name: "first", stage: SinkMatched, sink: &recordingSink{}, want: 1100},
+		// Fails every item and the event.
+		{name: "failing", stage: SinkMatched, sink: &recordingSink{err: errors.New("disk full")}, want: 1100, errors: 1100 + 1},
+		// Stuck on the first item, so only its queue's worth waits behind it.
+		{name: "stuck", stage: SinkMatched, sink: &recordingSink{gate: gate}, want: 1 + SinkQueueSize, dropped: 1100 - 1 - SinkQueueSize},
+		{name: "last", stage: SinkMatched, sink: &recordingSink{}, want: 1100},
+		{name: "parsed", stage: SinkParsed, sink: &recordingSink{}},
+	}
+	for _, s := range sinks {
+		f.Register(s.name, s.stage, s.sink)
+	}
+	f.Start(context.Background())
+
+	// Events go to the sinks of every stage.
+	f.DeliverEvent(&ItemEvent{Kind: EventSold, Item: &Item{MarketName: "sold item"}})
+	f.Deliver(SinkParsed, &Item{MarketName: "parsed item"})
+	stuck := sinks[2].sink
+	f.Deliver(SinkMatched, &Item{MarketName: "item 0"})
+	waitFor(t, "the stuck sink to take an item", func() bool { return len(stuck.consumed()) == 1 })
+	// In batches the healthy sinks keep up with, whatever the stuck one does.
+	for n := 1; n < 1100; {
+		for end := n + 100; n < end && n < 1100; n++ {
+			f.Deliver(SinkMatched, &Item{MarketName: fmt.Sprintf("item %d", n)})
+		}
+		waitFor(t, "the healthy sinks", func() bool {
+			return len(sinks[0].sink.consumed()) == n && len(sinks[1].sink.consumed()) == n && len(sinks[3].sink.consumed()) == n
+		})
+	}
+	close(gate)
+	f.Close()
+
+	for _, s := range sinks {
+		items := s.sink.consumed()
+		if s.stage == SinkParsed {
+			if len(items) != 1 || items[0] != "parsed item" {
+				t.Errorf("%s sink consumed %q, want only the parsed item", s.name, items)
+			}
+		} else if len(items) != s.want {
+			t.Errorf("%s sink consumed %d items, want %d", s.name, len(items), s.want)
+		}
+		for i, name := range items {
+			if s.stage == SinkMatched && name != fmt.Sprintf("item %d", i) {
+				t.Errorf("%s sink item %d is %q, want them in order", s.name, i, name)
+				break
+			}
+		}
+		if len(s.sink.events) != 1 || s.sink.events[0] != "sold sold item" {
+			t.Errorf("%s sink events %q, want the sale", s.name, s.sink.events)
+		}
+		if got := testutil.ToFloat64(m.sinkErrors.WithLabelValues(s.name)); got != s.errors {
+			t.Errorf("%s sink errors = %g, want %g", s.name, got, s.errors)
+		}
+		if got := testutil.ToFloat64(m.sinkDropped.WithLabelValues(s.name)); got != s.dropped {
+			t.Errorf("%s sink dropped = %g, want %g", s.name, got, s.dropped)
+		}
+	}
+}
+
+func TestWatcherSinks(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPrice = 100
+	d, items := newTestWatcher(t, nil, cfg)
+	d.sinks = newSinkFanOut(d.metrics, testLogger)
+	parsed, filtered, matched := &recordingSink{}, &recordingSink{}, &recordingSink{}
+	d.sinks.Register("parsed", SinkParsed, parsed)
+	d.sinks.Register("filtered", SinkFiltered, filtered)
+	d.sinks.Register("failing", SinkMatched, SinkFunc(func(context.Context, *Item) error {
+		return errors.New("webhook down")
+	}))
+	d.sinks.Register("matched", SinkMatched, matched)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.sinks.Start(ctx)
+
+	for _, payload := range []string{
+		`{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"}`,
+		`{"i_market_name": "AWP | Dragon Lore (Factory New)", "ui_price": "9000"}`,
+		`{"i_market_name": "Operation Bravo Case", "ui_price": "1.5"}`,
+	} {
+		d.processMessage(feedFrame("newitems_go", payload))
+	}
+	// The failing sink holds up neither the other sinks nor Items().
+	for _, want := range []string{"AK-47 | Redline (Field-Tested)", "Operation Bravo Case"} {
+		if item := nextItem(t, items); item.MarketName != want {
+			t.Errorf("emitted %q, want %q", item.MarketName, want)
+		}
+	}
+	d.sinks.Close()
+
+	all := []string{"AK-47 | Redline (Field-Tested)", "AWP | Dragon Lore (Factory New)", "Operation Bravo Case"}
+	tests := []struct {
+		name string
+		sink *recordingSink
+		want []string
+	}{
+		{"parsed", parsed, all},
+		// The database sees items the price filters drop.
+		{"filtered", filtered, all},
+		{"matched", matched, []string{"AK-47 | Redline (Field-Tested)", "Operation Bravo Case"}},
+	}
+	for _, tt := range tests {
+		if got := tt.sink.consumed(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s sink consumed %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(d.metrics.sinkErrors.WithLabelValues("failing")); got != 2 {
+		t.Errorf("failing sink errors = %g, want 2", got)
+	}
+}
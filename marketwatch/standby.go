@@ -0,0 +1,241 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// StandbyFrames is how many frames a promoted standby buffers between its
+// read loop and Listen.
+const StandbyFrames = 256
+
+// standbyConn is a connection dialed and authenticated ahead of need but
+// not subscribed to any channel, so it carries no items and nothing is
+// processed twice while it and the active connection are both open. Its
+// read loop runs for the life of the connection: gorilla/websocket allows
+// one reader, and a read cannot be interrupted without breaking the
+// connection, so once promoted it hands frames to Listen instead.
+type standbyConn struct {
+	conn     *websocket.Conn
+	frames   chan []byte
+	err      error // read error, set before frames is closed
+	promoted atomic.Bool
+	writer   *connWriter
+	stopPing chan struct{}
+	pinging  sync.WaitGroup
+	gone     chan struct{} // closed once the standby died or was promoted
+	goneOnce sync.Once
+	done     chan struct{} // closed when Listen is finished with it
+	doneOnce sync.Once
+}
+
+func (s *standbyConn) release() {
+	s.goneOnce.Do(func() { close(s.gone) })
+}
+
+// close ends a promoted standby: the read loop stops even while blocked
+// handing a frame to a Listen that has returned.
+func (s *standbyConn) close() {
+	s.doneOnce.Do(func() { close(s.done) })
+	s.conn.Close()
+}
+
+// maintainStandby keeps one standby connection ready while ctx is live,
+// dialing a replacement whenever the current one dies or is promoted.
+func (d *MarketWatcher) maintainStandby(ctx context.Context) {
+	failures := 0
+	for ctx.Err() == nil {
+		s, err := d.dialStandby(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			delay := backoff(failures)
+			failures++
+			d.logger.Warn("Standby connection failed", "err", err, "retry_in", delay)
+			sleepContext(ctx, delay)
+			continue
+		}
+		failures = 0
+		d.standbyMu.Lock()
+		d.standby = s
+		d.standbyMu.Unlock()
+		d.logger.Debug("Standby connection ready")
+
+		select {
+		case <-s.gone:
+		case <-ctx.Done():
+		}
+		d.standbyMu.Lock()
+		if d.standby == s {
+			d.standby = nil
+		}
+		d.standbyMu.Unlock()
+		if !s.promoted.Load() {
+			s.writer.close()
+			s.conn.Close()
+		}
+	}
+}
+
+// dialStandby opens and authenticates a connection without subscribing.
+func (d *MarketWatcher) dialStandby(ctx context.Context) (*standbyConn, error) {
+	if _, expires := d.tokenState(); time.Now().After(expires) {
+		return nil, fmt.Errorf("no valid token")
+	}
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &standbyConn{
+		conn:     conn,
+		writer:   newConnWriter(conn),
+		frames:   make(chan []byte, StandbyFrames),
+		stopPing: make(chan struct{}),
+		gone:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if token, _ := d.tokenState(); token != "" {
+		if err := s.writer.send(websocket.TextMessage, []byte(token), time.Duration(d.config.WriteTimeout)); err != nil {
+			s.writer.close()
+			conn.Close()
+			return nil, fmt.Errorf("send token: %w", err)
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Duration(d.config.ReadTimeout)))
+	// Set once for both roles: the handler runs on the read loop, so
+	// Listen must not replace it after promotion.
+	conn.SetPongHandler(func(string) error {
+		if s.promoted.Load() {
+			d.markPong()
+			d.signalAlive()
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Duration(d.config.ReadTimeout)))
+		return nil
+	})
+	go d.readStandby(s)
+	s.pinging.Add(1)
+	go d.pingStandby(s)
+	return s, nil
+}
+
+// readStandby discards what arrives before promotion (pongs and the auth
+// reply) and forwards everything after it. A rejected token ends the
+// standby.
+func (d *MarketWatcher) readStandby(s *standbyConn) {
+	defer close(s.frames)
+	defer s.release()
+	for {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			s.err = err
+			return
+		}
+		if s.promoted.Load() {
+			select {
+			case s.frames <- msg:
+			case <-s.done:
+				return
+			}
+			continue
+		}
+		s.conn.SetReadDeadline(time.Now().Add(time.Duration(d.config.ReadTimeout)))
+		if string(bytes.TrimSpace(msg)) == "pong" {
+			continue
+		}
+		var data map[string]interface{}
+		if decodeJSON(msg, &data) != nil {
+			continue
+		}
+		msgType, _ := data["type"].(string)
+		success, _ := data["success"].(bool)
+		if msgType == msgTypeError || (msgType == msgTypeAuth && !success) {
+			d.logger.Warn("Standby connection rejected", "message", systemText(data))
+			s.err = fmt.Errorf("standby rejected: %s", systemText(data))
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+func (d *MarketWatcher) pingStandby(s *standbyConn) {
+	defer s.pinging.Done()
+	ticker := time.NewTicker(d.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopPing:
+			return
+		case <-s.gone:
+			return
+		case <-ticker.C:
+			kind, data := websocket.TextMessage, []byte("ping")
+			if d.config.PingMode == PingModeControl {
+				kind, data = websocket.PingMessage, nil
+			}
+			err := s.writer.send(kind, data, time.Duration(d.config.WriteTimeout))
+			if err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// promoteStandby makes the standby the active connection and subscribes
+// it. It reports false when there is no live standby, leaving Run to
+// reconnect as usual.
+func (d *MarketWatcher) promoteStandby() bool {
+	d.standbyMu.Lock()
+	s := d.standby
+	d.standby = nil
+	d.standbyMu.Unlock()
+	if s == nil {
+		return false
+	}
+	select {
+	case <-s.gone:
+		return false
+	default:
+	}
+
+	close(s.stopPing)
+	s.pinging.Wait()
+	s.promoted.Store(true)
+	s.release()
+
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+	if old := d.conn.Load(); old != nil {
+		old.Close()
+	}
+	d.conn.Store(s.conn)
+	d.setWriter(s.writer)
+	d.promoted = s
+	d.received.Store(false)
+	// Re-send the token in case it was refreshed while on standby. The
+	// subscription replies are handled as system frames by Listen.
+	msgs := [][]byte{}
+	if token, _ := d.tokenState(); token != "" {
+		msgs = append(msgs, []byte(token))
+	}
+	for _, channel := range d.channels() {
+		msgs = append(msgs, []byte(channel))
+	}
+	for _, msg := range msgs {
+		if err := d.writeMessage(msg); err != nil {
+			d.logger.Error("Standby promotion failed", "err", err)
+			s.conn.Close()
+			return false
+		}
+	}
+	d.setState(StateSubscribed)
+	d.logger.Info("Promoted standby connection", "event", "standby_promoted", "channels", d.channels())
+	return true
+}
@@ -0,0 +1,167 @@
+package marketwatch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// standbyServer is a feed that, unlike feedServer, accepts connections that
+// authenticate and then only ping for a while. The second connection, the
+// first standby, sends an item before it is subscribed, which it must drop;
+// every connection sends one named after itself once subscribed. The first
+// connection waits for the standby to ping, then closes with closeCode.
+type standbyServer struct {
+	*httptest.Server
+	tokens  atomic.Int32
+	conns   atomic.Int32
+	pinged  chan int
+	subbed  chan int
+	closing int
+}
+
+func newStandbyServer(t *testing.T, closeCode int) *standbyServer {
+	t.Helper()
+	s := &standbyServer{pinged: make(chan int, 64), subbed: make(chan int, 8), closing: closeCode}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		s.tokens.Add(1)
+		fmt.Fprint(w, `{"success": true, "token": "test-token"}`)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := int(s.conns.Add(1))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		if n == 2 {
+			sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "Sticker | unsubscribed", "ui_price": "1"}`))
+		}
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch string(msg) {
+			case "test-token":
+			case "ping":
+				conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+				select {
+				case s.pinged <- n:
+				default:
+				}
+			default:
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "subscribe", "status": "subscribed"}`))
+				sendFrames(conn, feedFrame("newitems_go", fmt.Sprintf(`{"i_market_name": "Sticker | conn %d", "ui_price": "1"}`, n)))
+				s.subbed <- n
+				if n == 1 {
+					go s.closeFirst(conn)
+				}
+			}
+		}
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// closeFirst closes the first connection once a standby has pinged.
+func (s *standbyServer) closeFirst(conn *websocket.Conn) {
+	for n := range s.pinged {
+		if n != 1 {
+			break
+		}
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(s.closing, "bye"), time.Now().Add(time.Second))
+}
+
+func TestStandbyPromotion(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		promoted bool
+		next     string // the connection that delivers the next item
+		tokens   int32
+	}{
+		{name: "going away promotes", code: websocket.CloseGoingAway, promoted: true, next: "Sticker | conn 2", tokens: 1},
+		{name: "server error promotes", code: websocket.CloseInternalServerErr, promoted: true, next: "Sticker | conn 2", tokens: 1},
+		{name: "policy violation reconnects", code: websocket.ClosePolicyViolation, next: "Sticker | conn 3", tokens: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStandbyServer(t, tt.code)
+			cfg := DefaultConfig()
+			cfg.WarmStandby = true
+			cfg.APIKey = "test-key"
+			market := MarketConfig{
+				Name:     "test",
+				WSURL:    "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws",
+				TokenURL: srv.URL + "/token",
+				Game:     DefaultGame,
+			}
+			d := NewMarketWatcher(market, cfg, testLogger, io.Discard, newMetrics(), newStats())
+			var log strings.Builder
+			out := &lockedWriter{w: &log}
+			d.logger = slog.New(slog.NewTextHandler(out, nil))
+			items := make(chan *Item, 64)
+			d.items = items
+			d.pingInterval = 50 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- d.Run(ctx) }()
+			defer cancel()
+
+			if item := nextItem(t, items); item.MarketName != "Sticker | conn 1" {
+				t.Fatalf("first item %q, want it from the first connection", item.MarketName)
+			}
+			if item := nextItem(t, items); item.MarketName != tt.next {
+				t.Errorf("next item %q, want %q", item.MarketName, tt.next)
+			}
+			noItem(t, items)
+			if n := srv.tokens.Load(); n != tt.tokens {
+				t.Errorf("%d token requests, want %d", n, tt.tokens)
+			}
+			if tt.promoted {
+				// A fresh standby replaces the promoted one.
+				waitFor(t, "a new standby", func() bool { return srv.conns.Load() == 3 })
+			}
+			cancel()
+			<-done
+			if got := strings.Contains(log.String(), "Promoted standby connection"); got != tt.promoted {
+				t.Errorf("promoted %v, want %v", got, tt.promoted)
+			}
+		})
+	}
+}
+
+func TestPromoteStandbyWithoutStandby(t *testing.T) {
+	d, _ := newTestWatcher(t, nil, nil)
+	if d.promoteStandby() {
+		t.Error("promoted without a standby")
+	}
+	gone := &standbyConn{gone: make(chan struct{})}
+	gone.release()
+	d.standby = gone
+	if d.promoteStandby() {
+		t.Error("promoted a dead standby")
+	}
+	if d.standby != nil {
+		t.Error("dead standby kept")
+	}
+}
@@ -0,0 +1,73 @@
+package marketwatch
+
+// State is where a watcher is in its connection lifecycle:
+//
+//	Disconnected -> Connecting -> Authenticating -> Subscribed -> Disconnected
+//	                     ^               |               |            |
+//	                     +---------- Reconnecting <------+------------+
+//
+// Connecting covers the token request and the dial, Authenticating starts
+// once the token is sent. A failed attempt moves to Reconnecting for the
+// backoff delay; a connection that drops passes through Disconnected first
+// and a rejected token goes straight to Reconnecting. Run leaves the
+// watcher Disconnected when it returns.
+type State int32
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateAuthenticating
+	StateSubscribed
+	StateReconnecting
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateAuthenticating:
+		return "authenticating"
+	case StateSubscribed:
+		return "subscribed"
+	case StateReconnecting:
+		return "reconnecting"
+	default:
+		return "disconnected"
+	}
+}
+
+// State returns the watcher's current connection state. It is safe to call
+// from any goroutine.
+func (d *MarketWatcher) State() State {
+	return State(d.state.Load())
+}
+
+// signalAlive passes a message or pong on a subscribed connection to
+// Config.OnReady and OnAlive. Replayed frames and the token exchange before
+// subscribing don't count.
+func (d *MarketWatcher) signalAlive() {
+	if d.State() != StateSubscribed {
+		return
+	}
+	if d.ready != nil && d.config.OnReady != nil {
+		d.ready.Do(d.config.OnReady)
+	}
+	if d.config.OnAlive != nil {
+		d.config.OnAlive()
+	}
+}
+
+func (d *MarketWatcher) setState(s State) {
+	prev := State(d.state.Swap(int32(s)))
+	if prev == s {
+		return
+	}
+	d.logger.Info("State changed", "event", "state", "from", prev.String(), "to", s.String())
+
+	connected := 0.0
+	if s == StateSubscribed {
+		connected = 1
+	}
+	d.metrics.connected.WithLabelValues(d.name).Set(connected)
+	d.metrics.state.WithLabelValues(d.name).Set(float64(s))
+}
@@ -0,0 +1,162 @@
+package marketwatch
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// stateRecorder is a slog handler that keeps the target state of every
+// "State changed" record.
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []string
+}
+
+func (r *stateRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (r *stateRecorder) WithAttrs([]slog.Attr) slog.Handler       { return r }
+func (r *stateRecorder) WithGroup(string) slog.Handler            { return r }
+
+func (r *stateRecorder) Handle(_ context.Context, rec slog.Record) error {
+	if rec.Message != "State changed" {
+		return nil
+	}
+	rec.Attrs(func(a slog.Attr) bool {
+		if a.Key == "to" {
+			r.mu.Lock()
+			r.states = append(r.states, a.Value.String())
+			r.mu.Unlock()
+		}
+		return true
+	})
+	return nil
+}
+
+func (r *stateRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.states, " ")
+}
+
+func TestStateTransitions(t *testing.T) {
+	tests := []struct {
+		name string
+		// rejectToken has the token endpoint refuse the API key.
+		rejectToken bool
+		want        string
+	}{
+		{
+			name: "connect and disconnect",
+			want: "connecting authenticating subscribed disconnected reconnecting " +
+				"connecting authenticating subscribed disconnected",
+		},
+		{
+			name:        "rejected token",
+			rejectToken: true,
+			want:        "connecting reconnecting connecting disconnected",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every connection is dropped once subscribed.
+			srv := newFeedServer(t, func(n int, conn *websocket.Conn) { conn.Close() })
+			cfg := DefaultConfig()
+			cfg.MaxRetries = 1
+			d, _ := newTestWatcher(t, srv, cfg)
+			if tt.rejectToken {
+				d.market.TokenURL = tokenServer(t, http.StatusOK, `{"success": false, "error": "wrong key"}`).URL
+			}
+			rec := &stateRecorder{}
+			d.logger = slog.New(rec)
+
+			if err := d.Run(context.Background()); err == nil {
+				t.Fatal("Run returned nil, want the retry limit error")
+			}
+			if got := rec.String(); got != tt.want {
+				t.Errorf("states %q, want %q", got, tt.want)
+			}
+			if d.State() != StateDisconnected {
+				t.Errorf("state after Run = %s, want disconnected", d.State())
+			}
+		})
+	}
+}
+
+func TestHealthReportsState(t *testing.T) {
+	d, _ := newTestWatcher(t, nil, nil)
+	d.setState(StateAuthenticating)
+	api := &apiServer{watchers: []*MarketWatcher{d}, stats: newStats(), logger: testLogger}
+	rec := httptest.NewRecorder()
+	api.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"state":"authenticating"`) {
+		t.Errorf("/healthz = %d %s, want 503 in the authenticating state", rec.Code, rec.Body)
+	}
+	if got := testutil.ToFloat64(d.metrics.state.WithLabelValues(d.name)); got != float64(StateAuthenticating) {
+		t.Errorf("state gauge = %g, want %d", got, StateAuthenticating)
+	}
+}
+
+func TestSignalAlive(t *testing.T) {
+	frames := make(chan []byte)
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		for frame := range frames {
+			conn.WriteMessage(websocket.TextMessage, frame)
+		}
+	})
+	var ready, alive atomic.Int32
+	cfg := DefaultConfig()
+	cfg.OnReady = func() { ready.Add(1) }
+	cfg.OnAlive = func() { alive.Add(1) }
+	d, items := newTestWatcher(t, srv, cfg)
+	once := new(sync.Once)
+	d.ready = once
+
+	item := feedFrame("newitems_go", `{"i_market_name": "Operation Bravo Case", "ui_price": "1.5"}`)
+	// Replayed or otherwise, nothing counts before the subscription.
+	d.processMessage(item)
+	nextItem(t, items)
+	if ready.Load() != 0 || alive.Load() != 0 {
+		t.Fatalf("ready %d, alive %d before connecting, want none", ready.Load(), alive.Load())
+	}
+	listen(t, d)
+	defer close(frames)
+	if ready.Load() != 0 || alive.Load() != 0 {
+		t.Fatalf("ready %d, alive %d on subscribing, want none before a message", ready.Load(), alive.Load())
+	}
+
+	steps := []struct {
+		name  string
+		frame []byte
+		ready int32
+		alive int32
+	}{
+		{"first item", item, 1, 1},
+		{"second item", item, 1, 2},
+		{"text pong", []byte("pong"), 1, 3},
+		{"system frame", []byte(`{"type": "status", "status": "subscribed"}`), 1, 4},
+	}
+	for _, s := range steps {
+		frames <- s.frame
+		waitFor(t, s.name, func() bool { return alive.Load() == s.alive })
+		if got := ready.Load(); got != s.ready {
+			t.Errorf("%s: ready called %d times, want %d", s.name, got, s.ready)
+		}
+	}
+
+	// Ready is once for the process, not per market.
+	other, _ := newTestWatcher(t, nil, cfg)
+	other.ready = once
+	other.setState(StateSubscribed)
+	other.processMessage(item)
+	if ready.Load() != 1 || alive.Load() != 5 {
+		t.Errorf("ready %d, alive %d after another market's message, want 1, 5", ready.Load(), alive.Load())
+	}
+}
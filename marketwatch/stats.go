@@ -0,0 +1,189 @@
+package marketwatch
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+type PriceStats struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+}
+
+func (p *PriceStats) add(price float64) {
+	p.Count++
+	if p.Count == 1 || price < p.Min {
+		p.Min = price
+	}
+	if p.Count == 1 || price > p.Max {
+		p.Max = price
+	}
+	p.Mean += (price - p.Mean) / float64(p.Count)
+}
+
+// Stats accumulates per-session counters. Prices are summarized
+// incrementally so memory does not grow with the number of items.
+type Stats struct {
+	mu       sync.Mutex
+	started  time.Time
+	messages int64
+	parsed   int64
+	matched  int64
+	events   map[string]int64
+	prices   map[string]*PriceStats
+	floats   map[string]*floatHistogram
+
+	// Set with -bandwidth-stats.
+	bandwidth *bandwidthMeter
+}
+
+type StatsSnapshot struct {
+	Uptime   string                `json:"uptime"`
+	Messages int64                 `json:"messages"`
+	Parsed   int64                 `json:"parsed"`
+	Matched  int64                 `json:"matched"`
+	Events   map[string]int64      `json:"events,omitempty"`
+	Prices   map[string]PriceStats `json:"prices"`
+	Floats   map[string]FloatStats `json:"floats"`
+
+	Bandwidth *BandwidthSnapshot `json:"bandwidth,omitempty"`
+}
+
+func newStats() *Stats {
+	return &Stats{
+		started: time.Now(),
+		events:  make(map[string]int64),
+		prices:  make(map[string]*PriceStats),
+		floats:  make(map[string]*floatHistogram),
+	}
+}
+
+func (s *Stats) recordMessage() {
+	s.mu.Lock()
+	s.messages++
+	s.mu.Unlock()
+}
+
+func (s *Stats) recordParsed(item *Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parsed++
+	p, ok := s.prices[item.Currency]
+	if !ok {
+		p = &PriceStats{}
+		s.prices[item.Currency] = p
+	}
+	p.add(item.Price)
+
+	if item.Float != nil {
+		category := itemCategory(item.MarketName)
+		h, ok := s.floats[category]
+		if !ok {
+			h = &floatHistogram{}
+			s.floats[category] = h
+		}
+		h.add(*item.Float)
+	}
+}
+
+func (s *Stats) recordMatched() {
+	s.mu.Lock()
+	s.matched++
+	s.mu.Unlock()
+}
+
+// recordEvent counts an ItemEvent passed on, by kind.
+func (s *Stats) recordEvent(kind string) {
+	s.mu.Lock()
+	s.events[kind]++
+	s.mu.Unlock()
+}
+
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := StatsSnapshot{
+		Uptime:   time.Since(s.started).Round(time.Second).String(),
+		Messages: s.messages,
+		Parsed:   s.parsed,
+		Matched:  s.matched,
+		Prices:   make(map[string]PriceStats, len(s.prices)),
+		Floats:   make(map[string]FloatStats, len(s.floats)),
+	}
+	if len(s.events) > 0 {
+		snap.Events = make(map[string]int64, len(s.events))
+		for kind, n := range s.events {
+			snap.Events[kind] = n
+		}
+	}
+	for currency, p := range s.prices {
+		snap.Prices[currency] = *p
+	}
+	for category, h := range s.floats {
+		snap.Floats[category] = h.stats()
+	}
+	if s.bandwidth != nil {
+		bandwidth := s.bandwidth.Snapshot()
+		snap.Bandwidth = &bandwidth
+	}
+	return snap
+}
+
+func (s *Stats) Log(logger *slog.Logger) {
+	snap := s.Snapshot()
+	logger.Info("Session stats", "uptime", snap.Uptime,
+		"messages", snap.Messages, "parsed", snap.Parsed, "matched", snap.Matched)
+	if len(snap.Events) > 0 {
+		attrs := make([]any, 0, 2*len(snap.Events))
+		for _, kind := range []string{EventListed, EventSold, EventDelisted, EventPriceChanged} {
+			if n, ok := snap.Events[kind]; ok {
+				attrs = append(attrs, kind, n)
+			}
+		}
+		logger.Info("Event stats", attrs...)
+	}
+	if b := snap.Bandwidth; b != nil {
+		logger.Info("Bandwidth stats", "bytes", b.Bytes, "messages", b.Messages,
+			"rate", b.Rate, "peak_rate", b.PeakRate)
+	}
+
+	currencies := make([]string, 0, len(snap.Prices))
+	for currency := range snap.Prices {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		p := snap.Prices[currency]
+		logger.Info("Price stats", "currency", currency, "count", p.Count,
+			"min", p.Min, "max", p.Max, "mean", p.Mean)
+	}
+
+	categories := make([]string, 0, len(snap.Floats))
+	for category := range snap.Floats {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		f := snap.Floats[category]
+		logger.Info("Float stats", "category", category, "count", f.Count,
+			"min", f.Min, "p1", f.P1, "p50", f.P50, "p99", f.P99, "max", f.Max)
+	}
+}
+
+func (s *Stats) LogEvery(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Log(logger)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package marketwatch
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	StoreBatchSize   = 100
+	StoreBatchWindow = 500 * time.Millisecond
+	storeQueueSize   = 1000
+)
+
+// StoreRetryDelay is the wait before retrying a failed batch on stores that
+// retry; it doubles with every attempt.
+const StoreRetryDelay = time.Second
+
+var errStoreClosed = errors.New("store is closed")
+
+type Store interface {
+	SaveItem(*Item) error
+	Close() error
+}
+
+// EventStore is a Store that also keeps ItemEvents, in a table of their
+// own: a sale or delisting is not a listing.
+type EventStore interface {
+	Store
+	SaveEvent(*ItemEvent) error
+}
+
+// storedItem is an item, or the item of an event when event is set.
+type storedItem struct {
+	item       *Item
+	event      *ItemEvent
+	receivedAt time.Time
+}
+
+// sqlStore writes items and events from a background goroutine, grouping
+// those that arrive within StoreBatchWindow into a single transaction. The
+// SQLite and Postgres stores differ only in schema and insert statements.
+type sqlStore struct {
+	db          *sql.DB
+	logger      *slog.Logger
+	insert      string
+	eventInsert string
+	retries     int
+	queue       chan storedItem
+	done        chan struct{}
+	closed      chan struct{}
+}
+
+// item_id is Item.ID, unique like in the Postgres schema; rows written
+// before it existed have none.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS items (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	market_name TEXT NOT NULL,
+	quality     TEXT,
+	price       REAL NOT NULL,
+	currency    TEXT,
+	float_value REAL,
+	inspect_url TEXT,
+	received_at TIMESTAMP NOT NULL,
+	item_id     TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_items_market_name ON items (market_name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_items_item_id ON items (item_id);
+CREATE TABLE IF NOT EXISTS events (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind        TEXT NOT NULL,
+	item_id     TEXT NOT NULL,
+	market_name TEXT NOT NULL,
+	price       REAL NOT NULL,
+	currency    TEXT,
+	inspect_url TEXT,
+	event_at    TIMESTAMP,
+	received_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_market_name ON events (market_name);
+`
+
+const sqliteEventInsert = `INSERT INTO events
+	(kind, item_id, market_name, price, currency, inspect_url, event_at, received_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+const sqliteInsert = `INSERT INTO items
+	(market_name, quality, price, currency, float_value, inspect_url, received_at, item_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (item_id) DO UPDATE SET
+		quality = EXCLUDED.quality,
+		currency = EXCLUDED.currency,
+		float_value = COALESCE(EXCLUDED.float_value, items.float_value),
+		received_at = EXCLUDED.received_at`
+
+func NewSQLiteStore(path string, logger *slog.Logger) (Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	// Before the schema, whose unique index needs the column.
+	if err := addSQLiteItemID(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return newSQLStore(db, sqliteInsert, sqliteEventInsert, 0, logger), nil
+}
+
+// addSQLiteItemID upgrades databases created before item_id was in the
+// schema: they get the column, with a NULL id for their old rows. New
+// databases have no items table yet and are left to the schema.
+func addSQLiteItemID(db *sql.DB) error {
+	var tables, hasColumn int
+	err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'items'`).Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+	err = db.QueryRow(`SELECT count(*) FROM pragma_table_info('items') WHERE name = 'item_id'`).Scan(&hasColumn)
+	if err != nil {
+		return err
+	}
+	if hasColumn == 0 {
+		_, err = db.Exec(`ALTER TABLE items ADD COLUMN item_id TEXT`)
+	}
+	return err
+}
+
+func newSQLStore(db *sql.DB, insert, eventInsert string, retries int, logger *slog.Logger) *sqlStore {
+	s := &sqlStore{
+		db:          db,
+		logger:      logger,
+		insert:      insert,
+		eventInsert: eventInsert,
+		retries:     retries,
+		queue:       make(chan storedItem, storeQueueSize),
+		done:        make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *sqlStore) SaveItem(item *Item) error {
+	return s.save(storedItem{item: item, receivedAt: time.Now()})
+}
+
+func (s *sqlStore) SaveEvent(ev *ItemEvent) error {
+	return s.save(storedItem{item: ev.Item, event: ev, receivedAt: time.Now()})
+}
+
+func (s *sqlStore) save(si storedItem) error {
+	select {
+	case <-s.closed:
+		return errStoreClosed
+	default:
+	}
+
+	select {
+	case s.queue <- si:
+		return nil
+	case <-s.closed:
+		return errStoreClosed
+	}
+}
+
+func (s *sqlStore) Close() error {
+	close(s.closed)
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *sqlStore) run() {
+	defer close(s.done)
+
+	for {
+		var first storedItem
+		select {
+		case first = <-s.queue:
+		case <-s.closed:
+			s.drain()
+			return
+		}
+
+		batch := []storedItem{first}
+		timer := time.NewTimer(StoreBatchWindow)
+	collect:
+		for len(batch) < StoreBatchSize {
+			select {
+			case next := <-s.queue:
+				batch = append(batch, next)
+			case <-timer.C:
+				break collect
+			case <-s.closed:
+				break collect
+			}
+		}
+		timer.Stop()
+		s.writeBatch(batch)
+	}
+}
+
+func (s *sqlStore) drain() {
+	var batch []storedItem
+	for {
+		select {
+		case next := <-s.queue:
+			batch = append(batch, next)
+		default:
+			if len(batch) > 0 {
+				s.writeBatch(batch)
+			}
+			return
+		}
+	}
+}
+
+// writeBatch retries a failed batch up to s.retries times. The pool drops
+// broken connections, so a retry after the database comes back reconnects.
+// Items still failing then are logged and dropped.
+func (s *sqlStore) writeBatch(batch []storedItem) {
+	delay := StoreRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := s.write(batch)
+		if err == nil {
+			return
+		}
+		if attempt >= s.retries {
+			s.logger.Error("Store write failed", "err", err, "items", len(batch))
+			return
+		}
+		s.logger.Warn("Store write failed, retrying", "err", err, "attempt", attempt+1, "retry_in", delay)
+		select {
+		case <-time.After(delay):
+		case <-s.closed:
+		}
+		delay *= 2
+	}
+}
+
+func (s *sqlStore) write(batch []storedItem) error {
+	if len(batch) == 1 {
+		query, args := s.row(batch[0])
+		if _, err := s.db.Exec(query, args...); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	stmts := make(map[string]*sql.Stmt, 2)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	for _, si := range batch {
+		query, args := s.row(si)
+		stmt, ok := stmts[query]
+		if !ok {
+			if stmt, err = tx.Prepare(query); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("prepare: %w", err)
+			}
+			stmts[query] = stmt
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// row is the insert statement and its arguments for si.
+func (s *sqlStore) row(si storedItem) (string, []interface{}) {
+	if si.event != nil {
+		return s.eventInsert, eventArgs(si)
+	}
+	return s.insert, itemArgs(si)
+}
+
+func eventArgs(si storedItem) []interface{} {
+	var at interface{}
+	if si.event.At != nil {
+		at = si.event.At.UTC()
+	}
+	return []interface{}{
+		si.event.Kind,
+		si.item.ID(),
+		si.item.MarketName,
+		si.item.Price,
+		si.item.Currency,
+		si.item.InspectURL,
+		at,
+		si.receivedAt.UTC(),
+	}
+}
+
+func itemArgs(si storedItem) []interface{} {
+	var floatValue interface{}
+	if si.item.Float != nil {
+		floatValue = *si.item.Float
+	}
+	return []interface{}{
+		si.item.MarketName,
+		si.item.Quality,
+		si.item.Price,
+		si.item.Currency,
+		floatValue,
+		si.item.InspectURL,
+		si.receivedAt.UTC(),
+		si.item.ID(),
+	}
+}
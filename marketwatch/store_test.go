@@ -0,0 +1,100 @@
+package marketwatch
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStoreUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// The items table as it was before item_id, with a repeated listing.
+	_, err = db.Exec(`CREATE TABLE items (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	market_name TEXT NOT NULL,
+	quality     TEXT,
+	price       REAL NOT NULL,
+	currency    TEXT,
+	float_value REAL,
+	inspect_url TEXT,
+	received_at TIMESTAMP NOT NULL
+);
+INSERT INTO items (market_name, price, received_at) VALUES
+	('Operation Bravo Case', 1.5, '2024-05-01 12:00:00'),
+	('Operation Bravo Case', 1.5, '2024-05-01 12:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSQLiteStore(path, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveItem(&Item{MarketName: "Sticker | Tyloo", Price: 0.03}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows, ids int
+	if err := db.QueryRow(`SELECT count(*), count(item_id) FROM items`).Scan(&rows, &ids); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 3 || ids != 1 {
+		t.Errorf("%d rows, %d with an id after the upgrade; want the old rows kept and 1 new", rows, ids)
+	}
+}
+
+func TestSQLiteStoreUpsertFloat(t *testing.T) {
+	tests := []struct {
+		name   string
+		floats []*float64 // of each save of one listing
+		want   *float64
+	}{
+		{name: "looked up later", floats: []*float64{nil, floatPtr(0.25)}, want: floatPtr(0.25)},
+		{name: "lookup failed later", floats: []*float64{floatPtr(0.25), nil}, want: floatPtr(0.25)},
+		{name: "never found", floats: []*float64{nil, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "items.db")
+			store, err := NewSQLiteStore(path, testLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			listing := &Item{MarketName: "AK-47 | Redline (Field-Tested)", Price: 12, InspectURL: "steam://rungame/730/1/+csgo_econ_action_preview M1A2D3"}
+			// As parsed: the ID leaves out the float a lookup adds.
+			listing.id = listing.ID()
+			for _, float := range tt.floats {
+				saved := *listing
+				saved.Float = float
+				if err := store.SaveItem(&saved); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := sql.Open("sqlite", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var rows int
+			var float sql.NullFloat64
+			if err := db.QueryRow(`SELECT count(*), max(float_value) FROM items`).Scan(&rows, &float); err != nil {
+				t.Fatal(err)
+			}
+			if rows != 1 || float.Valid != (tt.want != nil) || tt.want != nil && float.Float64 != *tt.want {
+				t.Errorf("%d rows with float %v, want 1 with %v", rows, float, tt.want)
+			}
+		})
+	}
+}
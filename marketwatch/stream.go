@@ -0,0 +1,85 @@
+package marketwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StreamClientBuffer = 64
+	StreamKeepAlive    = 15 * time.Second
+)
+
+// streamHub fans items out to every connected /stream client. A client that
+// can't keep up misses items instead of slowing down the others.
+type streamHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{clients: make(map[chan []byte]struct{})}
+}
+
+func (h *streamHub) Subscribe() chan []byte {
+	ch := make(chan []byte, StreamClientBuffer)
+	h.mu.Lock()
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *streamHub) Unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+func (h *streamHub) Publish(item *Item) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+func (s *apiServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := s.stream.Subscribe()
+	defer s.stream.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(StreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			fmt.Fprintf(w, "event: item\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,128 @@
+package marketwatch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamClients reports how many clients the hub has.
+func streamClients(h *streamHub) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// waitFor polls cond until it holds or a few seconds pass.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readEvents reads n item events from an SSE body, skipping keepalives.
+func readEvents(t *testing.T, body io.Reader, n int) []Item {
+	t.Helper()
+	var items []Item
+	scanner := bufio.NewScanner(body)
+	event := ""
+	for len(items) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if event != "item" {
+				t.Fatalf("data for event %q", event)
+			}
+			var item Item
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &item); err != nil {
+				t.Fatal(err)
+			}
+			items = append(items, item)
+		}
+	}
+	if len(items) < n {
+		t.Fatalf("read %d events, want %d: %v", len(items), n, scanner.Err())
+	}
+	return items
+}
+
+func TestStreamFanOut(t *testing.T) {
+	hub := newStreamHub()
+	api := &apiServer{stream: hub, logger: testLogger}
+	srv := httptest.NewServer(api.handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var bodies []io.ReadCloser
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", got)
+		}
+		bodies = append(bodies, resp.Body)
+	}
+	waitFor(t, "both clients", func() bool { return streamClients(hub) == 2 })
+
+	names := []string{"AK-47 | Redline (Field-Tested)", "AWP | Asiimov (Field-Tested)", "Operation Bravo Case"}
+	for _, name := range names {
+		if err := hub.Consume(ctx, &Item{MarketName: name, Price: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, body := range bodies {
+		items := readEvents(t, body, len(names))
+		for j, item := range items {
+			if item.MarketName != names[j] {
+				t.Errorf("client %d event %d = %q, want %q", i, j, item.MarketName, names[j])
+			}
+		}
+	}
+
+	cancel()
+	waitFor(t, "clients to leave", func() bool { return streamClients(hub) == 0 })
+}
+
+func TestStreamSkipsSlowClient(t *testing.T) {
+	hub := newStreamHub()
+	slow, fast := hub.Subscribe(), hub.Subscribe()
+	for i := 0; i < StreamClientBuffer+10; i++ {
+		hub.Publish(&Item{MarketName: "Sticker | Tyloo"})
+		<-fast
+	}
+	if len(slow) != StreamClientBuffer {
+		t.Errorf("slow client holds %d items, want %d", len(slow), StreamClientBuffer)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	api := &apiServer{stream: newStreamHub(), logger: testLogger}
+	rec := httptest.NewRecorder()
+	api.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `new EventSource("stream")`) {
+		t.Errorf("GET / = %d, body does not open the stream", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	api.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /missing = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package marketwatch
+
+import "strings"
+
+// System frames carry no items: authentication results, server errors and
+// subscription status. They come with the channel-less types below.
+const (
+	msgTypeAuth      = "auth"
+	msgTypeError     = "error"
+	msgTypeStatus    = "status"
+	msgTypeSubscribe = "subscribe"
+)
+
+// handleSystemMessage logs system frames and reports whether data was one.
+// A rejected token drops the connection straight away with the token marked
+// expired, so the reconnect fetches a fresh one instead of waiting for the
+// server to time the socket out.
+func (d *MarketWatcher) handleSystemMessage(msgType string, data map[string]interface{}) bool {
+	text := systemText(data)
+	switch msgType {
+	case msgTypeAuth:
+		if success, ok := data["success"].(bool); ok && success {
+			d.logger.Debug("Authenticated", "message", text)
+			return true
+		}
+		d.authFailed(text)
+	case msgTypeError:
+		d.logger.Error("Server error", "event", "server_error", "message", text)
+		if lower := strings.ToLower(text); strings.Contains(lower, "auth") || strings.Contains(lower, "token") {
+			d.authFailed(text)
+		}
+	case msgTypeStatus, msgTypeSubscribe:
+		d.logger.Info("Subscription status", "event", "subscription_status", "message", text)
+	default:
+		return false
+	}
+	return true
+}
+
+func (d *MarketWatcher) authFailed(reason string) {
+	d.logger.Warn("Authentication rejected, refreshing token", "event", "auth_failed", "message", reason)
+	d.setState(StateReconnecting)
+	d.expireToken()
+	d.closeConn()
+}
+
+// systemText picks the human-readable part of a system frame, which the
+// server puts under different keys depending on the message.
+func systemText(data map[string]interface{}) string {
+	for _, key := range []string{"message", "error", "status", "data"} {
+		if s, ok := data[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package marketwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandleSystemMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		frame      string
+		handled    bool
+		authFailed bool
+	}{
+		{name: "auth ok", frame: `{"type": "auth", "success": true, "message": "ok"}`, handled: true},
+		{name: "auth rejected", frame: `{"type": "auth", "success": false, "message": "bad token"}`, handled: true, authFailed: true},
+		{name: "auth without result", frame: `{"type": "auth"}`, handled: true, authFailed: true},
+		{name: "token error", frame: `{"type": "error", "error": "Token expired"}`, handled: true, authFailed: true},
+		{name: "auth error", frame: `{"type": "error", "message": "Not AUTHORIZED"}`, handled: true, authFailed: true},
+		{name: "other error", frame: `{"type": "error", "message": "rate limit"}`, handled: true},
+		{name: "error without text", frame: `{"type": "error"}`, handled: true},
+		{name: "status", frame: `{"type": "status", "status": "subscribed"}`, handled: true},
+		{name: "subscribe", frame: `{"type": "subscribe", "data": "newitems_go"}`, handled: true},
+		{name: "feed message", frame: `{"type": "market_news", "data": "{}"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestWatcher(t, nil, nil)
+			d.tokenExpires = time.Now().Add(time.Hour)
+			d.setState(StateSubscribed)
+
+			var data map[string]interface{}
+			if err := decodeJSON([]byte(tt.frame), &data); err != nil {
+				t.Fatal(err)
+			}
+			msgType, _ := data["type"].(string)
+			if got := d.handleSystemMessage(msgType, data); got != tt.handled {
+				t.Errorf("handled = %v, want %v", got, tt.handled)
+			}
+			_, expires := d.tokenState()
+			if failed := expires.IsZero(); failed != tt.authFailed {
+				t.Errorf("token expired = %v, want %v", failed, tt.authFailed)
+			}
+			if tt.authFailed != (d.State() == StateReconnecting) {
+				t.Errorf("state %s after the frame", d.State())
+			}
+		})
+	}
+}
+
+func TestSystemText(t *testing.T) {
+	tests := []struct {
+		data map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"message": "a", "error": "b"}, "a"},
+		{map[string]interface{}{"message": "", "error": "b"}, "b"},
+		{map[string]interface{}{"status": "c", "data": "d"}, "c"},
+		{map[string]interface{}{"data": 5}, ""},
+		{map[string]interface{}{}, ""},
+	}
+	for _, tt := range tests {
+		if got := systemText(tt.data); got != tt.want {
+			t.Errorf("systemText(%v) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	TelegramAPIURL    = "https://api.telegram.org"
+	TelegramRetries   = 3
+	TelegramQueueSize = 100
+)
+
+// Telegram allows about 30 messages per second per bot and 20 per minute
+// in a group; with a single chat the per-chat limit is the one that bites.
+var telegramRate = rate.Every(time.Minute / 20)
+
+// telegramNotifier sends items to a chat through the Bot API. Notify and
+// Alert only queue the message; Run delivers the queue at the chat's rate limit so a
+// burst of matches doesn't hold up other notifiers.
+type telegramNotifier struct {
+	apiURL  string
+	chatID  string
+	client  *http.Client
+	limiter *rate.Limiter
+	queue   chan string
+	logger  *slog.Logger
+}
+
+// NewTelegramNotifier sends through transport, like NewDiscordNotifier.
+func NewTelegramNotifier(token, chatID string, transport http.RoundTripper, logger *slog.Logger) *telegramNotifier {
+	return &telegramNotifier{
+		apiURL:  fmt.Sprintf("%s/bot%s/sendMessage", TelegramAPIURL, token),
+		chatID:  chatID,
+		client:  &http.Client{Transport: transport},
+		limiter: rate.NewLimiter(telegramRate, 3),
+		queue:   make(chan string, TelegramQueueSize),
+		logger:  logger,
+	}
+}
+
+func (n *telegramNotifier) Notify(ctx context.Context, item *Item) error {
+	select {
+	case n.queue <- telegramText(item):
+		return nil
+	default:
+		return errors.New("telegram queue full, dropping item")
+	}
+}
+
+func (n *telegramNotifier) Alert(ctx context.Context, text string) error {
+	select {
+	case n.queue <- html.EscapeString(text):
+		return nil
+	default:
+		return errors.New("telegram queue full, dropping alert")
+	}
+}
+
+func (n *telegramNotifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case text := <-n.queue:
+			if err := n.limiter.Wait(ctx); err != nil {
+				return
+			}
+			if err := n.send(ctx, text); err != nil {
+				n.logger.Error("Telegram notify failed", "err", err)
+			}
+		}
+	}
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// send posts the message, waiting out 429 responses for the retry_after
+// the API asks for, up to TelegramRetries attempts.
+func (n *telegramNotifier) send(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  n.chatID,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := n.post(ctx, body)
+		if err == nil || retryAfter < 0 || attempt >= TelegramRetries {
+			return err
+		}
+		n.logger.Warn("Telegram rate limited", "retry_after", retryAfter)
+		sleepContext(ctx, retryAfter)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends a single request. Like discordNotifier.post it returns the
+// delay requested by a 429 response and a negative delay for final errors.
+func (n *telegramNotifier) post(ctx context.Context, body []byte) (time.Duration, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, n.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	var data telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return -1, fmt.Errorf("telegram returned %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		delay := time.Duration(data.Parameters.RetryAfter) * time.Second
+		if delay <= 0 {
+			delay = time.Second
+		}
+		return delay, errors.New("telegram rate limited")
+	}
+	if !data.OK {
+		return -1, fmt.Errorf("telegram returned %s: %s", resp.Status, data.Description)
+	}
+	return 0, nil
+}
+
+func telegramText(item *Item) string {
+	var b strings.Builder
+	if item.HighPriority {
+		b.WriteString("⭐ ")
+	}
+	fmt.Fprintf(&b, "<b>%s</b>\n", html.EscapeString(item.MarketName))
+	fmt.Fprintf(&b, "Price: %.2f %s\n", item.Price, html.EscapeString(item.Currency))
+	if item.Float != nil {
+		fmt.Fprintf(&b, "Float: %s\n", strconv.FormatFloat(*item.Float, 'f', -1, 64))
+	}
+	if item.NewLow {
+		fmt.Fprintf(&b, "Below floor: %.2f %s\n", *item.FloorPrice, html.EscapeString(item.Currency))
+	}
+	if item.PaintSeed != nil {
+		fmt.Fprintf(&b, "Seed: %d\n", *item.PaintSeed)
+	}
+	if item.InspectURL != "" {
+		fmt.Fprintf(&b, "<a href=\"%s\">Inspect</a>\n", html.EscapeString(item.InspectURL))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
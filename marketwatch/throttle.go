@@ -0,0 +1,31 @@
+package marketwatch
+
+import (
+	"math"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// throttle thins out the unfiltered firehose: it keeps 1 in sampleRate items
+// and caps the rest with a token bucket.
+type throttle struct {
+	sampleRate uint64
+	counter    atomic.Uint64
+	limiter    *rate.Limiter
+}
+
+func newThrottle(sampleRate int, perSecond float64) *throttle {
+	t := &throttle{sampleRate: uint64(sampleRate)}
+	if perSecond > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(perSecond), int(math.Max(1, math.Ceil(perSecond))))
+	}
+	return t
+}
+
+func (t *throttle) Allow() bool {
+	if t.sampleRate > 1 && t.counter.Add(1)%t.sampleRate != 0 {
+		return false
+	}
+	return t.limiter == nil || t.limiter.Allow()
+}
@@ -0,0 +1,73 @@
+package marketwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate int
+		perSecond  float64
+		calls      int
+		min, max   int
+	}{
+		{name: "off", sampleRate: 1, calls: 100, min: 100, max: 100},
+		{name: "sampling", sampleRate: 4, calls: 100, min: 25, max: 25},
+		// The bucket starts full, holding a second's worth.
+		{name: "rate limit", sampleRate: 1, perSecond: 10, calls: 1000, min: 10, max: 12},
+		{name: "both", sampleRate: 2, perSecond: 5, calls: 1000, min: 5, max: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottle(tt.sampleRate, tt.perSecond)
+			allowed := 0
+			for i := 0; i < tt.calls; i++ {
+				if th.Allow() {
+					allowed++
+				}
+			}
+			if allowed < tt.min || allowed > tt.max {
+				t.Errorf("%d of %d allowed, want %d to %d", allowed, tt.calls, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestThrottleCapsThroughput(t *testing.T) {
+	th := newThrottle(1, 20)
+	start := time.Now()
+	allowed := 0
+	for time.Since(start) < 500*time.Millisecond {
+		if th.Allow() {
+			allowed++
+		}
+	}
+	// The burst of 20 plus 20 per second for half a second.
+	if allowed < 25 || allowed > 32 {
+		t.Errorf("%d items allowed in 500ms at 20/s, want about 30", allowed)
+	}
+}
+
+func TestThrottleSkipsFilteredFeed(t *testing.T) {
+	frame := feedFrame("newitems_go", `{"i_market_name": "Revolution Case", "ui_price": "0.5"}`)
+	for _, filtered := range []bool{false, true} {
+		cfg := DefaultConfig()
+		if filtered {
+			cfg.MaxPrice = 10
+		}
+		d, items := newTestWatcher(t, nil, cfg)
+		d.throttle = newThrottle(1, 1)
+		for i := 0; i < 5; i++ {
+			d.processMessage(frame)
+		}
+		want := 1
+		if filtered {
+			want = 5
+		}
+		if got := len(items); got != want {
+			t.Errorf("filtered %v: %d items emitted, want %d", filtered, got, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package marketwatch
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var errPinMismatch = errors.New("server certificate does not match -pin-sha256")
+
+// newTLSConfig returns nil when neither option is set so the defaults stay
+// in place. caFile is trusted in addition to the system roots; pin is the
+// SHA-256 of the leaf certificate's SubjectPublicKeyInfo, base64 or hex.
+func newTLSConfig(caFile, pin string) (*tls.Config, error) {
+	if caFile == "" && pin == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca file %s: no certificates found", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if pin != "" {
+		want, err := decodePin(pin)
+		if err != nil {
+			return nil, err
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errPinMismatch
+			}
+			got := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if subtle.ConstantTimeCompare(got[:], want) != 1 {
+				return fmt.Errorf("%w: got %s", errPinMismatch, base64.StdEncoding.EncodeToString(got[:]))
+			}
+			return nil
+		}
+	}
+	return cfg, nil
+}
+
+func decodePin(pin string) ([]byte, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	if b, err := hex.DecodeString(pin); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(pin); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid pin %q: want a base64 or hex SHA-256 hash", pin)
+}
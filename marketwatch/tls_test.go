@@ -0,0 +1,101 @@
+package marketwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTLSConfigSelfSigned(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		w.Write([]byte(`{"success": true}`))
+	}))
+	// The rejected handshakes are expected.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert := srv.Certificate()
+	caFile := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+	spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	wrong := sha256.Sum256([]byte("another key"))
+
+	tests := []struct {
+		name     string
+		caFile   string
+		pin      string
+		fails    bool
+		mismatch bool
+	}{
+		{name: "system roots only", fails: true},
+		{name: "ca file", caFile: caFile},
+		{name: "ca file and base64 pin", caFile: caFile, pin: base64.StdEncoding.EncodeToString(spki[:])},
+		{name: "ca file and hex pin", caFile: caFile, pin: "sha256/" + hex.EncodeToString(spki[:])},
+		{name: "wrong pin", caFile: caFile, pin: hex.EncodeToString(wrong[:]), fails: true, mismatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(tt.caFile, tt.pin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, dialer, err := newTransport("", tlsConfig, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, httpErr := client.Get(srv.URL + "/token")
+			if httpErr == nil {
+				resp.Body.Close()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, _, wsErr := dialer.DialContext(ctx, "wss"+strings.TrimPrefix(srv.URL, "https")+"/ws", nil)
+			if wsErr == nil {
+				conn.Close()
+			}
+
+			for _, err := range []error{httpErr, wsErr} {
+				if (err != nil) != tt.fails || tt.mismatch && !errors.Is(err, errPinMismatch) {
+					t.Errorf("err = %v, want failure %v, pin mismatch %v", err, tt.fails, tt.mismatch)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	if cfg, err := newTLSConfig("", ""); cfg != nil || err != nil {
+		t.Errorf("no options: %v, %v; want the defaults", cfg, err)
+	}
+	notPEM := writeFile(t, "ca.pem", "not a certificate")
+	for _, tt := range []struct{ caFile, pin string }{
+		{caFile: notPEM},
+		{caFile: notPEM + ".missing"},
+		{pin: "abcd"},
+		{pin: strings.Repeat("z", 64)},
+	} {
+		if _, err := newTLSConfig(tt.caFile, tt.pin); err == nil {
+			t.Errorf("newTLSConfig(%q, %q) succeeded", tt.caFile, tt.pin)
+		}
+	}
+}
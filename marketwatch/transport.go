@@ -0,0 +1,78 @@
+package marketwatch
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	HandshakeTimeout = 45 * time.Second
+	HTTPTimeout      = 15 * time.Second
+	HTTPDialTimeout  = 10 * time.Second
+)
+
+// newTransport builds the HTTP client used for token requests and the
+// WebSocket dialer, both routed through proxyURL when set and sharing
+// tlsConfig. Without an explicit proxy the HTTPS_PROXY/HTTP_PROXY
+// environment is honored. The client is shared by all watchers so its
+// connections are reused; timeout caps every request made with it, on
+// top of the per-request timeouts such as -token-timeout, so a server that
+// accepts the connection and never answers cannot stall a reconnect.
+func newTransport(proxyURL string, tlsConfig *tls.Config, timeout time.Duration) (*http.Client, *websocket.Dialer, error) {
+	netDialer := &net.Dialer{Timeout: HTTPDialTimeout, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = netDialer.DialContext
+	transport.ResponseHeaderTimeout = timeout
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: HandshakeTimeout,
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+		dialer.TLSClientConfig = tlsConfig
+	}
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid proxy %q: %w", proxyURL, err)
+		}
+
+		switch u.Scheme {
+		case "http", "https":
+			transport.Proxy = http.ProxyURL(u)
+			dialer.Proxy = http.ProxyURL(u)
+		case "socks5", "socks5h":
+			socks, err := proxy.FromURL(u, netDialer)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid proxy %q: %w", proxyURL, err)
+			}
+			dialContext := contextDialer(socks)
+			transport.Proxy = nil
+			transport.DialContext = dialContext
+			dialer.Proxy = nil
+			dialer.NetDialContext = dialContext
+		default:
+			return nil, nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, dialer, nil
+}
+
+func contextDialer(d proxy.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if cd, ok := d.(proxy.ContextDialer); ok {
+		return cd.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.Dial(network, addr)
+	}
+}
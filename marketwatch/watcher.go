@@ -0,0 +1,1031 @@
+package marketwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	APIKey         = "YOUR_API_KEY"
+	InitialBackoff = 1 * time.Second
+	MaxBackoff     = 2 * time.Minute
+	BackoffJitter  = 0.2
+	MaxRetries     = 5
+	PingInterval   = 45 * time.Second
+	WriteTimeout   = 10 * time.Second
+	ReadTimeout    = 2 * PingInterval
+	IdleTimeout    = 5 * time.Minute
+	CloseTimeout   = 3 * time.Second
+
+	SubscribeTimeout = 10 * time.Second
+	MinPingInterval  = 5 * time.Second
+
+	TokenTTL         = 9 * time.Minute
+	TokenRefreshLead = 1 * time.Minute
+	TokenRetryDelay  = 10 * time.Second
+	TokenAttempts    = 3
+	TokenBackoff     = 500 * time.Millisecond
+	TokenTimeout     = 10 * time.Second
+	// TokenErrorSnippet is how much of an error response body is logged.
+	TokenErrorSnippet = 512
+	// MaxTokenResponse bounds the token response read; anything past
+	// it is cut off and fails to parse.
+	MaxTokenResponse = 64 << 10
+
+	MaxMessageSize = 1 << 20
+
+	UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+)
+
+// Dialer opens the WebSocket connection; *websocket.Dialer satisfies it.
+type Dialer interface {
+	DialContext(ctx context.Context, urlStr string, requestHeader http.Header) (*websocket.Conn, *http.Response, error)
+}
+
+// MarketWatcher follows one market with one API key. Connect and Listen
+// own only the socket and the fields describing it, grouped first below;
+// a reconnect replaces those and nothing else. The application state
+// after them (dedup, floors, cooldowns, stats and the other components
+// Watcher.Run shares between watchers) lives as long as the process, so
+// reconnecting never forgets what was seen.
+type MarketWatcher struct {
+	conn      atomic.Pointer[websocket.Conn]
+	connMu    sync.Mutex
+	listening atomic.Bool
+	promoted  *standbyConn
+	writer    atomic.Pointer[connWriter]
+	lastPing  time.Time
+	lastPong  atomic.Int64
+	received  atomic.Bool
+
+	name           string
+	apiKey         string
+	dialer         Dialer
+	httpClient     *http.Client
+	standbyMu      sync.Mutex
+	standbyStarted atomic.Bool
+	standby        *standbyConn
+	tokenMu        sync.Mutex
+	token          string
+	tokenExpires   time.Time
+	retries        int
+	pingInterval   time.Duration
+	lastMessage    atomic.Int64
+	lastItem       atomic.Int64
+	state          atomic.Int32
+	ready          *sync.Once
+	breaker        *circuitBreaker
+	budget         *reconnectBudget
+	logger         *slog.Logger
+	market         MarketConfig
+	profile        *GameProfile
+	config         *Config
+	out            io.Writer
+	handlers       map[string]func([]byte)
+	sinks          *sinkFanOut
+	metrics        *metrics
+	notifier       *notifyDispatcher
+	dedup          deduper
+	floors         *priceTracker
+	priceChanges   *priceChangeTracker
+	floats         *floatChecker
+	ctx            context.Context // of Run or Replay, for lookups per item
+	filters        *liveFilters
+	cooldowns      *cooldownTracker
+	rates          RateProvider
+	refs           ReferencePriceProvider
+	throttle       *throttle
+	listings       *listingRate
+	blacklist      *blacklist
+	currencies     *currencyFilter
+	watchlist      *watchlist
+	fields         fieldSet
+	capture        io.Writer
+	unparsed       *parseErrorCapture
+	stats          *Stats
+	bandwidth      *bandwidthMeter
+	items          chan<- *Item
+}
+
+func NewMarketWatcher(market MarketConfig, cfg *Config, logger *slog.Logger, out io.Writer, m *metrics, stats *Stats) *MarketWatcher {
+	d := &MarketWatcher{
+		name:         market.Name,
+		apiKey:       cfg.APIKey,
+		dialer:       websocket.DefaultDialer,
+		httpClient:   &http.Client{Timeout: time.Duration(cfg.HTTPTimeout)},
+		logger:       logger,
+		market:       market,
+		profile:      market.profile(),
+		currencies:   newCurrencyFilter(cfg.Currencies),
+		config:       cfg,
+		out:          out,
+		handlers:     make(map[string]func([]byte)),
+		metrics:      m,
+		stats:        stats,
+		pingInterval: time.Duration(cfg.PingInterval),
+		ctx:          context.Background(),
+	}
+	// Run validates the settings and replaces this with the shared set.
+	if filters, err := newLiveFilters(cfg.filterSettings()); err == nil {
+		d.filters = filters
+	} else {
+		d.filters = &liveFilters{active: &activeFilters{}}
+	}
+	d.fields, _ = parseFields(cfg.Fields)
+	if cfg.BreakerThreshold > 0 {
+		d.breaker = newCircuitBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerCooldown))
+	}
+	if cfg.ReconnectBudget > 0 {
+		d.budget = newReconnectBudget(cfg.ReconnectBudget, ReconnectBudgetWindow)
+	}
+	for _, channel := range d.channels() {
+		channel := channel
+		switch {
+		case strings.HasPrefix(channel, "newitems_"):
+			d.handlers[channel] = func(payload []byte) { d.handleNewItem(channel, payload) }
+		case strings.HasPrefix(channel, "history_"):
+			d.handlers[channel] = func(payload []byte) { d.handleHistory(channel, payload) }
+		}
+	}
+	return d
+}
+
+// channels are the market's own, else -channels, else the game's.
+func (d *MarketWatcher) channels() []string {
+	if len(d.market.Channels) > 0 {
+		return d.market.Channels
+	}
+	if len(d.config.Channels) > 0 {
+		return d.config.Channels
+	}
+	return d.profile.Channels
+}
+
+// Initialize connects, reusing the current token while it is valid; a
+// close classified RecoverRefresh or a rejected token expires it first.
+func (d *MarketWatcher) Initialize(ctx context.Context) error {
+	d.setState(StateConnecting)
+	return d.Connect(ctx)
+}
+
+// UpdateToken fetches a new WebSocket token. While the token breaker is
+// open it fails without contacting the endpoint.
+func (d *MarketWatcher) UpdateToken(ctx context.Context) error {
+	if d.breaker == nil {
+		return d.requestTokenWithRetry(ctx)
+	}
+	if err := d.breaker.Allow(); err != nil {
+		d.logger.Warn("Token request skipped", "err", err)
+		return fmt.Errorf("token request: %w", err)
+	}
+	err := d.requestTokenWithRetry(ctx)
+	d.breaker.Record(err)
+	d.metrics.tokenBreaker.WithLabelValues(d.name).Set(float64(d.breaker.State()))
+	return err
+}
+
+// requestTokenWithRetry makes up to TokenAttempts requests, backing off
+// between them, as long as the failures are ErrTokenNetwork.
+func (d *MarketWatcher) requestTokenWithRetry(ctx context.Context) error {
+	delay := TokenBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.requestToken(ctx)
+		if err == nil || !errors.Is(err, ErrTokenNetwork) || attempt >= TokenAttempts || ctx.Err() != nil {
+			return err
+		}
+		d.logger.Warn("Token request failed, retrying", "attempt", attempt, "delay", delay, "err", err)
+		sleepContext(ctx, delay)
+		delay *= 2
+	}
+}
+
+func (d *MarketWatcher) requestToken(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(d.config.TokenTimeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.market.tokenRequestURL(d.apiKey), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		d.logger.Error("Token request failed", "err", err)
+		return fmt.Errorf("%w: %w", ErrTokenNetwork, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, TokenErrorSnippet))
+		err := &TokenStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(snippet)}
+		d.logger.Error("Token endpoint error", "status", resp.Status, "body", err.Body)
+		return err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxTokenResponse))
+	if err != nil {
+		d.logger.Error("Token response read failed", "err", err)
+		return fmt.Errorf("%w: %w", ErrTokenNetwork, err)
+	}
+
+	var data struct {
+		Success bool        `json:"success"`
+		Token   string      `json:"token"`
+		Error   string      `json:"error"`
+		TTL     interface{} `json:"ttl"`
+		Expires interface{} `json:"expires"`
+	}
+	if err = json.Unmarshal(body, &data); err != nil {
+		d.logger.Error("Token response parse failed", "err", err)
+		return fmt.Errorf("%w: parse token response: %w", ErrTokenNetwork, err)
+	}
+
+	if data.Success {
+		now := time.Now()
+		ttl := tokenTTL(now, data.TTL, data.Expires)
+		if ttl < TokenRefreshLead {
+			d.logger.Warn("Token TTL is shorter than the refresh lead, refreshing early", "ttl", ttl)
+		}
+		d.tokenMu.Lock()
+		d.token = data.Token
+		d.tokenExpires = now.Add(ttl)
+		d.tokenMu.Unlock()
+		d.metrics.tokenRefreshes.Inc()
+		d.logger.Info("Token updated", "event", "token_refresh", "ttl", ttl)
+		return nil
+	}
+
+	d.logger.Error("Token rejected", "reason", data.Error)
+	return fmt.Errorf("%w: %s", ErrTokenAuth, data.Error)
+}
+
+// tokenTTL reads the token lifetime from the response: ttl in seconds, or
+// expires as a Unix time or RFC 3339 timestamp. TokenTTL is the fallback.
+func tokenTTL(now time.Time, ttl, expires interface{}) time.Duration {
+	if seconds, err := numberValue(ttl); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if s, ok := expires.(string); ok {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.Sub(now)
+		}
+	}
+	if unix, err := numberValue(expires); err == nil && unix > 0 {
+		return time.Unix(int64(unix), 0).Sub(now)
+	}
+	return TokenTTL
+}
+
+func (d *MarketWatcher) Connect(ctx context.Context) error {
+	// One Connect at a time; each closes the connection it replaces so a
+	// racing reconnect cannot leak it.
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+	if old := d.conn.Load(); old != nil {
+		if d.listening.Load() {
+			d.logger.Warn("Replacing a connection that is still being read")
+		}
+		old.Close()
+		d.setWriter(nil)
+	}
+
+	if _, expires := d.tokenState(); time.Now().After(expires) {
+		if err := d.UpdateToken(ctx); err != nil {
+			return err
+		}
+	}
+
+	d.logger.Info("Connecting to WebSocket", "url", d.market.WSURL)
+	conn, err := d.dial(ctx)
+	if err != nil {
+		d.logger.Error("Connection failed", "err", err)
+		return err
+	}
+
+	d.conn.Store(conn)
+	d.setWriter(newConnWriter(conn))
+	d.promoted = nil
+	d.received.Store(false)
+	d.setState(StateAuthenticating)
+	if token, _ := d.tokenState(); token != "" {
+		if err = d.writeMessage([]byte(token)); err != nil {
+			d.logger.Error("Token send failed", "err", err)
+			return err
+		}
+	}
+
+	for _, channel := range d.channels() {
+		if err = d.writeMessage([]byte(channel)); err != nil {
+			d.logger.Error("Subscribe failed", "channel", channel, "err", err)
+			return err
+		}
+		if err = d.awaitSubscribe(channel); err != nil {
+			d.logger.Error("Subscribe not confirmed", "channel", channel, "err", err)
+			return err
+		}
+	}
+
+	d.setState(StateSubscribed)
+	d.logger.Info("Connected", "event", "connected", "channels", d.channels())
+	return nil
+}
+
+func (d *MarketWatcher) dial(ctx context.Context) (*websocket.Conn, error) {
+	trace, traceCtx := newDialTrace(ctx)
+	conn, resp, err := d.dialer.DialContext(traceCtx, d.market.WSURL, d.requestHeader())
+	trace.done()
+	for phase, duration := range trace.phases() {
+		d.metrics.dialPhases.WithLabelValues(phase).Observe(duration.Seconds())
+	}
+	if err != nil {
+		d.logger.Debug("Dial failed", append(trace.attrs(), "err", err)...)
+		return nil, err
+	}
+	d.logger.Debug("Dial timing", trace.attrs()...)
+	// Larger frames fail the read with ErrReadLimit instead of being
+	// buffered.
+	conn.SetReadLimit(d.config.MaxMessageSize)
+	if d.config.Compression {
+		negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		d.logger.Info("Compression negotiated", "compression", negotiated)
+	}
+	return conn, nil
+}
+
+// awaitSubscribe waits for the server's reply to a subscription. The
+// confirmation is the first frame received after subscribing; if it is
+// already a feed message it is processed as usual so nothing is lost.
+func (d *MarketWatcher) awaitSubscribe(channel string) error {
+	timeout := time.Duration(d.config.SubscribeTimeout)
+	if timeout == 0 {
+		return nil
+	}
+	conn := d.conn.Load()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("subscribe %s: %w", channel, err)
+	}
+	if d.bandwidth != nil {
+		d.bandwidth.record(len(msg))
+	}
+	d.captureMessage(msg)
+	d.logger.Debug("Subscription confirmed", "channel", channel)
+	if string(bytes.TrimSpace(msg)) != "pong" {
+		d.processMessage(msg)
+	}
+	return nil
+}
+
+// requestHeader builds the handshake headers. -origin overrides the market's
+// own Origin and extra headers from the config are applied last.
+func (d *MarketWatcher) requestHeader() http.Header {
+	origin := d.market.Origin
+	if d.config.Origin != "" {
+		origin = d.config.Origin
+	}
+	header := http.Header{
+		"Origin":     []string{origin},
+		"User-Agent": []string{d.config.UserAgent},
+	}
+	for name, value := range d.config.Headers {
+		header.Set(name, value)
+	}
+	return header
+}
+
+func (d *MarketWatcher) tokenState() (string, time.Time) {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
+	return d.token, d.tokenExpires
+}
+
+// expireToken makes the next Connect fetch a new token.
+func (d *MarketWatcher) expireToken() {
+	d.tokenMu.Lock()
+	d.tokenExpires = time.Time{}
+	d.tokenMu.Unlock()
+}
+
+func (d *MarketWatcher) writeMessage(data []byte) error {
+	return d.send(websocket.TextMessage, data, time.Duration(d.config.WriteTimeout))
+}
+
+// send hands a frame to the current connection's writer.
+func (d *MarketWatcher) send(kind int, data []byte, timeout time.Duration) error {
+	w := d.writer.Load()
+	if w == nil {
+		return errWriterClosed
+	}
+	return w.send(kind, data, timeout)
+}
+
+// setWriter makes w the writer for new frames and stops the one it replaces.
+func (d *MarketWatcher) setWriter(w *connWriter) {
+	if old := d.writer.Swap(w); old != nil {
+		old.close()
+	}
+}
+
+func (d *MarketWatcher) extendReadDeadline(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(time.Duration(d.config.ReadTimeout)))
+}
+
+// closeConn closes the current connection, which makes Listen return.
+// Connect and standby promotion replace it under connMu; closing needs no
+// lock, and must not take it, since a system frame read while Connect
+// awaits a subscription can end up here.
+func (d *MarketWatcher) closeConn() {
+	if conn := d.conn.Load(); conn != nil {
+		conn.Close()
+	}
+}
+
+// refreshToken renews the token shortly before it expires and re-sends it
+// over the live connection, so token rotation does not require a reconnect.
+// A failed send closes conn, the connection Listen reads.
+func (d *MarketWatcher) refreshToken(ctx context.Context, conn *websocket.Conn) {
+	_, expires := d.tokenState()
+	wait := time.Until(expires) - TokenRefreshLead
+
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := d.UpdateToken(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			wait = TokenRetryDelay
+			continue
+		}
+
+		token, expires := d.tokenState()
+		if err := d.writeMessage([]byte(token)); err != nil {
+			d.logger.Error("Token send failed, dropping connection", "err", err)
+			conn.Close()
+			return
+		}
+		// A server handing out very short TTLs must not turn this into a
+		// busy loop.
+		wait = max(time.Until(expires)-TokenRefreshLead, TokenRetryDelay)
+	}
+}
+
+func (d *MarketWatcher) processMessage(message []byte) {
+	d.metrics.messagesReceived.Inc()
+	d.stats.recordMessage()
+	d.lastMessage.Store(time.Now().UnixNano())
+	d.signalAlive()
+	if d.config.Verbose {
+		d.logger.Debug("Frame received", "message", string(message))
+	}
+
+	var data map[string]interface{}
+	if err := decodeJSON(message, &data); err != nil {
+		d.logger.Debug("Non-JSON message", "message", string(message))
+		return
+	}
+
+	msgType, _ := data["type"].(string)
+	handler, ok := d.handlers[msgType]
+	if !ok && d.handleSystemMessage(msgType, data) {
+		return
+	}
+	if !ok {
+		d.logger.Debug("Skipping message of unhandled type", "type", msgType)
+		return
+	}
+	payload, ok := data["data"].(string)
+	if !ok {
+		d.metrics.parseErrors.Inc()
+		d.logger.Error("Unexpected data field", "type", msgType, "data_type", fmt.Sprintf("%T", data["data"]))
+		d.captureParseError(message)
+		return
+	}
+	handler([]byte(payload))
+}
+
+func (d *MarketWatcher) handleNewItem(channel string, payload []byte) {
+	itemData := make(map[string]interface{})
+	if err := decodeJSON(payload, &itemData); err != nil {
+		d.metrics.parseErrors.Inc()
+		d.logger.Error("Data parse failed", "err", err)
+		d.captureParseError(channelFrame(channel, payload))
+		return
+	}
+
+	item, err := parseItem(itemData, d.profile)
+	if err != nil {
+		d.metrics.parseErrors.Inc()
+		var perr *priceError
+		if errors.As(err, &perr) {
+			d.logger.Warn("Skipping item with unparseable price",
+				"market_name", firstValue(itemData, d.profile.Fields.MarketName), "err", err)
+		} else {
+			d.logger.Error("Item parse failed", "err", err)
+		}
+		d.captureParseError(channelFrame(channel, payload))
+		return
+	}
+	for _, warning := range item.warnings {
+		d.logger.Warn("Item field skipped", "market_name", item.MarketName, "reason", warning)
+	}
+	if _, ok := normalizeCurrency(item.RawCurrency); !ok && item.RawCurrency != "" {
+		warnUnknownCurrency(item.RawCurrency, d.logger)
+	}
+	item.Market = d.market.Name
+	item.Channel = channel
+	item.ReceivedAt = time.Now()
+	if item.ImageURL == "" {
+		item.ImageURL = classImageURL(d.market.AppID, item.ClassID)
+	}
+	d.lastItem.Store(item.ReceivedAt.UnixNano())
+	d.metrics.itemsParsed.Inc()
+	if d.listings != nil {
+		d.listings.record()
+	}
+	d.metrics.itemPrices.Observe(item.Price)
+	if item.Float != nil {
+		d.metrics.itemFloats.Observe(*item.Float)
+	}
+	if item.ListedAt != nil {
+		d.metrics.itemLatency.Observe(item.Latency().Seconds())
+	}
+	d.stats.recordParsed(item)
+	if d.blacklist != nil && d.blacklist.Contains(item) {
+		d.logger.Debug("Item blacklisted", "market_name", item.MarketName, "id", item.ID())
+		return
+	}
+	d.sinks.Deliver(SinkParsed, item)
+	if !d.currencies.Allowed(item.Currency) {
+		d.logger.Debug("Item filtered out by currency", "market_name", item.MarketName, "currency", item.Currency)
+		return
+	}
+	filters := d.filters.current()
+	if !nameMatches(item.MarketName, filters.Include, filters.Exclude) {
+		d.logger.Debug("Item filtered out by name", "market_name", item.MarketName)
+		return
+	}
+	if d.watchlist != nil && !d.watchlist.Contains(item.MarketName) {
+		d.logger.Debug("Item not on watchlist", "market_name", item.MarketName)
+		return
+	}
+	if !qualityAllowed(item.Quality, filters.qualities) {
+		d.logger.Debug("Item filtered out by quality", "market_name", item.MarketName, "quality", item.Quality)
+		return
+	}
+
+	if d.rates != nil {
+		if err := convertPrice(item, d.rates, d.config.BaseCurrency); err != nil {
+			d.logger.Debug("Price not converted", "currency", item.Currency, "err", err)
+		}
+	}
+	if d.refs != nil {
+		applyReference(item, d.refs, d.rates)
+		if !discountMatches(item, d.config.MinDiscount) {
+			d.logger.Debug("Item filtered out by discount", "market_name", item.MarketName, "discount", *item.Discount)
+			return
+		}
+	}
+
+	if d.dedup != nil && d.dedup.Seen(item.ID()) {
+		d.logger.Debug("Skipping duplicate item", "market_name", item.MarketName)
+		return
+	}
+
+	if d.priceChanges != nil {
+		if previous, changed := d.priceChanges.Observe(item); changed {
+			d.reportPriceChange(item, previous)
+		}
+	}
+
+	if d.floors != nil {
+		floor, ok := d.floors.Floor(item.MarketName, item.Currency)
+		if d.floors.Observe(item.MarketName, item.Currency, item.Price) && ok {
+			item.FloorPrice = &floor
+			item.NewLow = true
+			d.logger.Info("Price below recent floor", "event", "new_low",
+				"market_name", item.MarketName, "price", item.Price, "currency", item.Currency, "floor_price", floor)
+		}
+	}
+
+	// Before the database gets the item and before matches, so both see
+	// the looked-up float, but only for items the price filters keep.
+	if d.floats != nil && item.Float == nil && item.InspectURL != "" &&
+		priceInRange(item.Price, filters.MinPrice, filters.MaxPrice) &&
+		currencyPriceAllowed(item, d.config.PriceFilter, d.config.StrictCurrency) {
+		d.lookupFloat(item)
+	}
+	d.sinks.Deliver(SinkFiltered, item)
+	if !d.matches(item, filters) {
+		d.logger.Debug("Item filtered out", itemAttrs(item)...)
+		return
+	}
+	if d.throttle != nil && !d.filtersActive(filters) && !d.throttle.Allow() {
+		d.metrics.itemsDropped.Inc()
+		return
+	}
+	if seedWanted(item, d.config.Seeds) || (d.watchlist != nil && d.config.WatchlistPriority) {
+		item.HighPriority = true
+	}
+	if d.cooldowns != nil && !item.HighPriority && !d.cooldowns.Allow(item.MarketName, item.Price) {
+		d.logger.Debug("Item name on cooldown", "market_name", item.MarketName)
+		return
+	}
+
+	d.stats.recordMatched()
+	d.emitItem(item)
+	d.sinks.Deliver(SinkMatched, item)
+}
+
+func (d *MarketWatcher) emitItem(item *Item) {
+	// A nil channel is never ready, so watchers built without one skip it.
+	select {
+	case d.items <- item:
+	default:
+		if d.items != nil {
+			d.logger.Debug("Items channel full, dropping item", "market_name", item.MarketName)
+		}
+	}
+
+	if d.config.JSONOutput() {
+		line, err := marshalEvent(EventNewItem, item, d.fields)
+		if err != nil {
+			d.logger.Error("Item encode failed", "err", err)
+			return
+		}
+		d.writeEvent(line)
+		return
+	}
+	d.logger.Log(context.Background(), d.config.ItemLevel(), "New item", itemAttrs(item)...)
+}
+
+func getValue(data map[string]interface{}, keys ...string) string {
+	key := keys[0]
+	defaultValue := ""
+	if len(keys) > 1 {
+		defaultValue = keys[1]
+	}
+
+	val, ok := data[key]
+	if !ok {
+		return defaultValue
+	}
+
+	switch v := val.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func (d *MarketWatcher) Listen(ctx context.Context) error {
+	if !d.listening.CompareAndSwap(false, true) {
+		return ErrAlreadyListening
+	}
+	defer d.listening.Store(false)
+	// Read the connection Listen started with even if Connect replaces it.
+	d.connMu.Lock()
+	conn, standby := d.conn.Load(), d.promoted
+	d.connMu.Unlock()
+	read := func() ([]byte, error) {
+		_, msg, err := conn.ReadMessage()
+		return msg, err
+	}
+	// A promoted standby keeps its own read loop and pong handler; take
+	// frames from it.
+	if standby != nil && standby.conn == conn {
+		defer standby.close()
+		read = func() ([]byte, error) {
+			msg, ok := <-standby.frames
+			if !ok {
+				return nil, standby.err
+			}
+			return msg, nil
+		}
+	} else {
+		conn.SetPongHandler(func(string) error {
+			d.markPong()
+			d.signalAlive()
+			d.extendReadDeadline(conn)
+			return nil
+		})
+	}
+
+	var frames chan []byte
+	var workers sync.WaitGroup
+	if d.config.Workers > 0 {
+		frames = make(chan []byte, d.config.QueueSize)
+		d.startWorkers(&workers, d.config.Workers, frames)
+	}
+	// Runs last: closing the connection ends the read loop, which closes
+	// frames, so no worker is left emitting items after Listen returns.
+	defer workers.Wait()
+	defer conn.Close()
+	defer d.setState(StateDisconnected)
+
+	ticker := time.NewTicker(d.pingInterval)
+	defer ticker.Stop()
+
+	refreshCtx, stopRefresh := context.WithCancel(ctx)
+	defer stopRefresh()
+	go d.refreshToken(refreshCtx, conn)
+
+	listenStart := time.Now()
+	d.markPong()
+	d.extendReadDeadline(conn)
+
+	done := make(chan error, 1)
+	go func() {
+		if frames != nil {
+			defer close(frames)
+		}
+		for {
+			msg, err := read()
+			if err != nil {
+				if errors.Is(err, websocket.ErrReadLimit) {
+					d.logger.Warn("Message exceeds size limit, reconnecting", "event", "read_limit", "limit", d.config.MaxMessageSize)
+				}
+				done <- fmt.Errorf("%w: %w", ErrConnClosed, err)
+				return
+			}
+			d.extendReadDeadline(conn)
+			d.received.Store(true)
+			if d.bandwidth != nil {
+				d.bandwidth.record(len(msg))
+			}
+			d.captureMessage(msg)
+			if string(bytes.TrimSpace(msg)) == "pong" {
+				d.markPong()
+				d.signalAlive()
+				continue
+			}
+			if frames != nil {
+				d.queueFrame(frames, msg)
+				continue
+			}
+			d.processMessage(msg)
+		}
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			if since := d.sinceLastPong(); since > 2*d.pingInterval {
+				return fmt.Errorf("no pong received for %s", since.Round(time.Second))
+			}
+			// Pongs still arrive, so the connection is up but the feed
+			// itself has stopped.
+			if idle := d.sinceLastMessage(listenStart); d.config.IdleTimeout > 0 && idle > time.Duration(d.config.IdleTimeout) {
+				d.logger.Warn("Feed stalled, reconnecting", "event", "stall", "idle", idle.Round(time.Second))
+				return fmt.Errorf("%w for %s", ErrFeedStalled, idle.Round(time.Second))
+			}
+			if err := d.ping(); err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+			d.lastPing = time.Now()
+		case <-ctx.Done():
+			d.closeGracefully(done)
+			return fmt.Errorf("listen: %w", ctx.Err())
+		}
+	}
+}
+
+func (d *MarketWatcher) ping() error {
+	if d.config.PingMode == PingModeControl {
+		return d.send(websocket.PingMessage, nil, time.Duration(d.config.WriteTimeout))
+	}
+	return d.writeMessage([]byte("ping"))
+}
+
+// adaptPingInterval shortens the ping interval after a connection drops
+// while the feed was quiet for longer than half the interval, which is what
+// a server-side idle timeout looks like from here.
+func (d *MarketWatcher) adaptPingInterval() {
+	last := d.lastMessage.Load()
+	if last == 0 || d.pingInterval <= MinPingInterval {
+		return
+	}
+	if idle := time.Since(time.Unix(0, last)); idle < d.pingInterval/2 {
+		return
+	}
+	d.pingInterval = max(d.pingInterval*3/4, MinPingInterval)
+	d.logger.Warn("Connection dropped while idle, shortening ping interval", "ping_interval", d.pingInterval)
+}
+
+func (d *MarketWatcher) markPong() {
+	d.lastPong.Store(time.Now().UnixNano())
+}
+
+func (d *MarketWatcher) sinceLastPong() time.Duration {
+	return time.Since(time.Unix(0, d.lastPong.Load()))
+}
+
+// sinceLastMessage counts from start when nothing has come in since then,
+// so a message from a previous connection doesn't trip the idle check.
+func (d *MarketWatcher) sinceLastMessage(start time.Time) time.Duration {
+	last := time.Unix(0, d.lastMessage.Load())
+	if last.Before(start) {
+		last = start
+	}
+	return time.Since(last)
+}
+
+func (d *MarketWatcher) closeGracefully(done <-chan error) {
+	d.logger.Info("Closing WebSocket connection")
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := d.send(websocket.CloseMessage, msg, CloseTimeout); err != nil {
+		d.logger.Error("Close frame failed", "err", err)
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(CloseTimeout):
+		d.logger.Warn("Close handshake timed out")
+	}
+}
+
+func (d *MarketWatcher) waitRetry(ctx context.Context) bool {
+	if d.config.MaxRetries >= 0 && d.retries >= d.config.MaxRetries {
+		return false
+	}
+	delay := backoff(d.retries)
+	d.retries++
+	d.setState(StateReconnecting)
+	d.metrics.reconnects.Inc()
+	d.logger.Info("Reconnecting", "event", "reconnect",
+		"attempt", d.retries, "max_retries", d.config.MaxRetries, "delay", delay)
+	sleepContext(ctx, delay)
+	return true
+}
+
+// spendReconnect charges a reconnect to the budget. Once the budget is
+// spent it logs an error, alerts, and waits out the cool-down, after which
+// the budget starts over.
+func (d *MarketWatcher) spendReconnect(ctx context.Context) {
+	if d.budget == nil || d.budget.Spend() {
+		return
+	}
+	cooldown := time.Duration(d.config.ReconnectCooldown)
+	d.setState(StateReconnecting)
+	d.logger.Error("Reconnect budget exhausted, cooling down", "event", "reconnect_budget",
+		"reconnects", d.budget.Used(), "window", ReconnectBudgetWindow, "cooldown", cooldown)
+	if d.notifier != nil {
+		d.notifier.Alert(fmt.Sprintf("%s: %d reconnects in the last %s, pausing reconnects for %s",
+			d.market.Name, d.budget.Used(), ReconnectBudgetWindow, cooldown))
+	}
+	sleepContext(ctx, cooldown)
+	d.budget.Reset()
+}
+
+// backoff returns the delay before the given retry: InitialBackoff doubled
+// per previous failure, capped at MaxBackoff, with ±BackoffJitter applied.
+func backoff(retry int) time.Duration {
+	delay := MaxBackoff
+	if retry < 32 {
+		if d := InitialBackoff << uint(retry); d > 0 && d < MaxBackoff {
+			delay = d
+		}
+	}
+	jitter := 1 + BackoffJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * jitter)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+// Run keeps the watcher connected until ctx is cancelled or the retry
+// limit is exhausted.
+func (d *MarketWatcher) Run(ctx context.Context) error {
+	defer d.setState(StateDisconnected)
+	defer d.setWriter(nil)
+	var standby sync.WaitGroup
+	defer standby.Wait()
+	authFailures := 0
+	promoted := false
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if promoted {
+			promoted = false
+		} else if err := d.Initialize(ctx); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			// A wrong certificate will not fix itself on retry.
+			if errors.Is(err, errPinMismatch) {
+				return err
+			}
+			if errors.Is(err, ErrTokenAuth) {
+				authFailures++
+				if authFailures >= MaxAuthFailures {
+					return fmt.Errorf("giving up after %d rejected tokens: %w", authFailures, err)
+				}
+			} else {
+				authFailures = 0
+			}
+			d.spendReconnect(ctx)
+			if !d.waitRetry(ctx) {
+				return errors.New("max retries reached")
+			}
+			continue
+		}
+		authFailures = 0
+		// The first connection fetched the token the standby needs.
+		if d.config.WarmStandby && d.standbyStarted.CompareAndSwap(false, true) {
+			standby.Add(1)
+			go func() {
+				defer standby.Done()
+				d.maintainStandby(ctx)
+			}()
+		}
+		if d.config.Backfill {
+			d.backfill(ctx)
+		}
+
+		if err := d.Listen(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				continue
+			}
+			d.logger.Error("Listen failed", "err", err)
+			d.closeConn()
+			d.adaptPingInterval()
+			// Only a connection that actually delivered data counts as
+			// recovered; one that dies right after subscribing keeps
+			// backing off.
+			if d.received.Load() {
+				d.retries = 0
+			}
+			recovery, closeErr := closeRecovery(err, d.config.CloseCodes)
+			// 1006 is reported locally for a connection that just dropped.
+			if closeErr != nil && closeErr.Code != websocket.CloseAbnormalClosure {
+				d.logger.Warn("Connection closed by server", "event", "close",
+					"code", closeErr.Code, "reason", closeErr.Text, "recovery", recovery)
+			}
+			switch recovery {
+			case RecoverQuick:
+				d.retries = 0
+			case RecoverRefresh:
+				d.expireToken()
+			}
+			d.spendReconnect(ctx)
+			// A standby authenticated with the token the server just
+			// refused would not fare better.
+			if recovery != RecoverRefresh && d.promoteStandby() {
+				promoted = true
+				continue
+			}
+			if !d.waitRetry(ctx) {
+				return errors.New("max retries reached")
+			}
+		}
+	}
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
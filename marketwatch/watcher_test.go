@@ -0,0 +1,879 @@
+package marketwatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// feedServer stands in for the market: /token hands out tokens and /ws
+// upgrades to a WebSocket that confirms the subscriptions, then runs feed.
+type feedServer struct {
+	*httptest.Server
+	// channels is how many subscriptions a connection makes; 1 by default.
+	channels int
+	// upgrader offers compression; tests may change it before connecting.
+	upgrader websocket.Upgrader
+	feed     func(n int, conn *websocket.Conn)
+	tokens   atomic.Int32
+	conns    atomic.Int32
+}
+
+// newFeedServer calls feed with every connection, numbered from 1, once its
+// subscriptions are confirmed. When feed returns the server keeps reading,
+// answering text pings, until the connection closes.
+func newFeedServer(t *testing.T, feed func(n int, conn *websocket.Conn)) *feedServer {
+	t.Helper()
+	s := &feedServer{channels: 1, feed: feed}
+	s.upgrader = websocket.Upgrader{
+		EnableCompression: true,
+		CheckOrigin:       func(*http.Request) bool { return true },
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		s.tokens.Add(1)
+		fmt.Fprint(w, `{"success": true, "token": "test-token"}`)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := int(s.conns.Add(1))
+
+		// The token comes first, then one frame per channel.
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for i := 0; i < s.channels; i++ {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "subscribe", "status": "subscribed"}`))
+		}
+		if s.feed != nil {
+			s.feed(n, conn)
+		}
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "ping" {
+				conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+			}
+		}
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *feedServer) market() MarketConfig {
+	return MarketConfig{
+		Name:     "test",
+		WSURL:    "ws" + strings.TrimPrefix(s.URL, "http") + "/ws",
+		TokenURL: s.URL + "/token",
+		Game:     DefaultGame,
+	}
+}
+
+// newTestWatcher builds a watcher for srv, or for no server when srv is
+// nil, with its matched items delivered to the returned channel.
+func newTestWatcher(t *testing.T, srv *feedServer, cfg *Config) (*MarketWatcher, <-chan *Item) {
+	t.Helper()
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	cfg.APIKey = "test-key"
+	market := MarketConfig{Name: "test", Game: DefaultGame}
+	if srv != nil {
+		market = srv.market()
+	}
+	d := NewMarketWatcher(market, cfg, testLogger, io.Discard, newMetrics(), newStats())
+	items := make(chan *Item, 64)
+	d.items = items
+	return d, items
+}
+
+// feedFrame wraps a payload the way the feed sends it: as a JSON string in
+// the data field.
+func feedFrame(channel, payload string) []byte {
+	frame, _ := json.Marshal(map[string]string{"type": channel, "data": payload})
+	return frame
+}
+
+func sendFrames(conn *websocket.Conn, frames ...[]byte) {
+	for _, frame := range frames {
+		conn.WriteMessage(websocket.TextMessage, frame)
+	}
+}
+
+func nextItem(t *testing.T, items <-chan *Item) *Item {
+	t.Helper()
+	select {
+	case item := <-items:
+		return item
+	case <-time.After(5 * time.Second):
+		t.Fatal("no item received")
+		return nil
+	}
+}
+
+func noItem(t *testing.T, items <-chan *Item) {
+	t.Helper()
+	select {
+	case item := <-items:
+		t.Fatalf("unexpected item %q", item.MarketName)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// listen connects d and runs Listen until the test ends.
+func listen(t *testing.T, d *MarketWatcher) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := d.Connect(ctx); err != nil {
+		cancel()
+		t.Fatalf("Connect: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Listen(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestListenParsesItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		want     string
+		price    float64
+		currency string
+		float    *float64
+		stickers int
+	}{
+		{
+			name:     "float and stickers",
+			payload:  `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12.50", "ui_currency": "USD", "ui_float": "0.2512", "stickers": [101, 202]}`,
+			want:     "AK-47 | Redline (Field-Tested)",
+			price:    12.5,
+			currency: "USD",
+			float:    floatPtr(0.2512),
+			stickers: 2,
+		},
+		{
+			name:     "without float",
+			payload:  `{"i_market_name": "Sticker | Crown (Foil)", "ui_price": 830, "ui_currency": "RUB", "ui_float": "<nil>"}`,
+			want:     "Sticker | Crown (Foil)",
+			price:    830,
+			currency: "RUB",
+		},
+	}
+
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		sendFrames(conn, []byte("not json"), []byte(`{"type": "market_news", "data": "{}"}`))
+		for _, tt := range tests {
+			sendFrames(conn, feedFrame("newitems_go", tt.payload))
+		}
+	})
+	d, items := newTestWatcher(t, srv, nil)
+	listen(t, d)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := nextItem(t, items)
+			if item.MarketName != tt.want || item.Price != tt.price || item.Currency != tt.currency {
+				t.Errorf("got %q %g %s, want %q %g %s", item.MarketName, item.Price, item.Currency, tt.want, tt.price, tt.currency)
+			}
+			if !equalFloat(item.Float, tt.float) {
+				t.Errorf("float = %v, want %v", item.Float, tt.float)
+			}
+			if len(item.Stickers) != tt.stickers {
+				t.Errorf("%d stickers, want %d", len(item.Stickers), tt.stickers)
+			}
+			if item.Market != "test" || item.Channel != "newitems_go" {
+				t.Errorf("received on %s/%s", item.Market, item.Channel)
+			}
+		})
+	}
+}
+
+func TestRunReconnectsAfterServerClose(t *testing.T) {
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		sendFrames(conn, feedFrame("newitems_go", fmt.Sprintf(`{"i_market_name": "Item %d", "ui_price": "1"}`, n)))
+		if n == 1 {
+			// Mid-stream, without a close frame.
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+		}
+	})
+	d, items := newTestWatcher(t, srv, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+
+	for _, want := range []string{"Item 1", "Item 2"} {
+		if item := nextItem(t, items); item.MarketName != want {
+			t.Fatalf("got %q, want %q", item.MarketName, want)
+		}
+	}
+	if n := srv.conns.Load(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run returned %v, want context.Canceled", err)
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestContextErrorsAreWrapped(t *testing.T) {
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want error
+	}{
+		{
+			name: "cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestWatcher(t, nil, nil)
+			d.market.TokenURL = hanging.URL
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			err := d.Connect(ctx)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Connect returned %v, want it to wrap %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("listen", func(t *testing.T) {
+		d, _ := newTestWatcher(t, newFeedServer(t, nil), nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := d.Connect(ctx); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- d.Listen(ctx) }()
+		cancel()
+		err := <-done
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrConnClosed) {
+			t.Fatalf("Listen returned %v, want it to wrap only context.Canceled", err)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		retry int
+		base  time.Duration
+	}{
+		{0, InitialBackoff},
+		{1, 2 * InitialBackoff},
+		{3, 8 * InitialBackoff},
+		{7, MaxBackoff},
+		{40, MaxBackoff},
+		{1000, MaxBackoff},
+	}
+	for _, tt := range tests {
+		low := time.Duration(float64(tt.base) * (1 - BackoffJitter))
+		high := time.Duration(float64(tt.base) * (1 + BackoffJitter))
+		for i := 0; i < 100; i++ {
+			if got := backoff(tt.retry); got < low || got > high {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.retry, got, low, high)
+			}
+		}
+	}
+}
+
+func TestProcessMessageMalformed(t *testing.T) {
+	frames := map[string]string{
+		"data is a number":      `{"type": "newitems_go", "data": 42}`,
+		"data is an object":     `{"type": "newitems_go", "data": {"i_market_name": "AK-47 | Redline"}}`,
+		"data is an array":      `{"type": "newitems_go", "data": [1, 2]}`,
+		"data is null":          `{"type": "newitems_go", "data": null}`,
+		"data is missing":       `{"type": "newitems_go"}`,
+		"data is not json":      `{"type": "newitems_go", "data": "{oops"}`,
+		"data is a json string": `{"type": "newitems_go", "data": "\"text\""}`,
+		"type is a number":      `{"type": 7, "data": "{}"}`,
+		"frame is an array":     `[{"type": "newitems_go"}]`,
+		"frame is a string":     `"newitems_go"`,
+		"price is an object":    string(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline", "ui_price": {"usd": 1}}`)),
+		"name is missing":       string(feedFrame("newitems_go", `{"ui_price": "1"}`)),
+		"float is an array":     string(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline", "ui_price": "1", "ui_float": [0.1]}`)),
+	}
+	for name, frame := range frames {
+		t.Run(name, func(t *testing.T) {
+			d, items := newTestWatcher(t, nil, nil)
+			d.processMessage([]byte(frame))
+			noItem(t, items)
+		})
+	}
+
+	// Fields of the wrong type that don't prevent parsing are skipped.
+	d, items := newTestWatcher(t, nil, nil)
+	d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline", "ui_price": "1", "stickers": "5021", "ui_paintseed": {}}`))
+	if item := nextItem(t, items); item.Stickers != nil || item.PaintSeed != nil {
+		t.Errorf("stickers %v, paint seed %v, want neither", item.Stickers, item.PaintSeed)
+	}
+}
+
+func TestListenTimesOutSilentPeer(t *testing.T) {
+	silent := make(chan struct{})
+	srv := newFeedServer(t, func(int, *websocket.Conn) { <-silent })
+	t.Cleanup(func() { close(silent) })
+	cfg := DefaultConfig()
+	cfg.ReadTimeout = Duration(300 * time.Millisecond)
+	d, _ := newTestWatcher(t, srv, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := d.Listen(ctx)
+	var netErr interface{ Timeout() bool }
+	if !errors.Is(err, ErrConnClosed) || !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Listen returned %v, want a read timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Listen took %s to notice the silent peer", elapsed)
+	}
+}
+
+func TestTokenTTL(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		ttl, expires interface{}
+		want         time.Duration
+	}{
+		{name: "none", want: TokenTTL},
+		{name: "seconds", ttl: json.Number("300"), want: 5 * time.Minute},
+		{name: "seconds as string", ttl: "90", want: 90 * time.Second},
+		{name: "float seconds", ttl: 1.5, want: 1500 * time.Millisecond},
+		{name: "zero falls back", ttl: json.Number("0"), want: TokenTTL},
+		{name: "garbage falls back", ttl: "soon", want: TokenTTL},
+		{name: "unix expiry", expires: json.Number(fmt.Sprint(now.Add(20 * time.Minute).Unix())), want: 20 * time.Minute},
+		{name: "rfc3339 expiry", expires: now.Add(time.Hour).Format(time.RFC3339), want: time.Hour},
+		{name: "ttl wins", ttl: json.Number("60"), expires: now.Add(time.Hour).Format(time.RFC3339), want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenTTL(now, tt.ttl, tt.expires); got != tt.want {
+				t.Errorf("tokenTTL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// tokenServer answers every token request with status and body.
+func tokenServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRequestTokenExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want time.Duration
+	}{
+		{name: "with ttl", body: `{"success": true, "token": "t", "ttl": 120}`, want: 2 * time.Minute},
+		{name: "without ttl", body: `{"success": true, "token": "t"}`, want: TokenTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestWatcher(t, nil, nil)
+			d.market.TokenURL = tokenServer(t, http.StatusOK, tt.body).URL
+			start := time.Now()
+			if err := d.UpdateToken(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			token, expires := d.tokenState()
+			if token != "t" {
+				t.Errorf("token %q", token)
+			}
+			if got := expires.Sub(start); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("token expires in %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestTokenTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("body") {
+			// Answer, then stall in the middle of the body.
+			io.WriteString(w, `{"success": true, `)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	tests := []struct {
+		name         string
+		url          string
+		tokenTimeout time.Duration
+		httpTimeout  time.Duration
+	}{
+		{name: "token timeout", url: slow.URL, tokenTimeout: 100 * time.Millisecond, httpTimeout: time.Minute},
+		{name: "response header timeout", url: slow.URL, tokenTimeout: time.Minute, httpTimeout: 100 * time.Millisecond},
+		{name: "stalled body", url: slow.URL + "?body", tokenTimeout: time.Minute, httpTimeout: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.TokenTimeout = Duration(tt.tokenTimeout)
+			d, _ := newTestWatcher(t, nil, cfg)
+			client, _, err := newTransport("", nil, tt.httpTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.httpClient = client
+			d.market.TokenURL = tt.url
+
+			start := time.Now()
+			err = d.requestToken(context.Background())
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("token request returned after %s", elapsed)
+			}
+			var netErr interface{ Timeout() bool }
+			if !errors.Is(err, ErrTokenNetwork) || !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("err = %v, want a token network timeout", err)
+			}
+		})
+	}
+}
+
+// tokenReply is one canned token endpoint response; status 0 drops the
+// connection without answering.
+type tokenReply struct {
+	status int
+	body   string
+}
+
+// flakyTokenServer answers the nth request with replies[n], repeating the
+// last reply once they run out, and counts the requests in calls.
+func flakyTokenServer(t *testing.T, calls *atomic.Int32, replies ...tokenReply) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		reply := replies[min(n, len(replies)-1)]
+		if reply.status == 0 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(reply.status)
+		io.WriteString(w, reply.body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUpdateTokenRetries(t *testing.T) {
+	ok := tokenReply{http.StatusOK, `{"success": true, "token": "t"}`}
+	unavailable := tokenReply{http.StatusServiceUnavailable, "try later"}
+	dropped := tokenReply{status: 0}
+	tests := []struct {
+		name    string
+		replies []tokenReply
+		calls   int32
+		wantErr error
+	}{
+		{name: "fails twice then succeeds", replies: []tokenReply{unavailable, unavailable, ok}, calls: 3},
+		{name: "dropped connections", replies: []tokenReply{dropped, dropped, ok}, calls: 3},
+		{name: "gives up", replies: []tokenReply{unavailable}, calls: TokenAttempts, wantErr: ErrTokenNetwork},
+		{name: "rejected key", replies: []tokenReply{{http.StatusOK, `{"success": false, "error": "bad key"}`}}, calls: 1, wantErr: ErrTokenAuth},
+		{name: "unauthorized", replies: []tokenReply{{http.StatusUnauthorized, "no"}, ok}, calls: 1, wantErr: ErrTokenAuth},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			d, _ := newTestWatcher(t, nil, nil)
+			d.market.TokenURL = flakyTokenServer(t, &calls, tt.replies...).URL
+			err := d.UpdateToken(context.Background())
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("%d requests, want %d", got, tt.calls)
+			}
+			if token, _ := d.tokenState(); tt.wantErr == nil && token != "t" {
+				t.Errorf("token %q, want t", token)
+			}
+		})
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	// A long, repetitive name so the frame is worth compressing.
+	name := strings.Repeat("Sticker | Crown (Foil), ", 50) + "Sticker | Crown (Foil)"
+	tests := []struct {
+		name           string
+		client, server bool
+		want           string
+	}{
+		{name: "both", client: true, server: true, want: "compression=true"},
+		{name: "server declines", client: true, want: "compression=false"},
+		{name: "client off", server: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+				sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "`+name+`", "ui_price": "1"}`))
+			})
+			srv.upgrader.EnableCompression = tt.server
+			cfg := DefaultConfig()
+			cfg.Compression = tt.client
+			d, items := newTestWatcher(t, srv, cfg)
+			d.dialer = &websocket.Dialer{EnableCompression: tt.client}
+			var buf strings.Builder
+			out := &lockedWriter{w: &buf}
+			d.logger = slog.New(slog.NewTextHandler(out, nil))
+			listen(t, d)
+
+			if item := nextItem(t, items); item.MarketName != name {
+				t.Errorf("decoded %d bytes of name, want %d", len(item.MarketName), len(name))
+			}
+			out.mu.Lock()
+			logged := buf.String()
+			out.mu.Unlock()
+			if tt.want == "" {
+				if strings.Contains(logged, "Compression negotiated") {
+					t.Errorf("negotiation logged with compression off: %s", logged)
+				}
+			} else if !strings.Contains(logged, `msg="Compression negotiated" `+tt.want) {
+				t.Errorf("log does not report %s: %s", tt.want, logged)
+			}
+		})
+	}
+}
+
+func TestListenIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		feed func(conn *websocket.Conn, stop <-chan struct{})
+		// want is what Listen fails with; nil means it keeps running.
+		want    error
+		wantMsg string
+	}{
+		{
+			name: "stalled feed",
+			feed: func(*websocket.Conn, <-chan struct{}) {},
+			want: ErrFeedStalled,
+		},
+		{
+			// No pongs either: the connection is dead, not the feed quiet.
+			name:    "dead connection",
+			feed:    func(_ *websocket.Conn, stop <-chan struct{}) { <-stop },
+			wantMsg: "no pong received",
+		},
+		{
+			name: "steady feed",
+			feed: func(conn *websocket.Conn, stop <-chan struct{}) {
+				// Items go out while pings are answered, so this does the
+				// reading itself and shares the writer.
+				var mu sync.Mutex
+				go func() {
+					for {
+						select {
+						case <-stop:
+							return
+						case <-time.After(20 * time.Millisecond):
+							mu.Lock()
+							sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`))
+							mu.Unlock()
+						}
+					}
+				}()
+				for {
+					_, msg, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					if string(msg) == "ping" {
+						mu.Lock()
+						conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+						mu.Unlock()
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			stop := make(chan struct{})
+			srv := newFeedServer(t, func(_ int, conn *websocket.Conn) { tt.feed(conn, stop) })
+			t.Cleanup(func() { close(stop) })
+			cfg := DefaultConfig()
+			cfg.IdleTimeout = Duration(200 * time.Millisecond)
+			d, _ := newTestWatcher(t, srv, cfg)
+			d.pingInterval = 50 * time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+			defer cancel()
+			if err := d.Connect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			err := d.Listen(ctx)
+			switch {
+			case tt.want != nil:
+				if !errors.Is(err, tt.want) {
+					t.Errorf("Listen returned %v, want %v", err, tt.want)
+				}
+			case tt.wantMsg != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantMsg) || errors.Is(err, ErrFeedStalled) {
+					t.Errorf("Listen returned %v, want %q", err, tt.wantMsg)
+				}
+			default:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("Listen returned %v, want it to run until the deadline", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunReconnectsStalledFeed(t *testing.T) {
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		if n > 1 {
+			sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`))
+		}
+	})
+	cfg := DefaultConfig()
+	cfg.IdleTimeout = Duration(200 * time.Millisecond)
+	d, items := newTestWatcher(t, srv, cfg)
+	d.pingInterval = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+	nextItem(t, items)
+	if n := srv.conns.Load(); n != 2 {
+		t.Errorf("%d connections, want a reconnect after the stall", n)
+	}
+
+	api := &apiServer{watchers: []*MarketWatcher{d}, stats: newStats(), logger: testLogger}
+	rec := httptest.NewRecorder()
+	api.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if !strings.Contains(rec.Body.String(), `"last_message":`) {
+		t.Errorf("/healthz has no last_message: %s", rec.Body)
+	}
+	cancel()
+	<-done
+}
+
+func TestLogVerbosity(t *testing.T) {
+	const (
+		matched  = "AK-47 | Redline (Field-Tested)"
+		filtered = "AWP | Dragon Lore (Factory New)"
+	)
+	tests := []struct {
+		name           string
+		quiet, verbose bool
+		// filteredLogged is whether the item outside the price range shows
+		// up in the log at all.
+		filteredLogged bool
+		framesLogged   bool
+	}{
+		{name: "quiet", quiet: true},
+		{name: "default"},
+		{name: "verbose", verbose: true, filteredLogged: true, framesLogged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Quiet, cfg.Verbose = tt.quiet, tt.verbose
+			cfg.MaxPrice = 100
+			d, items := newTestWatcher(t, nil, cfg)
+			var buf strings.Builder
+			d.logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: cfg.Level()}))
+
+			d.processMessage([]byte("not json"))
+			d.processMessage(feedFrame("newitems_go", `{"i_market_name": "`+filtered+`", "ui_price": "9000"}`))
+			d.processMessage(feedFrame("newitems_go", `{"i_market_name": "`+matched+`", "ui_price": "12"}`))
+			nextItem(t, items)
+
+			logged := buf.String()
+			if n := strings.Count(logged, `msg="New item"`); n != 1 || !strings.Contains(logged, matched) {
+				t.Errorf("%d item lines, want the matched item once:\n%s", n, logged)
+			}
+			if got := strings.Contains(logged, filtered); got != tt.filteredLogged {
+				t.Errorf("filtered item logged %v, want %v:\n%s", got, tt.filteredLogged, logged)
+			}
+			if got := strings.Contains(logged, "Frame received"); got != tt.framesLogged {
+				t.Errorf("raw frames logged %v, want %v", got, tt.framesLogged)
+			}
+			if n := strings.Count(logged, "\n"); !tt.verbose && n != 1 {
+				t.Errorf("%d lines logged, want one per matched item:\n%s", n, logged)
+			}
+			if tt.quiet && !strings.Contains(logged, "level=WARN") {
+				t.Errorf("quiet mode does not log the item at warn level:\n%s", logged)
+			}
+		})
+	}
+}
+
+func TestConnectClosesPreviousConnection(t *testing.T) {
+	var closed [3]chan struct{}
+	for i := range closed {
+		closed[i] = make(chan struct{})
+	}
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		// Reads until the client goes away, then reports it.
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				close(closed[n])
+				return
+			}
+		}
+	})
+	d, _ := newTestWatcher(t, srv, nil)
+	t.Cleanup(d.closeConn)
+
+	for i := 0; i < 2; i++ {
+		if err := d.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-closed[1]:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first connection was not closed by the second Connect")
+	}
+	select {
+	case <-closed[2]:
+		t.Fatal("second connection was closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := srv.conns.Load(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+	if n := srv.tokens.Load(); n != 1 {
+		t.Errorf("%d token requests, want the token reused", n)
+	}
+}
+
+func TestListenOnlyOnce(t *testing.T) {
+	srv := newFeedServer(t, nil)
+	d, _ := newTestWatcher(t, srv, nil)
+	listen(t, d)
+	deadline := time.Now().Add(5 * time.Second)
+	for !d.listening.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("Listen did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := d.Listen(context.Background()); !errors.Is(err, ErrAlreadyListening) {
+		t.Errorf("second Listen returned %v, want %v", err, ErrAlreadyListening)
+	}
+}
+
+func TestReconnectKeepsState(t *testing.T) {
+	asiimov := func(price string) []byte {
+		return feedFrame("newitems_go", `{"i_market_name": "AWP | Asiimov (Field-Tested)", "ui_price": "`+price+`"}`)
+	}
+	tyloo := feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`)
+	srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+		if n == 1 {
+			sendFrames(conn, asiimov("50"), tyloo)
+			conn.Close()
+			return
+		}
+		// The repeat is still a duplicate and 40 undercuts the floor from
+		// the first connection.
+		sendFrames(conn, tyloo, asiimov("40"))
+	})
+	d, items := newTestWatcher(t, srv, nil)
+	d.dedup = newDedupCache(time.Hour)
+	d.floors = newPriceTracker(time.Hour, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+	var got []string
+	for i := 0; i < 3; i++ {
+		item := nextItem(t, items)
+		got = append(got, fmt.Sprintf("%s %g %v", item.MarketName, item.Price, item.NewLow))
+	}
+	noItem(t, items)
+	cancel()
+	<-done
+
+	want := []string{"AWP | Asiimov (Field-Tested) 50 false", "Sticker | Tyloo 0.03 false", "AWP | Asiimov (Field-Tested) 40 true"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("items %q, want %q", got, want)
+	}
+	if n := srv.conns.Load(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+	if snap := d.stats.Snapshot(); snap.Parsed != 4 || snap.Matched != 3 {
+		t.Errorf("stats parsed %d matched %d, want 4 and 3 across both connections", snap.Parsed, snap.Matched)
+	}
+}
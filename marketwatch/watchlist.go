@@ -0,0 +1,69 @@
+package marketwatch
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+// watchlist limits the feed to the market names in a file, one per line,
+// matched exactly but for whitespace: runs of spaces count as one and the
+// ends are trimmed. Blank lines and lines starting with # are ignored.
+// Unlike -include, "AK-47 | Redline (Field-Tested)" does not let through
+// the StatTrak or Minimal Wear versions.
+type watchlist struct {
+	path string
+
+	mu    sync.RWMutex
+	names map[string]bool
+}
+
+func newWatchlist(path string) *watchlist {
+	return &watchlist{path: path}
+}
+
+// Load reads the file and replaces the names. On error the previous names
+// stay in use.
+func (l *watchlist) Load() error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name := normalizeName(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		names[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.names = names
+	l.mu.Unlock()
+	return nil
+}
+
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Len is the number of names.
+func (l *watchlist) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.names)
+}
+
+func (l *watchlist) Contains(name string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.names[normalizeName(name)]
+}
@@ -0,0 +1,146 @@
+package marketwatch
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWatchlistLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		count int
+		names map[string]bool
+	}{
+		{
+			name:  "exact names",
+			file:  "AK-47 | Redline (Field-Tested)\nSticker | Crown (Foil)\n",
+			count: 2,
+			names: map[string]bool{
+				"AK-47 | Redline (Field-Tested)":           true,
+				"Sticker | Crown (Foil)":                   true,
+				"StatTrak™ AK-47 | Redline (Field-Tested)": false,
+				"AK-47 | Redline (Minimal Wear)":           false,
+				"ak-47 | redline (field-tested)":           false,
+				"Sticker | Crown":                          false,
+			},
+		},
+		{
+			name:  "whitespace",
+			file:  "  AK-47  |\tRedline (Field-Tested)  \r\n",
+			count: 1,
+			names: map[string]bool{
+				"AK-47 | Redline (Field-Tested)":    true,
+				" AK-47 |  Redline (Field-Tested) ": true,
+				"AK-47|Redline (Field-Tested)":      false,
+			},
+		},
+		{
+			name:  "comments and blank lines",
+			file:  "# knives\n\n   # indented comment\n★ Karambit | Fade (Factory New)\n\n#Sticker | Crown (Foil)\n",
+			count: 1,
+			names: map[string]bool{
+				"★ Karambit | Fade (Factory New)": true,
+				"Sticker | Crown (Foil)":          false,
+				"# knives":                        false,
+			},
+		},
+		{name: "empty", file: "", names: map[string]bool{"Operation Bravo Case": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newWatchlist(writeFile(t, "watchlist.txt", tt.file))
+			if err := l.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if l.Len() != tt.count {
+				t.Errorf("%d names, want %d", l.Len(), tt.count)
+			}
+			for name, want := range tt.names {
+				if got := l.Contains(name); got != want {
+					t.Errorf("Contains(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+	if err := newWatchlist("missing.txt").Load(); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want a missing file error", err)
+	}
+}
+
+func TestWatcherWatchlist(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority bool
+	}{
+		{name: "plain"},
+		{name: "priority", priority: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.WatchlistPriority = tt.priority
+			d, items := newTestWatcher(t, nil, cfg)
+			d.watchlist = newWatchlist(writeFile(t, "watchlist.txt", "AK-47 | Redline (Field-Tested)\n"))
+			if err := d.watchlist.Load(); err != nil {
+				t.Fatal(err)
+			}
+			d.processMessage(feedFrame("newitems_go", `{"i_market_name": "StatTrak™ AK-47 | Redline (Field-Tested)", "ui_price": "30"}`))
+			d.processMessage(feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"}`))
+			item := nextItem(t, items)
+			if item.MarketName != "AK-47 | Redline (Field-Tested)" || item.HighPriority != tt.priority {
+				t.Errorf("emitted %q, high priority %v; want the watched name, %v", item.MarketName, item.HighPriority, tt.priority)
+			}
+			noItem(t, items)
+		})
+	}
+}
+
+func TestWatcherWatchlistReload(t *testing.T) {
+	path := writeFile(t, "watchlist.txt", "Sticker | Tyloo\n")
+	cfg := DefaultConfig()
+	cfg.WatchlistPath = path
+	cfg.Logger = testLogger
+	w := New(*cfg)
+	if err := w.ReloadWatchlist(); err != nil {
+		t.Fatal(err)
+	}
+	d, items := newTestWatcher(t, nil, nil)
+	d.watchlist = w.watchlist
+	tyloo := feedFrame("newitems_go", `{"i_market_name": "Sticker | Tyloo", "ui_price": "0.03"}`)
+	bravo := feedFrame("newitems_go", `{"i_market_name": "Operation Bravo Case", "ui_price": "1.5"}`)
+
+	d.processMessage(tyloo)
+	d.processMessage(bravo)
+	if item := nextItem(t, items); item.MarketName != "Sticker | Tyloo" {
+		t.Errorf("emitted %q, want the sticker", item.MarketName)
+	}
+	noItem(t, items)
+
+	if err := os.WriteFile(path, []byte("# swapped\nOperation Bravo Case\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ReloadWatchlist(); err != nil {
+		t.Fatal(err)
+	}
+	d.processMessage(tyloo)
+	d.processMessage(bravo)
+	if item := nextItem(t, items); item.MarketName != "Operation Bravo Case" {
+		t.Errorf("emitted %q after the reload, want the case", item.MarketName)
+	}
+	noItem(t, items)
+
+	// A file that can't be read keeps the names in use.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ReloadWatchlist(); err == nil {
+		t.Error("reloaded a missing file")
+	}
+	if !w.watchlist.Contains("Operation Bravo Case") {
+		t.Error("names lost after a failed reload")
+	}
+	if err := New(*DefaultConfig()).ReloadWatchlist(); err == nil {
+		t.Error("reloaded without a watchlist file")
+	}
+}
@@ -0,0 +1,53 @@
+package marketwatch
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	QueueSize         = 1024
+	QueueBlockTimeout = 1 * time.Second
+
+	QueueFullBlock = "block"
+	QueueFullDrop  = "drop"
+)
+
+// startWorkers starts n goroutines running processMessage on the frames
+// the read loop queues, so a slow sink never holds up reading the socket.
+// They stop once frames is closed and drained, then mark wg done. Frames
+// are processed out of order; dedup and the other shared components are
+// safe for concurrent use, so a repeat is still dropped whichever worker
+// sees it first.
+func (d *MarketWatcher) startWorkers(wg *sync.WaitGroup, n int, frames <-chan []byte) {
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range frames {
+				d.processMessage(msg)
+			}
+		}()
+	}
+}
+
+// queueFrame hands msg to the workers. With a full queue it drops msg right
+// away or, in block mode, after waiting up to QueueBlockTimeout.
+func (d *MarketWatcher) queueFrame(frames chan<- []byte, msg []byte) {
+	select {
+	case frames <- msg:
+		return
+	default:
+	}
+	if d.config.QueueFull == QueueFullBlock {
+		timer := time.NewTimer(QueueBlockTimeout)
+		defer timer.Stop()
+		select {
+		case frames <- msg:
+			return
+		case <-timer.C:
+		}
+	}
+	d.metrics.framesDropped.Inc()
+	d.logger.Debug("Message queue full, dropping message", "queue_size", cap(frames))
+}
@@ -0,0 +1,116 @@
+package marketwatch
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// blockingReferences holds up processMessage in its reference price lookup
+// until released.
+type blockingReferences struct {
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingReferences() *blockingReferences {
+	return &blockingReferences{release: make(chan struct{})}
+}
+
+func (b *blockingReferences) ReferencePrice(string) (float64, string, bool) {
+	<-b.release
+	return 0, "", false
+}
+
+func (b *blockingReferences) Release() {
+	b.once.Do(func() { close(b.release) })
+}
+
+func TestWorkersKeepReading(t *testing.T) {
+	const frames = 5
+	tests := []struct {
+		name    string
+		workers int
+		// stalls is whether the read loop is stuck behind the slow lookup.
+		stalls bool
+	}{
+		{name: "inline", workers: 0, stalls: true},
+		{name: "workers", workers: 2, stalls: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pongSent atomic.Int64
+			srv := newFeedServer(t, func(n int, conn *websocket.Conn) {
+				for i := 0; i < frames; i++ {
+					sendFrames(conn, feedFrame("newitems_go", `{"i_market_name": "AK-47 | Redline (Field-Tested)", "ui_price": "12"}`))
+				}
+				// The read loop notes a pong as soon as it reads one. The
+				// delay keeps Listen's own markPong at the start out of it.
+				time.Sleep(50 * time.Millisecond)
+				pongSent.Store(time.Now().UnixNano())
+				sendFrames(conn, []byte("pong"))
+			})
+			cfg := DefaultConfig()
+			cfg.Workers = tt.workers
+			d, items := newTestWatcher(t, srv, cfg)
+			refs := newBlockingReferences()
+			d.refs = refs
+			listen(t, d)
+			t.Cleanup(refs.Release)
+
+			read := func() bool {
+				sent := pongSent.Load()
+				return sent != 0 && d.lastPong.Load() >= sent
+			}
+			deadline := time.Now().Add(300 * time.Millisecond)
+			for !read() && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if stalled := !read(); stalled != tt.stalls {
+				t.Errorf("read loop stalled %v, want %v", stalled, tt.stalls)
+			}
+
+			refs.Release()
+			for i := 0; i < frames; i++ {
+				nextItem(t, items)
+			}
+		})
+	}
+}
+
+func TestQueueFrameDrops(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.QueueFull = QueueFullDrop
+	d, _ := newTestWatcher(t, nil, cfg)
+	frames := make(chan []byte, 2)
+	for i := 0; i < 5; i++ {
+		d.queueFrame(frames, []byte("{}"))
+	}
+	if len(frames) != 2 {
+		t.Errorf("%d frames queued, want 2", len(frames))
+	}
+	if got := testutil.ToFloat64(d.metrics.framesDropped); got != 3 {
+		t.Errorf("%g frames dropped, want 3", got)
+	}
+}
+
+func TestQueueFrameBlocks(t *testing.T) {
+	d, _ := newTestWatcher(t, nil, nil)
+	frames := make(chan []byte, 1)
+	frames <- []byte("{}")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-frames
+	}()
+	d.queueFrame(frames, []byte(`{"second": true}`))
+	if got := testutil.ToFloat64(d.metrics.framesDropped); got != 0 {
+		t.Errorf("%g frames dropped, want the frame to wait for room", got)
+	}
+	if msg := <-frames; string(msg) != `{"second": true}` {
+		t.Errorf("queued %s", msg)
+	}
+}
@@ -0,0 +1,94 @@
+package marketwatch
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WriterQueueSize is how many outbound frames may wait for the writer.
+const WriterQueueSize = 16
+
+var errWriterClosed = errors.New("connection writer closed")
+
+// outbound is a frame for connWriter. Its result is the write error.
+type outbound struct {
+	kind    int
+	data    []byte
+	timeout time.Duration
+	result  chan error
+}
+
+// connWriter is the only goroutine writing to a connection: gorilla
+// allows one concurrent writer, and the token, subscriptions, pings, the
+// refreshed token and the close frame come from different goroutines. A
+// single queue also keeps them in the order they were sent, so the token
+// always precedes the subscriptions that depend on it.
+type connWriter struct {
+	conn     *websocket.Conn
+	queue    chan outbound
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newConnWriter(conn *websocket.Conn) *connWriter {
+	w := &connWriter{
+		conn:  conn,
+		queue: make(chan outbound, WriterQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *connWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.stop:
+			return
+		case msg := <-w.queue:
+			deadline := time.Now().Add(msg.timeout)
+			var err error
+			if msg.kind == websocket.TextMessage || msg.kind == websocket.BinaryMessage {
+				w.conn.SetWriteDeadline(deadline)
+				err = w.conn.WriteMessage(msg.kind, msg.data)
+			} else {
+				err = w.conn.WriteControl(msg.kind, msg.data, deadline)
+			}
+			msg.result <- err
+		}
+	}
+}
+
+// send queues a frame and waits until it is written or the writer stops.
+func (w *connWriter) send(kind int, data []byte, timeout time.Duration) error {
+	msg := outbound{kind: kind, data: data, timeout: timeout, result: make(chan error, 1)}
+	select {
+	case w.queue <- msg:
+	case <-w.done:
+		return errWriterClosed
+	}
+	select {
+	case err := <-msg.result:
+		return err
+	case <-w.done:
+		// The writer may have written it just before stopping.
+		select {
+		case err := <-msg.result:
+			return err
+		default:
+			return errWriterClosed
+		}
+	}
+}
+
+// close stops the writer; frames still queued fail with errWriterClosed.
+// The connection itself is left to the caller.
+func (w *connWriter) close() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
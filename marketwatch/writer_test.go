@@ -0,0 +1,149 @@
+package marketwatch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// recordingServer upgrades one connection and delivers every text frame
+// it reads, counting pings as they arrive.
+func recordingServer(t *testing.T) (*websocket.Conn, <-chan string) {
+	t.Helper()
+	frames := make(chan string, 4096)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetPingHandler(func(string) error {
+			frames <- "<ping>"
+			return nil
+		})
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- string(msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	// The client reads only to process the server's control frames.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return conn, frames
+}
+
+func TestConnWriterConcurrentSends(t *testing.T) {
+	conn, frames := recordingServer(t)
+	w := newConnWriter(conn)
+	defer w.close()
+
+	const senders, each = 8, 200
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				if err := w.send(websocket.TextMessage, []byte(fmt.Sprintf("%d:%d", s, i)), time.Second); err != nil {
+					t.Errorf("sender %d frame %d: %v", s, i, err)
+					return
+				}
+				if i%50 == 0 {
+					if err := w.send(websocket.PingMessage, nil, time.Second); err != nil {
+						t.Errorf("sender %d ping: %v", s, err)
+						return
+					}
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+	w.close()
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+
+	// Every frame arrives whole, and each sender's in the order sent.
+	next := make([]int, senders)
+	pings := 0
+	for frame := range frames {
+		if frame == "<ping>" {
+			pings++
+			continue
+		}
+		var s, i int
+		if _, err := fmt.Sscanf(frame, "%d:%d", &s, &i); err != nil || s >= senders {
+			t.Fatalf("garbled frame %q", frame)
+		}
+		if i != next[s] {
+			t.Fatalf("sender %d: frame %d after %d", s, i, next[s]-1)
+		}
+		next[s]++
+	}
+	for s, n := range next {
+		if n != each {
+			t.Errorf("sender %d: %d frames arrived, want %d", s, n, each)
+		}
+	}
+	if pings != senders*each/50 {
+		t.Errorf("%d pings, want %d", pings, senders*each/50)
+	}
+}
+
+func TestConnWriterClosed(t *testing.T) {
+	conn, _ := recordingServer(t)
+	w := newConnWriter(conn)
+	if err := w.send(websocket.TextMessage, []byte("token"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	w.close()
+	w.close()
+	if err := w.send(websocket.TextMessage, []byte("late"), time.Second); !errors.Is(err, errWriterClosed) {
+		t.Errorf("send after close = %v, want %v", err, errWriterClosed)
+	}
+}
+
+func TestWatcherConcurrentWrites(t *testing.T) {
+	srv := newFeedServer(t, nil)
+	d, _ := newTestWatcher(t, srv, nil)
+	// Listen's pings go out while the senders below run.
+	d.pingInterval = 50 * time.Millisecond
+	listen(t, d)
+
+	var wg sync.WaitGroup
+	for s := 0; s < 8; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := d.writeMessage([]byte("ping")); err != nil {
+					t.Errorf("writeMessage: %v", err)
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+}
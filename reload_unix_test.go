@@ -0,0 +1,92 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"market-ws/marketwatch"
+)
+
+// syncBuffer is a log destination safe to read while it is written.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReloadOnHangup(t *testing.T) {
+	// Keep a stray SIGHUP from ending the test binary before the reloader
+	// has registered for it.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	dir := t.TempDir()
+	blacklist := filepath.Join(dir, "blacklist.txt")
+	watchlist := filepath.Join(dir, "watchlist.txt")
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(blacklist, "Sticker | Tyloo\n")
+	write(watchlist, "AK-47 | Redline (Field-Tested)\n")
+
+	var log syncBuffer
+	logger := slog.New(slog.NewTextHandler(&log, nil))
+	cfg := marketwatch.DefaultConfig()
+	cfg.BlacklistPath, cfg.WatchlistPath, cfg.Logger = blacklist, watchlist, logger
+	watcher := marketwatch.New(*cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloadOnHangup(ctx, watcher, cfg, logger)
+
+	// hangUp signals until the log shows every line in want.
+	hangUp := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			syscall.Kill(os.Getpid(), syscall.SIGHUP)
+			time.Sleep(50 * time.Millisecond)
+			found := true
+			for _, line := range want {
+				found = found && strings.Contains(log.String(), line)
+			}
+			if found {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("log %q does not show %q", log.String(), want)
+			}
+		}
+	}
+	hangUp(`msg="Blacklist reloaded" path=`+blacklist+" entries=1", `msg="Watchlist reloaded" path=`+watchlist+" names=1")
+
+	write(blacklist, "Sticker | Tyloo\nOperation Bravo Case\n")
+	hangUp("entries=2")
+
+	write(blacklist, "steam://rungame/730/1/+csgo_econ_action_preview M1 A2\n")
+	hangUp(`msg="Blacklist reload failed"`)
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// systemdNotifier speaks the sd_notify protocol for Type=notify units:
+// READY=1 once the first market is subscribed and receiving, WATCHDOG=1 as
+// long as messages or pongs keep coming in, so that WatchdogSec= restarts a
+// process whose feeds have all stalled, and STOPPING=1 on shutdown.
+type systemdNotifier struct {
+	conn     *net.UnixConn
+	interval time.Duration // between watchdog pings, half of WATCHDOG_USEC
+	last     atomic.Int64
+}
+
+// newSystemdNotifier connects to $NOTIFY_SOCKET. It returns nil outside
+// systemd or when the socket can't be reached.
+func newSystemdNotifier(logger *slog.Logger) *systemdNotifier {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		logger.Warn("systemd notify socket unavailable", "err", err)
+		return nil
+	}
+	n := &systemdNotifier{conn: conn}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if pid := os.Getenv("WATCHDOG_PID"); err == nil && usec > 0 && (pid == "" || pid == strconv.Itoa(os.Getpid())) {
+		n.interval = time.Duration(usec) * time.Microsecond / 2
+	}
+	return n
+}
+
+func (n *systemdNotifier) send(state string) {
+	n.conn.Write([]byte(state))
+}
+
+func (n *systemdNotifier) Ready() {
+	n.send("READY=1")
+}
+
+// Alive pings the watchdog, at most once per interval: it is called for
+// every message.
+func (n *systemdNotifier) Alive() {
+	if n.interval <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := n.last.Load()
+	if now-last < int64(n.interval) || !n.last.CompareAndSwap(last, now) {
+		return
+	}
+	n.send("WATCHDOG=1")
+}
+
+func (n *systemdNotifier) Stopping() {
+	n.send("STOPPING=1")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// notifySocket listens where $NOTIFY_SOCKET points for the test.
+func notifySocket(t *testing.T, abstract bool) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify")
+	env := path
+	if abstract {
+		env = "@market-ws-test-" + strconv.Itoa(os.Getpid())
+		path = "\x00" + env[1:]
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", env)
+	return conn
+}
+
+// nextNotify returns the next state sent to the socket, or "" when none
+// comes within a short wait.
+func nextNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestSystemdNotifierEnv(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name     string
+		abstract bool
+		usec     string
+		pid      string
+		interval time.Duration
+	}{
+		{name: "no watchdog"},
+		{name: "watchdog", usec: "20000000", interval: 10 * time.Second},
+		{name: "watchdog for this process", usec: "2000000", pid: pid, interval: time.Second},
+		{name: "watchdog for another process", usec: "2000000", pid: "1"},
+		{name: "bad watchdog", usec: "soon"},
+		{name: "abstract socket", abstract: true, usec: "2000000", interval: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := notifySocket(t, tt.abstract)
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			n := newSystemdNotifier(testLogger)
+			if n == nil {
+				t.Fatal("no notifier with NOTIFY_SOCKET set")
+			}
+			defer n.conn.Close()
+			if n.interval != tt.interval {
+				t.Errorf("watchdog interval %s, want %s", n.interval, tt.interval)
+			}
+			n.Ready()
+			if got := nextNotify(t, conn); got != "READY=1" {
+				t.Errorf("sent %q, want READY=1", got)
+			}
+		})
+	}
+
+	t.Run("outside systemd", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+		if n := newSystemdNotifier(testLogger); n != nil {
+			t.Error("notifier without NOTIFY_SOCKET")
+		}
+	})
+	t.Run("socket gone", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing"))
+		if n := newSystemdNotifier(testLogger); n != nil {
+			t.Error("notifier for a missing socket")
+		}
+	})
+}
+
+func TestSystemdNotifierLifecycle(t *testing.T) {
+	conn := notifySocket(t, false)
+	t.Setenv("WATCHDOG_USEC", "20000000")
+	t.Setenv("WATCHDOG_PID", "")
+	n := newSystemdNotifier(testLogger)
+	if n == nil {
+		t.Fatal("no notifier with NOTIFY_SOCKET set")
+	}
+	defer n.conn.Close()
+
+	steps := []struct {
+		name string
+		call func()
+		want string
+	}{
+		{"ready", n.Ready, "READY=1"},
+		{"first message", n.Alive, "WATCHDOG=1"},
+		// Within the interval further messages don't ping again.
+		{"next message", n.Alive, ""},
+		{"next pong", n.Alive, ""},
+		{"after the interval", func() {
+			n.last.Store(time.Now().Add(-n.interval).UnixNano())
+			n.Alive()
+		}, "WATCHDOG=1"},
+		{"shutdown", n.Stopping, "STOPPING=1"},
+	}
+	for _, s := range steps {
+		s.call()
+		if got := nextNotify(t, conn); got != s.want {
+			t.Errorf("%s: sent %q, want %q", s.name, got, s.want)
+		}
+	}
+}
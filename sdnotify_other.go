@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import "log/slog"
+
+// systemdNotifier is a stub: sd_notify is Linux only.
+type systemdNotifier struct{}
+
+func newSystemdNotifier(logger *slog.Logger) *systemdNotifier {
+	return nil
+}
+
+func (n *systemdNotifier) Ready()    {}
+func (n *systemdNotifier) Alive()    {}
+func (n *systemdNotifier) Stopping() {}
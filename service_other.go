@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+func runService(logger *slog.Logger, cancel context.CancelFunc) (stopped func()) {
+	return func() {}
+}
@@ -0,0 +1,70 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// ServiceName is the name passed to the service manager. It only matters
+// for shared-process services; ours runs in its own process.
+const ServiceName = "market-ws"
+
+// serviceHandler reports the process running to the Windows service
+// manager and turns a stop or shutdown request into the same graceful
+// shutdown as Ctrl-C.
+type serviceHandler struct {
+	logger *slog.Logger
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-h.done:
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				h.logger.Info("Service stop requested")
+				status <- svc.Status{State: svc.StopPending}
+				h.cancel()
+			}
+		}
+	}
+}
+
+// runService hands control to the service manager when the process was
+// started by it. The returned function reports the service stopped; call
+// it once the watcher has shut down, before exiting.
+func runService(logger *slog.Logger, cancel context.CancelFunc) (stopped func()) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		logger.Warn("Service detection failed", "err", err)
+	}
+	if !isService {
+		return func() {}
+	}
+	h := &serviceHandler{logger: logger, cancel: cancel, done: make(chan struct{})}
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run(ServiceName, h); err != nil {
+			logger.Error("Service failed", "err", err)
+			cancel()
+		}
+	}()
+	return func() {
+		close(h.done)
+		<-exited
+	}
+}
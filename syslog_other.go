@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+)
+
+func newSyslogHandler(addr string, level slog.Leveler) (slog.Handler, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
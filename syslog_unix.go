@@ -0,0 +1,80 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+// syslogHandler formats records as text without a timestamp, which syslog
+// adds itself, and writes each at the syslog severity for its level.
+type syslogHandler struct {
+	slog.Handler
+	w *syslog.Writer
+	// Shared with the handlers derived by WithAttrs and WithGroup: the
+	// text handler writes into buf while mu is held.
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+// newSyslogHandler connects to the local syslog daemon, or to addr given as
+// "udp://host:514" or "tcp://host:514".
+func newSyslogHandler(addr string, level slog.Leveler) (slog.Handler, error) {
+	network, host := "", ""
+	if addr != "" {
+		var ok bool
+		network, host, ok = strings.Cut(addr, "://")
+		if !ok || (network != "udp" && network != "tcp") {
+			return nil, fmt.Errorf("invalid syslog address %q, want udp://host:port or tcp://host:port", addr)
+		}
+	}
+	w, err := syslog.Dial(network, host, syslog.LOG_INFO|syslog.LOG_DAEMON, SyslogTag)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	text := slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return &syslogHandler{Handler: text, w: w, mu: new(sync.Mutex), buf: buf}, nil
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(h.buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.w.Info(msg)
+	default:
+		return h.w.Debug(msg)
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w, mu: h.mu, buf: h.buf}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), w: h.w, mu: h.mu, buf: h.buf}
+}
@@ -0,0 +1,126 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"market-ws/marketwatch"
+)
+
+// syslogListener receives syslog datagrams on a local UDP port.
+func syslogListener(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	lines := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			lines <- string(buf[:n])
+		}
+	}()
+	return "udp://" + conn.LocalAddr().String(), lines
+}
+
+func nextSyslog(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message")
+		return ""
+	}
+}
+
+func TestSyslogHandler(t *testing.T) {
+	addr, lines := syslogListener(t)
+	h, err := newSyslogHandler(addr, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(h).With("market", "csgo")
+
+	// The daemon facility is 3, so the priority is 24 plus the severity.
+	tests := []struct {
+		level    slog.Level
+		priority string
+	}{
+		{slog.LevelError, "<27>"},
+		{slog.LevelWarn, "<28>"},
+		{slog.LevelInfo, "<30>"},
+		{slog.LevelDebug, "<31>"},
+	}
+	for _, tt := range tests {
+		logger.Log(context.Background(), tt.level, "Connected", "attempt", 1)
+		line := nextSyslog(t, lines)
+		if !strings.HasPrefix(line, tt.priority) || !strings.Contains(line, SyslogTag+"[") {
+			t.Errorf("%s: got %q, want priority %s and tag %s", tt.level, line, tt.priority, SyslogTag)
+		}
+		if want := "level=" + tt.level.String() + " msg=Connected market=csgo attempt=1"; !strings.HasSuffix(strings.TrimSpace(line), want) {
+			t.Errorf("%s: got %q, want it to end in %q", tt.level, line, want)
+		}
+		if strings.Contains(line, "time=") {
+			t.Errorf("%s: %q carries a timestamp", tt.level, line)
+		}
+	}
+}
+
+func TestSyslogHandlerAddress(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:514", "unix:///dev/log", "udp:/127.0.0.1"} {
+		if _, err := newSyslogHandler(addr, slog.LevelInfo); err == nil || !strings.Contains(err.Error(), "invalid syslog address") {
+			t.Errorf("newSyslogHandler(%q) err = %v, want an invalid address", addr, err)
+		}
+	}
+}
+
+func TestCreateLoggerSyslog(t *testing.T) {
+	inTempDir(t)
+	addr, lines := syslogListener(t)
+	cfg := marketwatch.DefaultConfig()
+	cfg.Syslog = true
+	cfg.SyslogAddr = addr
+	logger, logFile, err := createLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+
+	logger.Warn("Feed stalled")
+	logger.Debug("Frame received")
+	if line := nextSyslog(t, lines); !strings.Contains(line, "msg=\"Feed stalled\"") {
+		t.Errorf("syslog got %q, want the warning", line)
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("syslog got %q below the configured level", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+	waitForLine(t, logFile.Name(), "Feed stalled", time.Second)
+	data, err := os.ReadFile(logFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Frame received") {
+		t.Error("debug line written at the default level")
+	}
+
+	cfg.SyslogAddr = "localhost:514"
+	if _, _, err := createLogger(cfg); err == nil || !strings.HasPrefix(err.Error(), "syslog: ") {
+		t.Errorf("err = %v, want a syslog error", err)
+	}
+}